@@ -0,0 +1,74 @@
+// Package astro holds the astronomical constants and formulas shared by the catalog packages.
+package astro
+
+import "math"
+
+// SpeedOfLight in km/s
+const SpeedOfLight = 299792.458
+
+// HubbleConstant in km/s/Mpc, used to turn recession velocities into distances
+const HubbleConstant = 70.0
+
+// Redshift returns the redshift z for a heliocentric velocity in km/s, using the
+// low-velocity approximation z = v/c that catalogues such as the UGC use.
+func Redshift(velocity float64) float64 {
+	return velocity / SpeedOfLight
+}
+
+// HubbleDistance returns the distance in Mpc implied by a recession velocity in km/s,
+// using Hubble's law d = v/H0. It reports false for velocities that aren't positive, such as
+// Local Group galaxies falling towards us, where Hubble's law says nothing about distance.
+// Peculiar velocities make it unreliable below a few hundred km/s even when it is positive.
+func HubbleDistance(velocity float64) (float64, bool) {
+	if velocity <= 0 {
+		return 0, false
+	}
+	return velocity / HubbleConstant, true
+}
+
+// ParallaxDistance returns the distance in parsecs of a star with a parallax in
+// milliarcseconds, 1000/parallax. It reports false for parallaxes that aren't positive,
+// which Gaia measures for faint and distant stars, and which give no distance.
+func ParallaxDistance(parallax float64) (float64, bool) {
+	if !(parallax > 0) {
+		return 0, false
+	}
+	return 1000 / parallax, true
+}
+
+// DistanceModulus returns m - M, the difference between the apparent and absolute magnitude
+// of a star at a distance in parsecs, 5 log10(d) - 5.
+func DistanceModulus(distance float64) float64 {
+	return 5*math.Log10(distance) - 5
+}
+
+// TangentialVelocity returns the speed in km/s across the line of sight of a star at a
+// distance in parsecs moving at a total proper motion in milliarcseconds a year.
+// A star 1 pc away moving 1 arcsecond a year covers 1 au a year, which is 4.74 km/s.
+func TangentialVelocity(proper_motion float64, distance float64) float64 {
+	return AstronomicalUnitKmYearPerSecond * proper_motion / 1000 * distance
+}
+
+// AngularDistance returns the angle in degrees between two positions given as right
+// ascension and declination in degrees, using the haversine formula, which stays accurate for
+// the small separations of cone searches and cross-matches where the cosine formula doesn't.
+func AngularDistance(ra1, dec1, ra2, dec2 float64) float64 {
+	ra1, dec1, ra2, dec2 = radians(ra1), radians(dec1), radians(ra2), radians(dec2)
+
+	sin_dec := math.Sin((dec2 - dec1) / 2)
+	sin_ra := math.Sin((ra2 - ra1) / 2)
+	h := sin_dec*sin_dec + math.Cos(dec1)*math.Cos(dec2)*sin_ra*sin_ra
+
+	// Rounding can push h just past 1 for antipodal points
+	return degrees(2 * math.Asin(math.Sqrt(math.Min(h, 1))))
+}
+
+// Convert degrees to radians
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+// Convert radians to degrees
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
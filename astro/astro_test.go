@@ -0,0 +1,87 @@
+// Tests for Redshift, HubbleDistance, the parallax formulas and AngularDistance
+package astro
+
+import (
+	"math"
+	"testing"
+)
+
+// TestRedshift checks z = v/c for the Coma cluster's velocity of about 6925 km/s
+func TestRedshift(t *testing.T) {
+	want := 0.0231
+	got := Redshift(6925)
+
+	if math.Abs(got-want) > 0.0001 {
+		t.Fatalf(`Redshift should be %v, is %v`, want, got)
+	}
+}
+
+// TestHubbleDistance checks d = v/H0, and that approaching galaxies have no Hubble distance
+func TestHubbleDistance(t *testing.T) {
+	got, ok := HubbleDistance(7000)
+	if !ok || got != 100 {
+		t.Fatalf(`HubbleDistance should be 100 Mpc, is %v, %v`, got, ok)
+	}
+
+	// Andromeda is approaching at about 300 km/s
+	if _, ok := HubbleDistance(-300); ok {
+		t.Fatalf(`HubbleDistance should not be defined for a negative velocity`)
+	}
+}
+
+// TestParallaxDistance checks Proxima Centauri's 1.30 pc from its Gaia DR3 parallax, and
+// that parallaxes that aren't positive give no distance
+func TestParallaxDistance(t *testing.T) {
+	got, ok := ParallaxDistance(768.0665)
+	if !ok || math.Abs(got-1.302) > 0.001 {
+		t.Fatalf(`Proxima Centauri should be 1.302 pc away, is %v, %v`, got, ok)
+	}
+	for _, parallax := range []float64{0, -0.5, math.NaN()} {
+		if _, ok := ParallaxDistance(parallax); ok {
+			t.Fatalf(`A parallax of %v should give no distance`, parallax)
+		}
+	}
+}
+
+// TestDistanceModulus checks that absolute magnitudes are apparent magnitudes at 10 pc,
+// and that the LMC at 49.6 kpc is at a distance modulus of 18.48
+func TestDistanceModulus(t *testing.T) {
+	if got := DistanceModulus(10); math.Abs(got) > 1e-12 {
+		t.Fatalf(`The distance modulus at 10 pc should be 0, is %v`, got)
+	}
+	if got := DistanceModulus(49600); math.Abs(got-18.477) > 0.001 {
+		t.Fatalf(`The LMC's distance modulus should be 18.477, is %v`, got)
+	}
+}
+
+// TestTangentialVelocity checks Barnard's star, moving 10.39 arcseconds a year at 1.83 pc,
+// which is about 90 km/s
+func TestTangentialVelocity(t *testing.T) {
+	got := TangentialVelocity(math.Hypot(-801.551, 10362.394), 1000/546.976)
+	if math.Abs(got-90.07) > 0.01 {
+		t.Fatalf(`Barnard's star's tangential velocity should be 90.07 km/s, is %v`, got)
+	}
+}
+
+// TestAngularDistance checks distances across RA 0, over the pole, and between
+// positions an arcsecond apart, where RA differences shrink by cos(dec)
+func TestAngularDistance(t *testing.T) {
+	tests := []struct {
+		ra1, dec1, ra2, dec2 float64
+		want                 float64
+	}{
+		{359.5, 0, 0.5, 0, 1},
+		{0, 89, 180, 89, 2},
+		{10, 45, 10, 45, 0},
+		{0, 0, 180, 0, 180},
+		{10, 0, 10, 1.0 / 3600, 1.0 / 3600},
+		{10, 60, 10 + 2.0/3600, 60, 1.0 / 3600},
+	}
+
+	for _, test := range tests {
+		got := AngularDistance(test.ra1, test.dec1, test.ra2, test.dec2)
+		if math.Abs(got-test.want) > 1e-6 {
+			t.Fatalf(`AngularDistance %v should be %v, is %v`, test, test.want, got)
+		}
+	}
+}
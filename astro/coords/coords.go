@@ -0,0 +1,126 @@
+// Package coords converts positions between the ICRS equatorial frame the catalog stores,
+// the Galactic frame, and the ecliptic frame, and reads and writes sexagesimal positions
+// such as "12h30m49.4s +12°23'28\"".
+// All angles are in degrees. Longitudes are from 0 up to 360, and latitudes from -90 to 90.
+package coords
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// A Frame is a celestial coordinate system. Positions in every frame are a longitude and a
+// latitude: ra and dec for ICRS, l and b for Galactic, and ecliptic longitude and latitude.
+type Frame string
+
+const (
+	// ICRS is the International Celestial Reference System, the frame of Gaia positions
+	ICRS Frame = "icrs"
+	// Galactic is the IAU 1958 Galactic frame, as tied to ICRS by Hipparcos
+	Galactic Frame = "galactic"
+	// Ecliptic is the mean ecliptic and equinox of J2000
+	Ecliptic Frame = "ecliptic"
+)
+
+// Frames lists the frames by name, for command line flags
+var Frames = []Frame{ICRS, Galactic, Ecliptic}
+
+// Obliquity is the mean obliquity of the ecliptic at J2000, 84381.448 arcseconds (IAU 1976),
+// in degrees
+const Obliquity = 84381.448 / 3600
+
+// galacticMatrix turns an ICRS unit vector into a Galactic one. Its rows are the Galactic
+// x, y and z axes in ICRS: towards the Galactic centre, towards l = 90, and towards the
+// north Galactic pole. From the Hipparcos catalogue, ESA SP-1200 volume 1, section 1.5.3.
+var galacticMatrix = [3][3]float64{
+	{-0.0548755604162154, -0.8734370902348850, -0.4838350155487132},
+	{+0.4941094278755837, -0.4448296299600112, +0.7469822444972189},
+	{-0.8676661490190047, -0.1980763734312015, +0.4559837761750669},
+}
+
+// eclipticMatrix turns an ICRS unit vector into an ecliptic one, by a rotation of
+// Obliquity about the x axis. The 23 milliarcsecond frame bias between ICRS and the J2000
+// equator is left out.
+var eclipticMatrix = [3][3]float64{
+	{1, 0, 0},
+	{0, math.Cos(Obliquity * math.Pi / 180), math.Sin(Obliquity * math.Pi / 180)},
+	{0, -math.Sin(Obliquity * math.Pi / 180), math.Cos(Obliquity * math.Pi / 180)},
+}
+
+// ParseFrame returns the Frame with the given name, ignoring case. An empty name is ICRS,
+// and equatorial is another name for it.
+func ParseFrame(name string) (Frame, error) {
+	switch strings.ToLower(name) {
+	case "", "icrs", "equatorial":
+		return ICRS, nil
+	case "galactic":
+		return Galactic, nil
+	case "ecliptic":
+		return Ecliptic, nil
+	}
+	return "", fmt.Errorf("unknown frame %q, should be one of %v", name, Frames)
+}
+
+// Convert returns the position lon, lat in frame from as a position in frame to.
+func Convert(from Frame, to Frame, lon float64, lat float64) (float64, float64) {
+	if from == to {
+		return lon, lat
+	}
+	ra, dec := ToICRS(from, lon, lat)
+	return FromICRS(to, ra, dec)
+}
+
+// ToICRS returns the ra and dec of the position lon, lat in frame.
+func ToICRS(frame Frame, lon float64, lat float64) (float64, float64) {
+	switch frame {
+	case Galactic:
+		return rotate(transpose(galacticMatrix), lon, lat)
+	case Ecliptic:
+		return rotate(transpose(eclipticMatrix), lon, lat)
+	}
+	return lon, lat
+}
+
+// FromICRS returns the position in frame of ra, dec.
+func FromICRS(frame Frame, ra float64, dec float64) (float64, float64) {
+	switch frame {
+	case Galactic:
+		return rotate(galacticMatrix, ra, dec)
+	case Ecliptic:
+		return rotate(eclipticMatrix, ra, dec)
+	}
+	return ra, dec
+}
+
+// Rotate the position lon, lat by matrix, through its unit vector
+func rotate(matrix [3][3]float64, lon float64, lat float64) (float64, float64) {
+	lon, lat = lon*math.Pi/180, lat*math.Pi/180
+	vector := [3]float64{math.Cos(lat) * math.Cos(lon), math.Cos(lat) * math.Sin(lon), math.Sin(lat)}
+
+	var rotated [3]float64
+	for i := range matrix {
+		for j := range vector {
+			rotated[i] += matrix[i][j] * vector[j]
+		}
+	}
+
+	lon = math.Atan2(rotated[1], rotated[0]) * 180 / math.Pi
+	if lon < 0 {
+		lon += 360
+	}
+	// Rounding can take z just past 1 at the poles
+	lat = math.Asin(math.Max(-1, math.Min(1, rotated[2]))) * 180 / math.Pi
+	return lon, lat
+}
+
+// Return the transpose of a rotation matrix, which is its inverse
+func transpose(matrix [3][3]float64) [3][3]float64 {
+	var transposed [3][3]float64
+	for i := range matrix {
+		for j := range matrix[i] {
+			transposed[j][i] = matrix[i][j]
+		}
+	}
+	return transposed
+}
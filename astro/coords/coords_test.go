@@ -0,0 +1,109 @@
+// Tests for Convert, ToICRS, FromICRS and ParseFrame
+package coords
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Report whether two angles in degrees are within tolerance of each other, allowing for
+// longitudes either side of 0
+func near(a float64, b float64, tolerance float64) bool {
+	difference := math.Abs(a - b)
+	return difference <= tolerance || math.Abs(difference-360) <= tolerance
+}
+
+// TestGalactic checks the Galactic centre, poles and node against the values that define
+// the frame in the Hipparcos catalogue (ESA SP-1200), and M31 against SIMBAD
+func TestGalactic(t *testing.T) {
+	tests := []struct {
+		name      string
+		ra, dec   float64
+		l, b      float64
+		tolerance float64
+	}{
+		{"Galactic centre", 266.40499, -28.93617, 0, 0, 1e-5},
+		{"north Galactic pole", 192.85948, 27.12825, 0, 90, 1e-5},
+		{"south Galactic pole", 12.85948, -27.12825, 0, -90, 1e-5},
+		// The north celestial pole is at l = 122.93192, where the Galactic equator meets the
+		// ICRS equator at l = 32.93192
+		{"north celestial pole", 0, 90, 122.93192, 27.12825, 1e-5},
+		{"M31", 10.684708, 41.268750, 121.1743, -21.5733, 1e-4},
+	}
+
+	for _, test := range tests {
+		l, b := FromICRS(Galactic, test.ra, test.dec)
+		// The longitude of a pole is undefined
+		if (math.Abs(test.b) < 90 && !near(l, test.l, test.tolerance)) || !near(b, test.b, test.tolerance) {
+			t.Fatalf(`%s should be at l %v, b %v, is %v, %v`, test.name, test.l, test.b, l, b)
+		}
+
+		if math.Abs(test.dec) == 90 {
+			continue
+		}
+		ra, dec := ToICRS(Galactic, test.l, test.b)
+		if (math.Abs(test.b) < 90 && !near(ra, test.ra, test.tolerance)) || !near(dec, test.dec, test.tolerance) {
+			t.Fatalf(`%s should be at ra %v, dec %v, is %v, %v`, test.name, test.ra, test.dec, ra, dec)
+		}
+	}
+}
+
+// TestEcliptic checks the obliquity, the ecliptic pole and solstice, and Meeus's example 13.a,
+// Pollux, from Astronomical Algorithms
+func TestEcliptic(t *testing.T) {
+	if math.Abs(Obliquity-23.4392911) > 1e-7 {
+		t.Fatalf(`Obliquity should be 23.4392911 degrees, is %v`, Obliquity)
+	}
+
+	tests := []struct {
+		name     string
+		ra, dec  float64
+		lon, lat float64
+	}{
+		{"March equinox", 0, 0, 0, 0},
+		{"June solstice", 90, Obliquity, 90, 0},
+		{"north ecliptic pole", 270, 90 - Obliquity, 0, 90},
+		{"Pollux", 116.328942, 28.026183, 113.215630, 6.684170},
+	}
+
+	for _, test := range tests {
+		lon, lat := FromICRS(Ecliptic, test.ra, test.dec)
+		if (test.lat < 90 && !near(lon, test.lon, 1e-6)) || !near(lat, test.lat, 1e-6) {
+			t.Fatalf(`%s should be at ecliptic %v, %v, is %v, %v`, test.name, test.lon, test.lat, lon, lat)
+		}
+	}
+}
+
+// TestConvert converts random positions between every pair of frames and back again
+func TestConvert(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		lon, lat := random.Float64()*360, math.Asin(random.Float64()*2-1)*180/math.Pi
+		for _, from := range Frames {
+			for _, to := range Frames {
+				converted_lon, converted_lat := Convert(from, to, lon, lat)
+				if converted_lon < 0 || converted_lon >= 360 {
+					t.Fatalf(`Convert %s to %s of %v, %v gives longitude %v`, from, to, lon, lat, converted_lon)
+				}
+				back_lon, back_lat := Convert(to, from, converted_lon, converted_lat)
+				if !near(back_lon, lon, 1e-9) || !near(back_lat, lat, 1e-9) {
+					t.Fatalf(`Convert %s to %s and back of %v, %v gives %v, %v`, from, to, lon, lat, back_lon, back_lat)
+				}
+			}
+		}
+	}
+}
+
+// TestParseFrame checks the names of the frames
+func TestParseFrame(t *testing.T) {
+	for name, want := range map[string]Frame{"": ICRS, "ICRS": ICRS, "equatorial": ICRS, "Galactic": Galactic, "ecliptic": Ecliptic} {
+		if frame, err := ParseFrame(name); err != nil || frame != want {
+			t.Fatalf(`ParseFrame %q should be %s, is %s, %v`, name, want, frame, err)
+		}
+	}
+	if _, err := ParseFrame("fk4"); err == nil {
+		t.Fatalf(`ParseFrame should refuse fk4`)
+	}
+}
@@ -0,0 +1,183 @@
+package coords
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sexagesimalSeparators are the characters that can end the parts of a sexagesimal angle
+const sexagesimalSeparators = "hdms°'\"′″:"
+
+// ParseAngle reads an angle in degrees, as a number like "-41.27", or sexagesimal degrees,
+// arcminutes and arcseconds like "-41°16'09.5\"", "-41d16m09.5s", "-41:16:09.5" or
+// "-41 16 09.5". Minutes and seconds can be left off. Hours, like "12h30m", are refused.
+func ParseAngle(text string) (float64, error) {
+	if strings.Contains(text, "h") {
+		return 0, fmt.Errorf("%q is in hours, not degrees", text)
+	}
+	value, _, err := parseSexagesimal(text)
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// ParseRa reads a right ascension and returns it in degrees. Sexagesimal values like
+// "12h30m49.4s", "12:30:49.4" or "12 30 49.4" are hours, minutes and seconds of time, and
+// plain numbers, or sexagesimal values marked with d or °, are degrees.
+func ParseRa(text string) (float64, error) {
+	value, sexagesimal, err := parseSexagesimal(text)
+	if err != nil {
+		return 0, err
+	}
+	if sexagesimal && !strings.ContainsAny(text, "d°") {
+		value *= 15
+	}
+	return value, nil
+}
+
+// ParsePosition reads a longitude and latitude in degrees from one string, like
+// "12h30m49.4s +12°23'28\"", "12 30 49.4 +12 23 28" or "187.7059 12.3911". The parts are
+// split at whitespace: either two parts, or three numbers each, or at the sign of the
+// latitude. The longitude is read with ParseRa if frame is ICRS, and ParseAngle otherwise.
+func ParsePosition(text string, frame Frame) (float64, float64, error) {
+	fields := strings.Fields(text)
+
+	split := -1
+	switch {
+	case len(fields) == 2:
+		split = 1
+	case len(fields) == 6:
+		split = 3
+	default:
+		for i := 1; i < len(fields); i++ {
+			if strings.HasPrefix(fields[i], "+") || strings.HasPrefix(fields[i], "-") {
+				split = i
+				break
+			}
+		}
+	}
+	if split < 0 {
+		return 0, 0, fmt.Errorf("%q is not a position", text)
+	}
+
+	parse_lon := ParseAngle
+	if frame == ICRS {
+		parse_lon = ParseRa
+	}
+	lon, err := parse_lon(strings.Join(fields[:split], " "))
+	if err != nil {
+		return 0, 0, err
+	}
+	lat, err := ParseAngle(strings.Join(fields[split:], " "))
+	if err != nil {
+		return 0, 0, err
+	}
+	if lon < 0 || lon > 360 || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("%q is not a position", text)
+	}
+	return lon, lat, nil
+}
+
+// FormatRa writes ra, in degrees, as hours, minutes and seconds of time like "12h30m49.40s",
+// with the given number of decimal places of seconds.
+func FormatRa(ra float64, decimals int) string {
+	ra = math.Mod(ra, 360)
+	if ra < 0 {
+		ra += 360
+	}
+	hours, minutes, seconds := splitSexagesimal(ra/15, decimals)
+	// Rounding up to 24h is 0h
+	if hours == 24 {
+		hours = 0
+	}
+	return fmt.Sprintf("%02dh%02dm%ss", hours, minutes, formatSeconds(seconds, decimals))
+}
+
+// FormatAngle writes an angle in degrees as signed degrees, arcminutes and arcseconds like
+// "+12°23'28.0\"", with the given number of decimal places of arcseconds.
+func FormatAngle(angle float64, decimals int) string {
+	sign := "+"
+	if angle < 0 {
+		sign = "-"
+	}
+	degrees, minutes, seconds := splitSexagesimal(math.Abs(angle), decimals)
+	// A negative angle that rounds to zero is +0
+	if degrees == 0 && minutes == 0 && seconds == 0 {
+		sign = "+"
+	}
+	return fmt.Sprintf("%s%02d°%02d'%s\"", sign, degrees, minutes, formatSeconds(seconds, decimals))
+}
+
+// FormatPosition writes a position in frame as sexagesimal: "12h30m49.40s +12°23'28.0\""
+// for ICRS, and degrees for both parts in other frames. decimals is the number of decimal
+// places of arcseconds, and seconds of RA have one more, since they are 15 times bigger.
+func FormatPosition(lon float64, lat float64, frame Frame, decimals int) string {
+	if frame == ICRS {
+		return FormatRa(lon, decimals+1) + " " + FormatAngle(lat, decimals)
+	}
+	return strings.TrimPrefix(FormatAngle(lon, decimals), "+") + " " + FormatAngle(lat, decimals)
+}
+
+// Parse a number, or up to three sexagesimal parts with an optional sign, and report
+// whether it was sexagesimal
+func parseSexagesimal(text string) (float64, bool, error) {
+	trimmed := strings.TrimSpace(text)
+	if value, err := strconv.ParseFloat(trimmed, 64); err == nil {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, false, fmt.Errorf("%q is not an angle", text)
+		}
+		return value, false, nil
+	}
+
+	sign := 1.0
+	if strings.HasPrefix(trimmed, "-") {
+		sign = -1
+	}
+	trimmed = strings.TrimLeft(trimmed, "+-")
+
+	parts := strings.FieldsFunc(trimmed, func(r rune) bool {
+		return r == ' ' || strings.ContainsRune(sexagesimalSeparators, r)
+	})
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, false, fmt.Errorf("%q is not an angle", text)
+	}
+
+	value := 0.0
+	scale := 1.0
+	for i, part := range parts {
+		number, err := strconv.ParseFloat(part, 64)
+		// Minutes and seconds are below 60, and only the last part can have a fraction
+		if err != nil || number < 0 || (i > 0 && number >= 60) || (i < len(parts)-1 && number != math.Trunc(number)) {
+			return 0, false, fmt.Errorf("%q is not an angle", text)
+		}
+		value += number / scale
+		scale *= 60
+	}
+	return sign * value, true, nil
+}
+
+// Split a positive value into whole units, whole minutes and seconds rounded to decimals
+// places, carrying any seconds that round up to 60
+func splitSexagesimal(value float64, decimals int) (int, int, float64) {
+	scale := math.Pow(10, float64(decimals))
+	total := math.Round(value * 3600 * scale)
+
+	units := math.Floor(total / (3600 * scale))
+	total -= units * 3600 * scale
+	minutes := math.Floor(total / (60 * scale))
+	total -= minutes * 60 * scale
+
+	return int(units), int(minutes), total / scale
+}
+
+// Write seconds with two digits before the point and decimals after it
+func formatSeconds(seconds float64, decimals int) string {
+	width := 2
+	if decimals > 0 {
+		width += decimals + 1
+	}
+	return fmt.Sprintf("%0*.*f", width, decimals, seconds)
+}
@@ -0,0 +1,100 @@
+// Tests for parsing and formatting sexagesimal angles and positions
+package coords
+
+import (
+	"math"
+	"testing"
+)
+
+// TestParseAngle reads degrees written in each of the ways it accepts
+func TestParseAngle(t *testing.T) {
+	tests := map[string]float64{
+		"41.27":         41.27,
+		"-0.5":          -0.5,
+		`+12°23'28"`:    12 + 23.0/60 + 28.0/3600,
+		"12d23m28s":     12 + 23.0/60 + 28.0/3600,
+		"-12:23:28.8":   -(12 + 23.0/60 + 28.8/3600),
+		"-00 30":        -0.5,
+		"12°23′28″":     12 + 23.0/60 + 28.0/3600,
+		" +41 16 09.5 ": 41 + 16.0/60 + 9.5/3600,
+	}
+	for text, want := range tests {
+		if got, err := ParseAngle(text); err != nil || math.Abs(got-want) > 1e-12 {
+			t.Fatalf(`ParseAngle %q should be %v, is %v, %v`, text, want, got, err)
+		}
+	}
+
+	for _, text := range []string{"", "north", "12:60:00", "12.5:30", "1 2 3 4", "12h30m", "NaN", "12:-3"} {
+		if _, err := ParseAngle(text); err == nil {
+			t.Fatalf(`ParseAngle %q should fail`, text)
+		}
+	}
+}
+
+// TestParseRa checks that sexagesimal RAs are hours unless marked as degrees
+func TestParseRa(t *testing.T) {
+	tests := map[string]float64{
+		"12h30m49.4s": (12 + 30.0/60 + 49.4/3600) * 15,
+		"12:30:49.4":  (12 + 30.0/60 + 49.4/3600) * 15,
+		"00 42 44.3":  (42.0/60 + 44.3/3600) * 15,
+		"187.7059":    187.7059,
+		"187d42m":     187.7,
+	}
+	for text, want := range tests {
+		if got, err := ParseRa(text); err != nil || math.Abs(got-want) > 1e-12 {
+			t.Fatalf(`ParseRa %q should be %v, is %v, %v`, text, want, got, err)
+		}
+	}
+}
+
+// TestParsePosition reads M87 in the ways ParsePosition splits, and Galactic positions in degrees
+func TestParsePosition(t *testing.T) {
+	ra, dec := (12+30.0/60+49.4/3600)*15, 12+23.0/60+28.0/3600
+
+	for _, text := range []string{`12h30m49.4s +12°23'28"`, "12 30 49.4 +12 23 28", "12:30:49.4 12:23:28", "12h 30m 49.4s +12d 23m 28s"} {
+		got_ra, got_dec, err := ParsePosition(text, ICRS)
+		if err != nil || math.Abs(got_ra-ra) > 1e-9 || math.Abs(got_dec-dec) > 1e-9 {
+			t.Fatalf(`ParsePosition %q should be %v, %v, is %v, %v, %v`, text, ra, dec, got_ra, got_dec, err)
+		}
+	}
+
+	l, b, err := ParsePosition("283:46:38 74:29:28", Galactic)
+	if err != nil || math.Abs(l-(283+46.0/60+38.0/3600)) > 1e-9 || math.Abs(b-(74+29.0/60+28.0/3600)) > 1e-9 {
+		t.Fatalf(`ParsePosition of a Galactic position should be degrees, is %v, %v, %v`, l, b, err)
+	}
+
+	for _, text := range []string{"187.7", "12 30 49 12 23", "400 10", "10 95"} {
+		if _, _, err := ParsePosition(text, ICRS); err == nil {
+			t.Fatalf(`ParsePosition %q should fail`, text)
+		}
+	}
+}
+
+// TestFormat checks formatting, rounding up to 60 seconds, negative angles near zero, and
+// that formatted positions read back
+func TestFormat(t *testing.T) {
+	ra, dec := (12+30.0/60+49.4/3600)*15, 12+23.0/60+28.0/3600
+
+	tests := []struct {
+		got, want string
+	}{
+		{FormatRa(ra, 2), "12h30m49.40s"},
+		{FormatAngle(dec, 1), `+12°23'28.0"`},
+		{FormatAngle(-dec, 0), `-12°23'28"`},
+		{FormatRa(359.99999999, 2), "00h00m00.00s"},
+		{FormatAngle(29.99999999, 2), `+30°00'00.00"`},
+		{FormatAngle(-0.0000001, 1), `+00°00'00.0"`},
+		{FormatPosition(ra, dec, ICRS, 1), `12h30m49.40s +12°23'28.0"`},
+		{FormatPosition(283.5, -0.25, Galactic, 0), `283°30'00" -00°15'00"`},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Fatalf(`Formatted angle should be %s, is %s`, test.want, test.got)
+		}
+	}
+
+	got_ra, got_dec, err := ParsePosition(FormatPosition(ra, dec, ICRS, 3), ICRS)
+	if err != nil || math.Abs(got_ra-ra) > 1e-6 || math.Abs(got_dec-dec) > 1e-6 {
+		t.Fatalf(`A formatted position should read back as %v, %v, is %v, %v, %v`, ra, dec, got_ra, got_dec, err)
+	}
+}
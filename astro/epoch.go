@@ -0,0 +1,104 @@
+package astro
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GaiaEpoch is the epoch of Gaia DR3 positions, as a Julian year
+const GaiaEpoch = 2016.0
+
+// AstronomicalUnitKmYearPerSecond is the astronomical unit in km yr/s, which turns a
+// parallax and a proper motion in the same units into a velocity in km/s
+const AstronomicalUnitKmYearPerSecond = 4.740470446
+
+// MaxProperMotion is a little more than the proper motion of Barnard's star, the fastest
+// known, 10.4 arcseconds a year, in milliarcseconds a year
+const MaxProperMotion = 10500.0
+
+// j2000 is the start of the Julian year 2000.0, JD 2451545.0
+var j2000 = time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// JulianYear returns the epoch of t as a Julian year, such as 2000.0 for noon on
+// 1 January 2000, UTC.
+func JulianYear(t time.Time) float64 {
+	return 2000 + t.Sub(j2000).Hours()/24/365.25
+}
+
+// ParseEpoch reads an epoch as a Julian year like "2000", "J2000" or "J2024.5", or a date
+// like "2024-03-01" or an RFC 3339 time, and returns it as a Julian year.
+func ParseEpoch(text string) (float64, error) {
+	text = strings.TrimSpace(text)
+	if year, err := strconv.ParseFloat(strings.TrimPrefix(text, "J"), 64); err == nil && !math.IsNaN(year) && !math.IsInf(year, 0) {
+		return year, nil
+	}
+	for _, layout := range []string{time.DateOnly, time.RFC3339} {
+		if t, err := time.Parse(layout, text); err == nil {
+			return JulianYear(t), nil
+		}
+	}
+	return 0, fmt.Errorf("%q is not an epoch, like J2000 or 2024-03-01", text)
+}
+
+// Astrometry is a star's position and motion at some epoch: ra and dec in degrees, parallax
+// in milliarcseconds, proper motions in milliarcseconds a year, with Pmra including the
+// cos(dec) factor as in Gaia, and the radial velocity in km/s.
+type Astrometry struct {
+	Ra, Dec        float64
+	Parallax       float64
+	Pmra, Pmdec    float64
+	RadialVelocity float64
+}
+
+// Propagate returns astrometry moved on by years Julian years, which can be negative.
+// It uses the rigorous model of the Hipparcos catalogue, ESA SP-1200 volume 1, section
+// 1.5.5, where a star moves in a straight line at constant speed, so the radial velocity
+// changes the proper motion and parallax as the star comes closer or recedes. That needs a
+// positive parallax; without one the radial velocity is left out and the star moves along
+// a great circle.
+func Propagate(astrometry Astrometry, years float64) Astrometry {
+	ra, dec := radians(astrometry.Ra), radians(astrometry.Dec)
+	// The unit vector towards the star, and unit vectors towards the east and north
+	r := [3]float64{math.Cos(dec) * math.Cos(ra), math.Cos(dec) * math.Sin(ra), math.Sin(dec)}
+	p := [3]float64{-math.Sin(ra), math.Cos(ra), 0}
+	q := [3]float64{-math.Sin(dec) * math.Cos(ra), -math.Sin(dec) * math.Sin(ra), math.Cos(dec)}
+
+	// Proper motions, and the radial motion as a proper motion, in radians a year
+	mas := math.Pi / 180 / 3600 / 1000
+	pmra, pmdec := astrometry.Pmra*mas, astrometry.Pmdec*mas
+	pmr := 0.0
+	if astrometry.Parallax > 0 {
+		pmr = astrometry.RadialVelocity * astrometry.Parallax / AstronomicalUnitKmYearPerSecond * mas
+	}
+	pm2 := pmra*pmra + pmdec*pmdec
+
+	f := 1 / math.Sqrt(1+2*pmr*years+(pm2+pmr*pmr)*years*years)
+	var u, pm [3]float64
+	for i := range u {
+		pm0 := p[i]*pmra + q[i]*pmdec
+		u[i] = (r[i]*(1+pmr*years) + pm0*years) * f
+		pm[i] = (pm0*(1+pmr*years) - r[i]*pm2*years) * f * f * f
+	}
+
+	ra = math.Atan2(u[1], u[0])
+	if ra < 0 {
+		ra += 2 * math.Pi
+	}
+	dec = math.Asin(math.Max(-1, math.Min(1, u[2])))
+	p = [3]float64{-math.Sin(ra), math.Cos(ra), 0}
+	q = [3]float64{-math.Sin(dec) * math.Cos(ra), -math.Sin(dec) * math.Sin(ra), math.Cos(dec)}
+
+	moved := Astrometry{Ra: degrees(ra), Dec: degrees(dec), Parallax: astrometry.Parallax * f, RadialVelocity: astrometry.RadialVelocity}
+	for i := range pm {
+		moved.Pmra += p[i] * pm[i] / mas
+		moved.Pmdec += q[i] * pm[i] / mas
+	}
+	if astrometry.Parallax > 0 {
+		pmr = (pmr + (pm2+pmr*pmr)*years) * f * f
+		moved.RadialVelocity = pmr / mas * AstronomicalUnitKmYearPerSecond / moved.Parallax
+	}
+	return moved
+}
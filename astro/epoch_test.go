@@ -0,0 +1,106 @@
+// Tests for ParseEpoch and Propagate
+package astro
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// barnard is Barnard's star in Gaia DR3, source_id 4472832130942575872, at J2016.0
+var barnard = Astrometry{
+	Ra:             269.44850252543836,
+	Dec:            4.739420051112412,
+	Parallax:       546.975939730948,
+	Pmra:           -801.551,
+	Pmdec:          10362.394,
+	RadialVelocity: -110.353,
+}
+
+// TestParseEpoch reads Julian years and dates
+func TestParseEpoch(t *testing.T) {
+	tests := []struct {
+		text string
+		want float64
+	}{
+		{"2000", 2000},
+		{"J2000", 2000},
+		{"J2024.5", 2024.5},
+		{"2000-01-01T12:00:00Z", 2000},
+		// J2016.0 is noon on 1 January 2016
+		{"2016-01-01", 2016 - 0.5/365.25},
+	}
+	for _, test := range tests {
+		got, err := ParseEpoch(test.text)
+		if err != nil || math.Abs(got-test.want) > 1e-9 {
+			t.Fatalf(`ParseEpoch(%q) should be %v, is %v, %v`, test.text, test.want, got, err)
+		}
+	}
+
+	for _, text := range []string{"", "J", "now", "NaN", "2024-13-01"} {
+		if _, err := ParseEpoch(text); err == nil {
+			t.Fatalf(`ParseEpoch(%q) should fail`, text)
+		}
+	}
+
+	if got := JulianYear(time.Date(2016, 7, 2, 0, 0, 0, 0, time.UTC)); math.Abs(got-2016.5) > 1e-3 {
+		t.Fatalf(`JulianYear of 2 July 2016 should be about 2016.5, is %v`, got)
+	}
+}
+
+// TestPropagateBarnard moves Barnard's star back to J2000. SIMBAD gives its J2000 position
+// as 17 57 48.4972 +04 41 36.114 by propagating linearly, and the rigorous position is
+// about 0.17 arcseconds further north, since the star is approaching and its proper motion
+// grows by about 1.3 mas/yr each year, its secular acceleration.
+func TestPropagateBarnard(t *testing.T) {
+	moved := Propagate(barnard, -16)
+
+	arcsecond := 1.0 / 3600
+	simbad_ra, simbad_dec := (17+57/60.0+48.4972/3600)*15, 4+41/60.0+36.114/3600
+	if math.Abs(moved.Ra-simbad_ra)*math.Cos(radians(moved.Dec)) > 0.01*arcsecond {
+		t.Fatalf(`Barnard's star should be at RA %v at J2000, is %v`, simbad_ra, moved.Ra)
+	}
+	if north := (moved.Dec - simbad_dec) / arcsecond; north < 0.15 || north > 0.19 {
+		t.Fatalf(`Barnard's star should be 0.17" north of the linear J2000 position, is %v"`, north)
+	}
+
+	pm0 := math.Hypot(barnard.Pmra, barnard.Pmdec)
+	pm := math.Hypot(moved.Pmra, moved.Pmdec)
+	if acceleration := (pm0 - pm) / 16; acceleration < 1.2 || acceleration > 1.35 {
+		t.Fatalf(`Barnard's star's secular acceleration should be about 1.3 mas/yr², is %v`, acceleration)
+	}
+	if moved.Parallax >= barnard.Parallax || moved.RadialVelocity >= barnard.RadialVelocity {
+		t.Fatalf(`Barnard's star should have been further away and approaching faster at J2000, is %+v`, moved)
+	}
+
+	// Propagating forward again gets back to the start
+	back := Propagate(moved, 16)
+	if math.Abs(back.Ra-barnard.Ra) > 1e-9 || math.Abs(back.Dec-barnard.Dec) > 1e-9 ||
+		math.Abs(back.Pmra-barnard.Pmra) > 1e-6 || math.Abs(back.Pmdec-barnard.Pmdec) > 1e-6 ||
+		math.Abs(back.Parallax-barnard.Parallax) > 1e-9 || math.Abs(back.RadialVelocity-barnard.RadialVelocity) > 1e-9 {
+		t.Fatalf(`Propagating back to J2016 should give %+v, is %+v`, barnard, back)
+	}
+}
+
+// TestPropagateLinear checks that a star without a parallax moves at its proper motion,
+// ignoring its radial velocity, and that a star without a proper motion doesn't move
+func TestPropagateLinear(t *testing.T) {
+	star := Astrometry{Ra: 0.001, Dec: -30, Pmra: -1000, Pmdec: 2000, RadialVelocity: 100}
+	moved := Propagate(star, 10)
+
+	// 10 arcseconds west, across RA 0, and 20 arcseconds north, to within the curvature of
+	// the great circle
+	want_ra := 360 + 0.001 - 10.0/3600/math.Cos(radians(-30))
+	want_dec := -30 + 20.0/3600
+	if math.Abs(moved.Ra-want_ra) > 1e-6 || math.Abs(moved.Dec-want_dec) > 1e-6 {
+		t.Fatalf(`The star should move to %v %v, is %v %v`, want_ra, want_dec, moved.Ra, moved.Dec)
+	}
+	if moved.RadialVelocity != 100 || moved.Parallax != 0 {
+		t.Fatalf(`The radial velocity and parallax should be unchanged, are %+v`, moved)
+	}
+
+	still := Astrometry{Ra: 120, Dec: 45, Parallax: 10}
+	if moved := Propagate(still, 100); math.Abs(moved.Ra-120) > 1e-12 || math.Abs(moved.Dec-45) > 1e-12 || moved.Parallax != 10 {
+		t.Fatalf(`A star without motion should stay put, is %+v`, moved)
+	}
+}
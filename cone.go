@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"strconv"
+	"time"
+
+	"star-catalog/astro"
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+	starpkg "star-catalog/star"
+)
+
+// frameColumns names the CSV columns of a position in each frame other than ICRS
+var frameColumns = map[coords.Frame][2]string{
+	coords.Galactic: {"l", "b"},
+	coords.Ecliptic: {"elon", "elat"},
+}
+
+// runCone finds the stars within a radius of a position, and writes them to out as CSV,
+// nearest first, with their distance from the position in degrees. The position is in
+// degrees or sexagesimal, in the frame given by -frame, and the radius is in degrees. In
+// a frame other than ICRS each star's position in that frame is written too. With -epoch the
+// stars are searched and written at their positions on that date, rather than Gaia's J2016.0.
+func runCone(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("cone", flag.ContinueOnError)
+	flags.SetOutput(out)
+	frame_name := flags.String("frame", "icrs", fmt.Sprintf("frame of the position, one of %v", coords.Frames))
+	epoch_text := flags.String("epoch", "", "epoch of the position, like J2000 or 2024-03-01 (default J2016.0)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 3 {
+		return fmt.Errorf("cone needs a position and a radius in degrees\n%s", usage)
+	}
+	frame, err := coords.ParseFrame(*frame_name)
+	if err != nil {
+		return fmt.Errorf("cone: %v", err)
+	}
+
+	lon, lat, err := coords.ParsePosition(flags.Arg(0)+" "+flags.Arg(1), frame)
+	if err != nil {
+		return fmt.Errorf("cone: %v", err)
+	}
+	radius, err := strconv.ParseFloat(flags.Arg(2), 64)
+	if err != nil {
+		return fmt.Errorf("cone: %q is not a number of degrees", flags.Arg(2))
+	}
+	ra, dec := coords.ToICRS(frame, lon, lat)
+	epoch := astro.GaiaEpoch
+	if *epoch_text != "" {
+		if epoch, err = astro.ParseEpoch(*epoch_text); err != nil {
+			return fmt.Errorf("cone: %v", err)
+		}
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	order, err := database.HealpixOrder()
+	if err != nil {
+		return err
+	}
+	// Search the healpix column's index as well as the dec and ra, if the stars are indexed
+	store := starpkg.NewSQLStore(db)
+	if ok, err := store.UseHealpix(ctx, order); err != nil {
+		return err
+	} else if !ok {
+		log.Printf("Stars aren't all indexed at HEALPix order %d, so the search doesn't use the index; run the healpix command\n", order)
+	}
+
+	results, err := starpkg.ConeSearchAt(ctx, store, ra, dec, radius, epoch)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(out)
+	header := append(database.Columns(starpkg.Star{}), "distance")
+	columns, in_frame := frameColumns[frame]
+	if in_frame {
+		header = append(header, columns[0], columns[1])
+	}
+	writer.Write(header)
+	for _, result := range results {
+		var record []string
+		for _, value := range database.FieldValues(result.Star) {
+			record = append(record, formatCell(value))
+		}
+		record = append(record, formatCell(result.Distance))
+		if in_frame {
+			// Every star a cone search finds has a position
+			lon, lat, _ := result.Position(frame)
+			record = append(record, formatCell(lon), formatCell(lat))
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// Format a struct field as CSV text: empty for nil pointers, floats exactly, and times as
+// RFC 3339 in UTC
+func formatCell(value any) string {
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() == reflect.Pointer {
+		if reflected.IsNil() {
+			return ""
+		}
+		value = reflected.Elem().Interface()
+	}
+
+	switch value := value.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,103 @@
+// Tests for the cone command
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+)
+
+// TestConeCommand searches around Andromeda's centre, and checks the CSV output
+func TestConeCommand(t *testing.T) {
+	database.InitDB()
+
+	var out bytes.Buffer
+	if err := runCone(context.Background(), []string{"10.6847", "41.2690", "0.01"}, &out); err != nil {
+		t.Fatalf(`cone %v`, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !strings.HasPrefix(lines[0], "id,galaxy_id,name,") || !strings.HasSuffix(lines[0], ",distance") {
+		t.Fatalf(`cone header should be the star columns and distance, is %s`, lines[0])
+	}
+	if len(lines) != 2 || !strings.Contains(lines[1], ",Star3,gaia_catalogue_id3,") || !strings.HasSuffix(lines[1], ",0") {
+		t.Fatalf(`cone should find Star3 at distance 0, is %q`, lines[1:])
+	}
+
+	if err := runCone(context.Background(), []string{"10.6847", "north", "0.01"}, &out); err == nil {
+		t.Fatalf(`cone should fail for a dec that isn't a number`)
+	}
+	if err := runCone(context.Background(), []string{"-frame", "supergalactic", "10", "41", "0.01"}, &out); err == nil {
+		t.Fatalf(`cone should fail for an unknown frame`)
+	}
+	if err := runCone(context.Background(), []string{"-epoch", "soon", "10", "41", "0.01"}, &out); err == nil {
+		t.Fatalf(`cone should fail for an unknown epoch`)
+	}
+}
+
+// TestConeCommandFrames searches around Star3 by its sexagesimal ICRS position, and by its
+// TestConeCommandUnindexed clears the stars' pixels, as after the migration that adds the
+// healpix column, and checks that cone still finds Star3
+func TestConeCommandUnindexed(t *testing.T) {
+	db := database.InitDB()
+	if _, err := db.Exec("UPDATE stars SET healpix = NULL"); err != nil {
+		t.Fatalf(`Clearing healpix %v`, err)
+	}
+
+	var out bytes.Buffer
+	if err := runCone(context.Background(), []string{"10.6847", "41.2690", "0.01"}, &out); err != nil {
+		t.Fatalf(`cone %v`, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], ",Star3,") {
+		t.Fatalf(`cone should find Star3 without the healpix index, is %q`, lines)
+	}
+}
+
+// Galactic position, which adds l and b columns
+func TestConeCommandFrames(t *testing.T) {
+	database.InitDB()
+
+	var out bytes.Buffer
+	if err := runCone(context.Background(), []string{"00h42m44.33s", "+41°16'08.4\"", "0.001"}, &out); err != nil {
+		t.Fatalf(`cone %v`, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], ",Star3,") {
+		t.Fatalf(`A sexagesimal cone should find Star3, is %q`, lines)
+	}
+
+	l, b := coords.FromICRS(coords.Galactic, 10.6847, 41.2690)
+	out.Reset()
+	args := []string{"-frame", "galactic", fmt.Sprint(l), fmt.Sprint(b), "0.001"}
+	if err := runCone(context.Background(), args, &out); err != nil {
+		t.Fatalf(`cone %v`, err)
+	}
+	lines = strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !strings.HasSuffix(lines[0], ",distance,l,b") {
+		t.Fatalf(`A Galactic cone header should end with l and b, is %s`, lines[0])
+	}
+	if len(lines) != 2 || !strings.Contains(lines[1], ",Star3,") || !strings.HasSuffix(lines[1], fmt.Sprintf(",%v,%v", l, b)) {
+		t.Fatalf(`A Galactic cone should find Star3 at l %v b %v, is %q`, l, b, lines)
+	}
+}
+
+// TestConeCommandEpoch searches around Star3 at J2000, and checks that it is written at its
+// J2000 position
+func TestConeCommandEpoch(t *testing.T) {
+	database.InitDB()
+
+	var out bytes.Buffer
+	if err := runCone(context.Background(), []string{"-epoch", "J2000", "10.6847", "41.2690", "0.001"}, &out); err != nil {
+		t.Fatalf(`cone %v`, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], ",Star3,") || strings.Contains(lines[1], ",41.269,") {
+		t.Fatalf(`cone should find Star3 at its J2000 position, is %q`, lines)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"star-catalog/astro/coords"
+	"star-catalog/crossmatch"
+	"star-catalog/database"
+	starpkg "star-catalog/star"
+)
+
+// runCrossmatch matches the sources in a CSV file, or a VOTable if the file ends in .vot or
+// .xml, to the nearest stars, and writes a CSV row to out for each source, in file order.
+// Positions are read in the frame given by -frame, and can be sexagesimal.
+// The row has the source's id, its ICRS ra and dec, and its nearest star's id, gaia_catalogue_id and
+// name with the separation in arcseconds, which are empty if nothing was close enough.
+// matches counts the stars within the tolerance, so more than 1 is an ambiguous match.
+func runCrossmatch(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("crossmatch", flag.ContinueOnError)
+	flags.SetOutput(out)
+	tolerance := flags.Float64("tolerance", crossmatch.DefaultTolerance, "largest separation of a match, in arcseconds")
+	id_column := flags.String("id", "id", "column of each source's id")
+	ra_column := flags.String("ra", "ra", "column of each source's ra, or longitude in another -frame, in degrees or sexagesimal (hours for ICRS ra)")
+	dec_column := flags.String("dec", "dec", "column of each source's dec, or latitude in another -frame, in degrees or sexagesimal")
+	frame_name := flags.String("frame", "icrs", fmt.Sprintf("frame of the -ra and -dec columns, one of %v", coords.Frames))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("crossmatch needs one CSV or VOTable file\n%s", usage)
+	}
+	frame, err := coords.ParseFrame(*frame_name)
+	if err != nil {
+		return fmt.Errorf("crossmatch: %v", err)
+	}
+	path := flags.Arg(0)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := decompress(path, file)
+	if err != nil {
+		return err
+	}
+
+	options := crossmatch.Options{Tolerance: *tolerance, IdColumn: *id_column, RaColumn: *ra_column, DecColumn: *dec_column, Frame: frame}
+	switch filepath.Ext(strings.TrimSuffix(path, ".gz")) {
+	case ".vot", ".xml":
+		options.Format = "votable"
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	order, err := database.HealpixOrder()
+	if err != nil {
+		return err
+	}
+	stars := starpkg.NewSQLStore(db)
+	if ok, err := stars.UseHealpix(ctx, order); err != nil {
+		return err
+	} else if !ok {
+		log.Printf("Stars aren't all indexed at HEALPix order %d, so the search doesn't use the index; run the healpix command\n", order)
+	}
+
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"id", "ra", "dec", "star_id", "gaia_catalogue_id", "name", "separation", "matches"})
+
+	summary, err := crossmatch.Match(ctx, stars, reader, options, func(result crossmatch.Result) error {
+		record := []string{result.Id, formatCell(result.Ra), formatCell(result.Dec), "", "", "", "", strconv.Itoa(len(result.Candidates))}
+		if best, ok := result.Best(); ok {
+			record[3], record[4], record[5], record[6] = formatCell(best.Id), best.GaiaCatalogueId, best.Name, formatCell(best.Separation)
+		}
+		return writer.Write(record)
+	})
+	writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("runCrossmatch matched %d of %d sources, %d of them ambiguously\n", summary.Matched, summary.Sources, summary.Ambiguous)
+	return writer.Error()
+}
@@ -0,0 +1,268 @@
+// Package crossmatch links the sources of an external catalogue, such as a survey's
+// detections, to the nearest stars in the catalog by position.
+// Match reads sources from CSV or a VOTable and finds the stars within a tolerance of each
+// one through a star.ConeSearcher, reporting the nearest and any others close enough to
+// make the match ambiguous.
+// Sources are read in batches and grouped by HEALPix pixel. A pixel with many sources has
+// its stars fetched from the store once, and kept sorted by dec in memory to match each
+// source against, so a million sources take minutes rather than a million queries.
+package crossmatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"star-catalog/astro"
+	"star-catalog/astro/coords"
+	"star-catalog/healpix"
+	"star-catalog/star"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultTolerance is the largest separation of a match, in arcseconds, when
+// Options.Tolerance isn't set.
+const DefaultTolerance = 1.0
+
+// DefaultBatchSize is the number of sources read and matched together when
+// Options.BatchSize isn't set.
+const DefaultBatchSize = 100000
+
+// DefaultGroupOrder is the HEALPix order of the pixels sources are grouped by when
+// Options.GroupOrder isn't set. Its pixels are about 14 arcminutes across.
+const DefaultGroupOrder = 8
+
+// DefaultConcurrency is the number of groups matched at once when Options.Concurrency isn't set.
+const DefaultConcurrency = 4
+
+// minGroupSize is the fewest sources in a pixel for the pixel's stars to be fetched together.
+// Sources in emptier pixels get a cone search each, which reads fewer stars.
+const minGroupSize = 8
+
+// Options control how Match reads sources and matches them. The zero value reads CSV with
+// id, ra and dec columns, and matches within DefaultTolerance.
+type Options struct {
+	// Tolerance is the largest separation of a match, in arcseconds
+	Tolerance float64
+	// Format is "csv", the default, or "votable"
+	Format string
+	// IdColumn, RaColumn and DecColumn name the columns of each source's id and position,
+	// which default to id, ra and dec. Sources are numbered from 1 if there is no id column.
+	IdColumn, RaColumn, DecColumn string
+	// Frame is the frame of the positions, ICRS by default. In other frames RaColumn and
+	// DecColumn hold the longitude and latitude, which are converted to ICRS.
+	Frame coords.Frame
+	// BatchSize is the number of sources matched together, DefaultBatchSize if it is 0
+	BatchSize int
+	// GroupOrder is the HEALPix order sources are grouped by, DefaultGroupOrder if it is 0
+	GroupOrder int
+	// Concurrency is the number of groups matched at once, DefaultConcurrency if it is 0
+	Concurrency int
+}
+
+// A Candidate is a star within the tolerance of a source, and its separation in arcseconds.
+type Candidate struct {
+	star.Star
+	Separation float64
+}
+
+// A Result is a source and the stars within the tolerance of it, nearest first.
+type Result struct {
+	Source
+	Candidates []Candidate
+}
+
+// Best returns the nearest star to the source, or false if none was close enough.
+func (result Result) Best() (Candidate, bool) {
+	if len(result.Candidates) == 0 {
+		return Candidate{}, false
+	}
+	return result.Candidates[0], true
+}
+
+// Ambiguous reports whether more than one star was close enough to the source to match it.
+func (result Result) Ambiguous() bool {
+	return len(result.Candidates) > 1
+}
+
+// A Summary counts the sources Match read, and how many were matched to one star or more,
+// and to more than one.
+type Summary struct {
+	Sources   int
+	Matched   int
+	Ambiguous int
+}
+
+// Match reads sources from reader and calls fn with the Result for each one, in the order
+// they were read, stopping at the first error. Stars come from stars, which for SQLStore
+// is fastest with its HealpixOrder set. A source without a valid position stops the match,
+// since the rest of the file is likely to be wrong too.
+func Match(ctx context.Context, stars star.ConeSearcher, reader io.Reader, options Options, fn func(Result) error) (Summary, error) {
+	if options.Tolerance == 0 {
+		options.Tolerance = DefaultTolerance
+	}
+	if !(options.Tolerance > 0) {
+		return Summary{}, fmt.Errorf("Match: tolerance %v is not positive", options.Tolerance)
+	}
+	if options.IdColumn == "" {
+		options.IdColumn = "id"
+	}
+	if options.RaColumn == "" {
+		options.RaColumn = "ra"
+	}
+	if options.DecColumn == "" {
+		options.DecColumn = "dec"
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.GroupOrder <= 0 {
+		options.GroupOrder = DefaultGroupOrder
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = DefaultConcurrency
+	}
+	if options.Frame == "" {
+		options.Frame = coords.ICRS
+	}
+	if err := healpix.CheckOrder(options.GroupOrder); err != nil {
+		return Summary{}, fmt.Errorf("Match: %v", err)
+	}
+
+	sources, err := newSourceReader(reader, options)
+	if err != nil {
+		return Summary{}, fmt.Errorf("Match: %w", err)
+	}
+
+	matcher := matcher{stars: stars, options: options, tolerance: options.Tolerance / 3600}
+	var summary Summary
+	for done := false; !done; {
+		var batch []Source
+		for len(batch) < options.BatchSize {
+			source, err := sources.Read()
+			if errors.Is(err, io.EOF) {
+				done = true
+				break
+			}
+			if err != nil {
+				return summary, fmt.Errorf("Match: %w", err)
+			}
+			batch = append(batch, source)
+		}
+
+		results, err := matcher.matchBatch(ctx, batch)
+		if err != nil {
+			return summary, fmt.Errorf("Match: %w", err)
+		}
+
+		for _, result := range results {
+			summary.Sources++
+			if len(result.Candidates) > 0 {
+				summary.Matched++
+			}
+			if result.Ambiguous() {
+				summary.Ambiguous++
+			}
+			if err := fn(result); err != nil {
+				return summary, fmt.Errorf("Match: %w", err)
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// matcher finds the stars near batches of sources
+type matcher struct {
+	stars   star.ConeSearcher
+	options Options
+	// Options.Tolerance in degrees
+	tolerance float64
+}
+
+// Match a batch of sources, grouping them by pixel and matching the groups concurrently.
+// The results are in the same order as the sources.
+func (matcher matcher) matchBatch(ctx context.Context, batch []Source) ([]Result, error) {
+	results := make([]Result, len(batch))
+	groups := map[int64][]int{}
+	for i, source := range batch {
+		results[i].Source = source
+		pixel := healpix.Pixel(matcher.options.GroupOrder, source.Ra, source.Dec)
+		groups[pixel] = append(groups[pixel], i)
+	}
+
+	// Each group fills in the results of its own sources, so they don't need a lock
+	g, group_ctx := errgroup.WithContext(ctx)
+	g.SetLimit(matcher.options.Concurrency)
+	for pixel, indexes := range groups {
+		g.Go(func() error {
+			if len(indexes) < minGroupSize {
+				return matcher.matchEach(group_ctx, indexes, results)
+			}
+			return matcher.matchGroup(group_ctx, pixel, indexes, results)
+		})
+	}
+
+	return results, g.Wait()
+}
+
+// Match the sources at indexes with a cone search each
+func (matcher matcher) matchEach(ctx context.Context, indexes []int, results []Result) error {
+	for _, i := range indexes {
+		source := results[i].Source
+		found, err := star.ConeSearch(ctx, matcher.stars, source.Ra, source.Dec, matcher.tolerance)
+		if err != nil {
+			return err
+		}
+		for _, cone := range found {
+			results[i].Candidates = append(results[i].Candidates, Candidate{Star: cone.Star, Separation: cone.Distance * 3600})
+		}
+	}
+	return nil
+}
+
+// Match the sources at indexes, which are all in pixel, against the stars fetched from the
+// box around the pixel, sorted by dec so that each source only checks the stars in a strip
+// the height of the tolerance
+func (matcher matcher) matchGroup(ctx context.Context, pixel int64, indexes []int, results []Result) error {
+	// Every source is within MaxPixelRadius of the pixel's centre, so their matches are
+	// within that and the tolerance
+	center_ra, center_dec := healpix.Center(matcher.options.GroupOrder, pixel)
+	box := star.BoundingBox(center_ra, center_dec, healpix.MaxPixelRadius(matcher.options.GroupOrder)+matcher.tolerance)
+
+	var stars []star.Star
+	err := matcher.stars.EachStarInBox(ctx, box, func(s star.Star) error {
+		stars = append(stars, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Slice(stars, func(i, j int) bool {
+		return *stars[i].Dec < *stars[j].Dec
+	})
+
+	for _, i := range indexes {
+		source := results[i].Source
+		first := sort.Search(len(stars), func(j int) bool {
+			return *stars[j].Dec >= source.Dec-matcher.tolerance
+		})
+
+		var candidates []Candidate
+		for j := first; j < len(stars) && *stars[j].Dec <= source.Dec+matcher.tolerance; j++ {
+			distance := astro.AngularDistance(source.Ra, source.Dec, *stars[j].Ra, *stars[j].Dec)
+			if distance <= matcher.tolerance {
+				candidates = append(candidates, Candidate{Star: stars[j], Separation: distance * 3600})
+			}
+		}
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return candidates[a].Separation < candidates[b].Separation
+		})
+		results[i].Candidates = candidates
+	}
+
+	return nil
+}
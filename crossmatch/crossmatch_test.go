@@ -0,0 +1,201 @@
+// Tests for Match
+package crossmatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"star-catalog/database"
+	"star-catalog/galaxy"
+	"star-catalog/memstore"
+	"star-catalog/star"
+)
+
+// Return a store with stars at the given positions, named by their index
+func storeWith(positions [][2]float64) *memstore.Store {
+	store := memstore.New()
+	for i, position := range positions {
+		ra, dec := position[0], position[1]
+		store.AddStar(star.Star{Name: fmt.Sprint("star", i), Ra: &ra, Dec: &dec})
+	}
+	return store
+}
+
+// Match the CSV sources against store and return the results
+func matchAll(t *testing.T, store star.ConeSearcher, csv string, options Options) ([]Result, Summary) {
+	var results []Result
+	summary, err := Match(context.Background(), store, strings.NewReader(csv), options, func(result Result) error {
+		results = append(results, result)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf(`Match %v`, err)
+	}
+	return results, summary
+}
+
+// Return the names of a result's candidates
+func candidateNames(result Result) []string {
+	var names []string
+	for _, candidate := range result.Candidates {
+		names = append(names, candidate.Name)
+	}
+	return names
+}
+
+// TestMatch matches sources with one star, two stars, and none within the tolerance,
+// including a match across RA 0
+func TestMatch(t *testing.T) {
+	arcsecond := 1.0 / 3600
+	store := storeWith([][2]float64{
+		{10, 20},
+		{10 + 0.5*arcsecond, 20},
+		{10, 20 + 3*arcsecond},
+		{359.9999, 0},
+		{100, -30},
+	})
+
+	csv := "id,ra,dec\n" +
+		"near both,10,20\n" +
+		"near one,10,20.0008\n" +
+		"across 0,0.0001,0\n" +
+		"alone,200,0\n"
+
+	results, summary := matchAll(t, store, csv, Options{})
+
+	if want := (Summary{Sources: 4, Matched: 3, Ambiguous: 1}); summary != want {
+		t.Fatalf(`Match should return %+v, is %+v`, want, summary)
+	}
+
+	want := [][]string{{"star0", "star1"}, {"star2"}, {"star3"}, nil}
+	for i, result := range results {
+		got := candidateNames(result)
+		if fmt.Sprint(got) != fmt.Sprint(want[i]) {
+			t.Fatalf(`Source %s should match %v, matches %v`, result.Id, want[i], got)
+		}
+	}
+
+	best, ok := results[0].Best()
+	if !ok || best.Separation != 0 || !results[0].Ambiguous() {
+		t.Fatalf(`The first source should have an exact and ambiguous best match, is %+v`, results[0])
+	}
+	if separation := results[2].Candidates[0].Separation; math.Abs(separation-0.72) > 1e-6 {
+		t.Fatalf(`The match across RA 0 should be 0.72 arcseconds away, is %v`, separation)
+	}
+	if _, ok := results[3].Best(); ok || results[3].Ambiguous() {
+		t.Fatalf(`The source with no stars near it should have no match, is %+v`, results[3])
+	}
+
+	// A wider tolerance finds the third star for the first source too
+	results, _ = matchAll(t, store, csv, Options{Tolerance: 5})
+	if got := candidateNames(results[0]); len(got) != 3 || got[2] != "star2" {
+		t.Fatalf(`With a 5 arcsecond tolerance the first source should match 3 stars, matches %v`, got)
+	}
+}
+
+// TestMatchGroups matches random sources, crowded enough that some pixels are matched as a
+// group and others one at a time, in small batches, and checks the results against cone
+// searches and that they are in the order the sources were read
+func TestMatchGroups(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	var positions [][2]float64
+	csv := "id,ra,dec\n"
+	for i := 0; i < 2000; i++ {
+		ra, dec := 50+random.Float64()*0.5, 30+random.Float64()*0.5
+		positions = append(positions, [2]float64{ra, dec})
+		if i%4 == 0 {
+			csv += fmt.Sprintf("%d,%v,%v\n", i, ra+random.Float64()*0.0003, dec)
+		}
+	}
+	csv += "far,200,-10\n"
+	store := storeWith(positions)
+
+	results, summary := matchAll(t, store, csv, Options{Tolerance: 2, BatchSize: 100})
+	if summary.Sources != 501 || len(results) != 501 || results[500].Id != "far" {
+		t.Fatalf(`Match should return 501 results in order, is %+v`, summary)
+	}
+
+	for i, result := range results {
+		if result.Id != "far" && result.Id != fmt.Sprint(i*4) {
+			t.Fatalf(`Result %d should be source %d, is %s`, i, i*4, result.Id)
+		}
+
+		found, err := star.ConeSearch(context.Background(), store, result.Ra, result.Dec, 2.0/3600)
+		if err != nil {
+			t.Fatalf(`ConeSearch %v`, err)
+		}
+		if len(found) != len(result.Candidates) {
+			t.Fatalf(`Source %s should match %d stars, matches %d`, result.Id, len(found), len(result.Candidates))
+		}
+		for j := range found {
+			if found[j].Name != result.Candidates[j].Name {
+				t.Fatalf(`Source %s match %d should be %s, is %s`, result.Id, j, found[j].Name, result.Candidates[j].Name)
+			}
+		}
+	}
+}
+
+// TestMatchErrors checks bad options and sources, and errors from fn and the store
+func TestMatchErrors(t *testing.T) {
+	store := storeWith([][2]float64{{10, 20}})
+	csv := "id,ra,dec\n1,10,20\n"
+	fn := func(Result) error { return nil }
+
+	tests := []struct {
+		csv     string
+		options Options
+		want    string
+	}{
+		{csv, Options{Tolerance: -1}, "tolerance -1 is not positive"},
+		{csv, Options{GroupOrder: 30}, "HEALPix order 30"},
+		{"id,ra\n", Options{}, "no dec column"},
+		{"id,ra,dec\n1,10,20\n2,10,x\n", Options{}, `row 2: dec "x"`},
+	}
+	for _, test := range tests {
+		_, err := Match(context.Background(), store, strings.NewReader(test.csv), test.options, fn)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf(`Match should fail with %s, is %v`, test.want, err)
+		}
+	}
+
+	stop := errors.New("stop")
+	_, err := Match(context.Background(), store, strings.NewReader(csv), Options{}, func(Result) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Fatalf(`Match should return the error from fn, is %v`, err)
+	}
+
+	store.StarErr = errors.New("store failed")
+	_, err = Match(context.Background(), store, strings.NewReader(csv), Options{}, fn)
+	if !errors.Is(err, store.StarErr) {
+		t.Fatalf(`Match should return the store's error, is %v`, err)
+	}
+}
+
+// TestMatchSQL matches sources against the stars table, searched by its healpix column
+func TestMatchSQL(t *testing.T) {
+	db := database.InitDB()
+
+	andromeda, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number2")
+	if err != nil {
+		t.Fatalf(`FindGalaxy %v`, err)
+	}
+
+	stars := star.NewSQLStore(db)
+	stars.HealpixOrder = 12
+
+	csv := "id,ra,dec\nd1,10.6847,41.2691\nd2,10.6847,41.3\n"
+	results, summary := matchAll(t, stars, csv, Options{})
+	if summary.Matched != 1 {
+		t.Fatalf(`Match should match 1 source, is %+v`, summary)
+	}
+	best, ok := results[0].Best()
+	if !ok || best.Name != "Star3" || best.GalaxyId != andromeda.Id || math.Abs(best.Separation-0.36) > 1e-6 {
+		t.Fatalf(`d1 should match Star3 0.36 arcseconds away, is %+v`, results[0])
+	}
+}
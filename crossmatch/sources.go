@@ -0,0 +1,141 @@
+package crossmatch
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"star-catalog/astro/coords"
+	"star-catalog/votable"
+)
+
+// A Source is a position in an external catalogue, to be matched to our stars. Its position
+// is ICRS, whatever frame the file was in.
+type Source struct {
+	Id  string
+	Ra  float64 // degrees
+	Dec float64 // degrees
+}
+
+// A sourceReader reads Sources from the rows of a file, whose cells are strings for CSV, or
+// the values from votable.Reader.Next. id is -1 if there is no id column.
+type sourceReader struct {
+	rows        func() ([]any, error)
+	id, ra, dec int
+	row         int
+	frame       coords.Frame
+}
+
+// Start reading sources from reader, in options.Format, finding the id, ra and dec columns
+// in its header. The id column is optional, and sources are numbered from 1 without one.
+func newSourceReader(reader io.Reader, options Options) (*sourceReader, error) {
+	var header []string
+	sources := &sourceReader{frame: options.Frame}
+
+	switch options.Format {
+	case "", "csv":
+		csv_reader := csv.NewReader(reader)
+		csv_reader.Comment = '#'
+		var err error
+		if header, err = csv_reader.Read(); err != nil {
+			return nil, fmt.Errorf("reading header: %w", err)
+		}
+		sources.rows = func() ([]any, error) {
+			record, err := csv_reader.Read()
+			row := make([]any, len(record))
+			for i, cell := range record {
+				row[i] = cell
+			}
+			return row, err
+		}
+	case "votable":
+		votable_reader, err := votable.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range votable_reader.Fields() {
+			header = append(header, field.Name)
+		}
+		sources.rows = votable_reader.Next
+	default:
+		return nil, fmt.Errorf("unknown format %q", options.Format)
+	}
+
+	position := map[string]int{}
+	for i, name := range header {
+		position[name] = i
+	}
+
+	var ok bool
+	if sources.ra, ok = position[options.RaColumn]; !ok {
+		return nil, fmt.Errorf("the header has no %s column for the ra", options.RaColumn)
+	}
+	if sources.dec, ok = position[options.DecColumn]; !ok {
+		return nil, fmt.Errorf("the header has no %s column for the dec", options.DecColumn)
+	}
+	if sources.id, ok = position[options.IdColumn]; !ok {
+		sources.id = -1
+	}
+
+	return sources, nil
+}
+
+// Read the next source, or return io.EOF after the last one. Text positions can be
+// sexagesimal, with RAs in hours. A row without a valid position is an error, since it
+// can't be matched.
+func (sources *sourceReader) Read() (Source, error) {
+	row, err := sources.rows()
+	if err != nil {
+		return Source{}, err
+	}
+	sources.row++
+
+	source := Source{Id: strconv.Itoa(sources.row)}
+	if sources.id >= 0 && row[sources.id] != nil {
+		source.Id = fmt.Sprint(row[sources.id])
+	}
+
+	parse_lon := coords.ParseAngle
+	if sources.frame == coords.ICRS || sources.frame == "" {
+		parse_lon = coords.ParseRa
+	}
+	if source.Ra, err = degrees(row[sources.ra], parse_lon, 0, 360); err != nil {
+		return source, fmt.Errorf("row %d: ra %v", sources.row, err)
+	}
+	if source.Dec, err = degrees(row[sources.dec], coords.ParseAngle, -90, 90); err != nil {
+		return source, fmt.Errorf("row %d: dec %v", sources.row, err)
+	}
+	source.Ra, source.Dec = coords.ToICRS(sources.frame, source.Ra, source.Dec)
+
+	return source, nil
+}
+
+// Convert a cell to a number of degrees from min to max, reading text with parse
+func degrees(value any, parse func(string) (float64, error), min float64, max float64) (float64, error) {
+	var number float64
+	switch value := value.(type) {
+	case float64:
+		number = value
+	case int64:
+		number = float64(value)
+	case string:
+		if value == "" || value == "null" {
+			return 0, fmt.Errorf("is missing")
+		}
+		parsed, err := parse(value)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", value)
+		}
+		number = parsed
+	case nil:
+		return 0, fmt.Errorf("is missing")
+	default:
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+
+	if !(number >= min && number <= max) {
+		return 0, fmt.Errorf("%v is outside %v to %v", number, min, max)
+	}
+	return number, nil
+}
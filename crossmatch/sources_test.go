@@ -0,0 +1,135 @@
+// Tests for reading sources from CSV and VOTables
+package crossmatch
+
+import (
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"star-catalog/astro/coords"
+)
+
+// Read every source, or return the first error
+func readAll(reader io.Reader, options Options) ([]Source, error) {
+	sources, err := newSourceReader(reader, options)
+	if err != nil {
+		return nil, err
+	}
+
+	var all []Source
+	for {
+		source, err := sources.Read()
+		if errors.Is(err, io.EOF) {
+			return all, nil
+		}
+		if err != nil {
+			return all, err
+		}
+		all = append(all, source)
+	}
+}
+
+// TestReadSources reads the same sources from CSV, with a comment line and its own column
+// names, and from a VOTable, where ra is a float and the id a long
+func TestReadSources(t *testing.T) {
+	csv := "# detections\n" +
+		"det,ra_deg,dec_deg,mag\n" +
+		"d1,10.5,-20,15.1\n" +
+		"d2,359.999,89.5,\n"
+
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<VOTABLE version="1.4" xmlns="http://www.ivoa.net/xml/VOTable/v1.3"><RESOURCE><TABLE>
+<FIELD name="det" datatype="long"/>
+<FIELD name="ra_deg" datatype="double" unit="deg"/>
+<FIELD name="dec_deg" datatype="float" unit="deg"/>
+<DATA><TABLEDATA>
+<TR><TD>1</TD><TD>10.5</TD><TD>-20</TD></TR>
+<TR><TD>2</TD><TD>359.999</TD><TD>89.5</TD></TR>
+</TABLEDATA></DATA></TABLE></RESOURCE></VOTABLE>`
+
+	options := Options{IdColumn: "det", RaColumn: "ra_deg", DecColumn: "dec_deg"}
+	sources, err := readAll(strings.NewReader(csv), options)
+	want := []Source{{"d1", 10.5, -20}, {"d2", 359.999, 89.5}}
+	if err != nil || len(sources) != 2 || sources[0] != want[0] || sources[1] != want[1] {
+		t.Fatalf(`CSV sources should be %v, are %v, %v`, want, sources, err)
+	}
+
+	options.Format = "votable"
+	sources, err = readAll(strings.NewReader(document), options)
+	want = []Source{{"1", 10.5, -20}, {"2", 359.999, 89.5}}
+	if err != nil || len(sources) != 2 || sources[0] != want[0] || sources[1] != want[1] {
+		t.Fatalf(`VOTable sources should be %v, are %v, %v`, want, sources, err)
+	}
+
+	// Without an id column, sources are numbered
+	options = Options{IdColumn: "id", RaColumn: "ra_deg", DecColumn: "dec_deg"}
+	sources, err = readAll(strings.NewReader(csv), options)
+	if err != nil || len(sources) != 2 || sources[1].Id != "2" {
+		t.Fatalf(`Sources without ids should be numbered, are %v, %v`, sources, err)
+	}
+}
+
+// TestReadSourcesErrors checks that missing columns and bad positions are reported with
+// their row
+func TestReadSourcesErrors(t *testing.T) {
+	options := Options{IdColumn: "id", RaColumn: "ra", DecColumn: "dec"}
+	tests := []struct {
+		csv  string
+		want string
+	}{
+		{"id,dec\n", "no ra column"},
+		{"id,ra\n", "no dec column"},
+		{"id,ra,dec\n1,10,10\n2,,10\n", "row 2: ra is missing"},
+		{"id,ra,dec\n1,10,north\n", `row 1: dec "north" is not a number`},
+		{"id,ra,dec\n1,10,95\n", "row 1: dec 95 is outside -90 to 90"},
+		{"id,ra,dec\n1,-1,0\n", "row 1: ra -1 is outside 0 to 360"},
+	}
+
+	for _, test := range tests {
+		_, err := readAll(strings.NewReader(test.csv), options)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf(`Reading %q should fail with %s, is %v`, test.csv, test.want, err)
+		}
+	}
+
+	options.Format = "fits"
+	if _, err := readAll(strings.NewReader("id,ra,dec\n"), options); err == nil {
+		t.Fatalf(`Reading an unknown format should fail`)
+	}
+}
+
+// TestReadSourcesFrames reads sexagesimal positions, with the RA in hours, and Galactic
+// positions, which are converted to ICRS
+func TestReadSourcesFrames(t *testing.T) {
+	csv := "id,ra,dec\n" +
+		"m87,12:30:49.4,+12:23:28\n" +
+		"m31,00h42m44.3s,+41d16m09s\n"
+	sources, err := readAll(strings.NewReader(csv), Options{IdColumn: "id", RaColumn: "ra", DecColumn: "dec"})
+	if err != nil || len(sources) != 2 {
+		t.Fatalf(`Sexagesimal sources should be read, are %v, %v`, sources, err)
+	}
+	if math.Abs(sources[0].Ra-187.70583) > 1e-5 || math.Abs(sources[0].Dec-12.39111) > 1e-5 {
+		t.Fatalf(`M87 should be at 187.70583 12.39111, is %v`, sources[0])
+	}
+	if math.Abs(sources[1].Ra-10.68458) > 1e-5 || math.Abs(sources[1].Dec-41.26917) > 1e-5 {
+		t.Fatalf(`M31 should be at 10.68458 41.26917, is %v`, sources[1])
+	}
+
+	// The Galactic centre
+	csv = "id,l,b\ngc,0,0\n"
+	options := Options{IdColumn: "id", RaColumn: "l", DecColumn: "b", Frame: coords.Galactic}
+	sources, err = readAll(strings.NewReader(csv), options)
+	if err != nil || len(sources) != 1 || math.Abs(sources[0].Ra-266.40499) > 1e-5 || math.Abs(sources[0].Dec+28.93617) > 1e-5 {
+		t.Fatalf(`The Galactic centre should be at 266.40499 -28.93617, is %v, %v`, sources, err)
+	}
+
+	// A Galactic longitude is never in hours
+	csv = "id,l,b\ngc,12:00:00,0\n"
+	sources, err = readAll(strings.NewReader(csv), options)
+	ra, dec := coords.ToICRS(coords.Galactic, 12, 0)
+	if err != nil || len(sources) != 1 || sources[0].Ra != ra || sources[0].Dec != dec {
+		t.Fatalf(`l 12:00:00 should be 12 degrees, at %v %v, is %v, %v`, ra, dec, sources, err)
+	}
+}
@@ -0,0 +1,79 @@
+// Tests for the crossmatch command
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+)
+
+// TestCrossmatchCommand matches a file of detections against the fixture stars, with its
+// own column names, and checks the CSV output
+func TestCrossmatchCommand(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "detections.csv")
+	detections := "name,ra_icrs,de_icrs\n" +
+		"det1,10.6847,41.2691\n" +
+		"det2,10.6847,41.3\n"
+	if err := os.WriteFile(path, []byte(detections), 0644); err != nil {
+		t.Fatalf(`WriteFile %v`, err)
+	}
+
+	var out bytes.Buffer
+	err := runCrossmatch(context.Background(), []string{"-id", "name", "-ra", "ra_icrs", "-dec", "de_icrs", path}, &out)
+	if err != nil {
+		t.Fatalf(`crossmatch %v`, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || lines[0] != "id,ra,dec,star_id,gaia_catalogue_id,name,separation,matches" {
+		t.Fatalf(`crossmatch should write a header and 2 rows, is %q`, out.String())
+	}
+	if !strings.HasPrefix(lines[1], "det1,10.6847,41.2691,") || !strings.Contains(lines[1], ",gaia_catalogue_id3,Star3,0.36") || !strings.HasSuffix(lines[1], ",1") {
+		t.Fatalf(`det1 should match Star3, is %s`, lines[1])
+	}
+	if lines[2] != "det2,10.6847,41.3,,,,,0" {
+		t.Fatalf(`det2 should match nothing, is %s`, lines[2])
+	}
+
+	if err := runCrossmatch(context.Background(), []string{path}, &out); err == nil || !strings.Contains(err.Error(), "no ra column") {
+		t.Fatalf(`crossmatch should fail without an ra column, is %v`, err)
+	}
+	if err := runCrossmatch(context.Background(), nil, &out); err == nil {
+		t.Fatalf(`crossmatch should fail without a file`)
+	}
+}
+
+// TestCrossmatchCommandFrame matches a detection by its Galactic position, and checks that
+// the output has its ICRS position
+func TestCrossmatchCommandFrame(t *testing.T) {
+	database.InitDB()
+
+	l, b := coords.FromICRS(coords.Galactic, 10.6847, 41.2691)
+	path := filepath.Join(t.TempDir(), "detections.csv")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("id,l,b\ndet1,%v,%v\n", l, b)), 0644); err != nil {
+		t.Fatalf(`WriteFile %v`, err)
+	}
+
+	var out bytes.Buffer
+	err := runCrossmatch(context.Background(), []string{"-frame", "galactic", "-ra", "l", "-dec", "b", path}, &out)
+	if err != nil {
+		t.Fatalf(`crossmatch %v`, err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "det1,10.6847") || !strings.Contains(lines[1], ",Star3,") {
+		t.Fatalf(`det1 should be at RA 10.6847 and match Star3, is %q`, lines)
+	}
+
+	if err := runCrossmatch(context.Background(), []string{"-frame", "supergalactic", path}, &out); err == nil {
+		t.Fatalf(`crossmatch should fail for an unknown frame`)
+	}
+}
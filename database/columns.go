@@ -0,0 +1,121 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Structs read from the database tag each field with its column name, like
+//
+//	type Star struct {
+//		Id   int64  `db:"id"`
+//		Name string `db:"name"`
+//	}
+//
+// Columns and DB.ColumnList give the column names to SELECT, and ScanStruct scans a row of
+// those columns into the matching fields, so adding a column only needs a new tagged field.
+// FieldValues gives the values of the same fields, in the same order, for an INSERT, and
+// DB.InsertRows inserts many such structs at once.
+// Nullable columns should use pointer fields, which are nil for NULL.
+
+// A Scanner is a *sql.Row or *sql.Rows.
+type Scanner interface {
+	Scan(dest ...any) error
+}
+
+// The tagged fields of a struct type, in field order
+type structColumns struct {
+	names   []string
+	indexes []int
+}
+
+// Cache of structColumns by struct type, since the tags never change
+var columnCache sync.Map
+
+// Columns returns the column names tagged on the fields of v, which is a struct or a
+// pointer to a struct, in field order.
+func Columns(v any) []string {
+	return columnsOf(reflect.TypeOf(v)).names
+}
+
+// ColumnList returns the column names tagged on the fields of v, quoted for db's dialect
+// and separated by commas, for use in a SELECT statement.
+func (db *DB) ColumnList(v any) string {
+	return db.QuoteList(Columns(v))
+}
+
+// QuoteList returns the given column names quoted for db's dialect and separated by commas.
+func (db *DB) QuoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = db.Dialect.QuoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// Placeholders returns n ? placeholders separated by commas, for the VALUES of an INSERT.
+func Placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// FieldValues returns the values of the tagged fields of v, which is a struct or a pointer
+// to a struct, in the same order as Columns. A nil pointer field gives NULL.
+func FieldValues(v any) []any {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	columns := columnsOf(value.Type())
+
+	values := make([]any, len(columns.indexes))
+	for i, index := range columns.indexes {
+		values[i] = value.Field(index).Interface()
+	}
+	return values
+}
+
+// ScanStruct scans a row into the tagged fields of dest, which must be a pointer to a struct.
+// The row must have been selected with DB.ColumnList for the same struct type.
+func ScanStruct(row Scanner, dest any) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("ScanStruct: dest must be a pointer to a struct, is %T", dest)
+	}
+
+	return row.Scan(FieldPointers(dest)...)
+}
+
+// FieldPointers returns pointers to the tagged fields of dest, a pointer to a struct, in the
+// same order as Columns. Used to scan rows, and to set fields by column name.
+func FieldPointers(dest any) []any {
+	value := reflect.ValueOf(dest).Elem()
+	columns := columnsOf(value.Type())
+
+	fields := make([]any, len(columns.indexes))
+	for i, index := range columns.indexes {
+		fields[i] = value.Field(index).Addr().Interface()
+	}
+	return fields
+}
+
+// Find the db tags of a struct type, or a pointer to one, caching the result
+func columnsOf(t reflect.Type) structColumns {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if cached, ok := columnCache.Load(t); ok {
+		return cached.(structColumns)
+	}
+
+	var columns structColumns
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := t.Field(i).Tag.Lookup("db")
+		if !ok || name == "-" {
+			continue
+		}
+		columns.names = append(columns.names, name)
+		columns.indexes = append(columns.indexes, i)
+	}
+
+	columnCache.Store(t, columns)
+	return columns
+}
@@ -0,0 +1,78 @@
+// Tests for Columns, ColumnList, FieldValues and ScanStruct
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A struct with a nullable column and an untagged field, for the tests
+type columnsTestRow struct {
+	Id       int64   `db:"id"`
+	Name     string  `db:"name"`
+	Nickname *string `db:"nickname"`
+	Ignored  string
+}
+
+// TestColumns checks that only tagged fields are listed, in field order
+func TestColumns(t *testing.T) {
+	want := []string{"id", "name", "nickname"}
+
+	if got := Columns(columnsTestRow{}); !reflect.DeepEqual(got, want) {
+		t.Fatalf(`Columns should return %v, is %v`, want, got)
+	}
+	if got := Columns(&columnsTestRow{}); !reflect.DeepEqual(got, want) {
+		t.Fatalf(`Columns of a pointer should return %v, is %v`, want, got)
+	}
+
+	mysql_db := &DB{Dialect: MySQL}
+	if got := mysql_db.ColumnList(columnsTestRow{}); got != "`id`, `name`, `nickname`" {
+		t.Fatalf("ColumnList should return `id`, `name`, `nickname`, is %s", got)
+	}
+}
+
+// TestFieldValues checks that the tagged field values are returned in column order
+func TestFieldValues(t *testing.T) {
+	nickname := "Sol"
+	row := columnsTestRow{Id: 1, Name: "Sun", Nickname: &nickname, Ignored: "x"}
+
+	got := FieldValues(row)
+
+	if len(got) != 3 || got[0] != int64(1) || got[1] != "Sun" || got[2] != &nickname {
+		t.Fatalf(`FieldValues should return the tagged values in order, is %v`, got)
+	}
+}
+
+// TestScanStruct scans rows with and without a NULL into a struct
+func TestScanStruct(t *testing.T) {
+	db := openTestSQLite(t)
+
+	var got columnsTestRow
+	row := db.QueryRow("SELECT 1 AS id, 'Sun' AS name, 'Sol' AS nickname")
+	if err := ScanStruct(row, &got); err != nil {
+		t.Fatalf(`ScanStruct %v`, err)
+	}
+	if got.Id != 1 || got.Name != "Sun" || got.Nickname == nil || *got.Nickname != "Sol" {
+		t.Fatalf(`ScanStruct should fill every column, is %+v`, got)
+	}
+
+	got = columnsTestRow{}
+	row = db.QueryRow("SELECT 2 AS id, 'Vega' AS name, NULL AS nickname")
+	if err := ScanStruct(row, &got); err != nil {
+		t.Fatalf(`ScanStruct %v`, err)
+	}
+	if got.Id != 2 || got.Name != "Vega" || got.Nickname != nil {
+		t.Fatalf(`ScanStruct should leave a NULL column nil, is %+v`, got)
+	}
+}
+
+// TestScanStructNotPointer checks that ScanStruct rejects a dest that isn't a pointer to a struct
+func TestScanStructNotPointer(t *testing.T) {
+	db := openTestSQLite(t)
+
+	err := ScanStruct(db.QueryRow("SELECT 1"), columnsTestRow{})
+
+	if err == nil {
+		t.Fatalf(`ScanStruct should reject a struct that isn't a pointer`)
+	}
+}
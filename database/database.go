@@ -1,44 +1,78 @@
-// Package database manages the low level database connection with mysql
-// and provides functions InitDB and ClearDB. The connection is automatically closed as needed.
+// Package database manages the low level database connection with mysql, sqlite or postgres
+// and provides functions ConnectDB, InitDB, ClearDB and SeedFixtures. The connection is automatically closed
+// as needed.
 // Database connection details are read from config.yml in the root directory of the project.
 // When running tests from a subdirectory, it looks for config.yml in the parent directory.
-// The schema is available in schema.sql. Use the mysql utility to read it in. See README.md.
+// If there is no config.yml, an SQLite database in star-catalog.db is used.
+// The schema is created and changed by the versioned migrations in the migrations directory,
+// using MigrateUp and MigrateDown. See README.md.
+// The DB type carries the connection's Dialect, which queries use to rebind their placeholders.
+// ColumnList and ScanStruct map table columns to struct fields by their db tags.
 package database
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"net/url"
 	"strings"
 
+	"star-catalog/healpix"
+
 	"github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" driver
 	"github.com/spf13/viper"
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
 )
 
-// InitDB initializes the database connection and seeds the database with test data.
-func InitDB() *sql.DB {
-	db := connectDB()
+// A GalaxyNotFoundError is returned when adding a star whose galaxy_id doesn't match any galaxy.
+type GalaxyNotFoundError struct {
+	GalaxyId int64
+}
+
+func (e *GalaxyNotFoundError) Error() string {
+	return fmt.Sprintf("galaxy %d not found", e.GalaxyId)
+}
+
+// defaultSQLitePath is the database file used when database.path isn't set.
+// A relative path is relative to the current directory, so each package's tests get their own file.
+const defaultSQLitePath = "star-catalog.db"
+
+// InitDB is for tests. It initializes the database connection, brings the schema up to date,
+// removes all existing data and seeds the database with the test data in fixtures/test.yml.
+// Production code should use ConnectDB, which leaves the data alone.
+func InitDB() *DB {
+	db := ConnectDB()
+	if _, err := MigrateUp(context.Background(), db); err != nil {
+		log.Fatal(err)
+	}
 	ClearDB(db)
-	seedData(db)
+
+	fixtures, err := ReadFixtures(strings.NewReader(testFixtures), "yml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, _, err := SeedFixtures(context.Background(), db, fixtures); err != nil {
+		log.Fatal(err)
+	}
 
 	return db
 }
 
-// Connect to a mysql database via the connection information in config.yml in the root directory
-func connectDB() *sql.DB {
-	findConfigFile()
-
-	cfg := mysql.Config{
-		User:      viper.GetString("database.dbuser"),
-		Passwd:    viper.GetString("database.dbpassword"),
-		Net:       viper.GetString("database.net"),
-		Addr:      viper.GetString("database.addr"),
-		DBName:    viper.GetString("database.dbname"),
-		ParseTime: true,
+// ConnectDB connects to the database described by config.yml in the root directory.
+// database.driver selects "mysql", "sqlite" or "postgres", and defaults to mysql. If there is
+// no config.yml at all, sqlite is used so that tests and local runs don't need a database server.
+func ConnectDB() *DB {
+	driver := "mysql"
+	if !findConfigFile() {
+		driver = "sqlite"
+	}
+	if viper.IsSet("database.driver") {
+		driver = viper.GetString("database.driver")
 	}
 
-	// Get a database handle.
-	db, err := sql.Open("mysql", cfg.FormatDSN())
+	db, err := openDB(driver)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -51,78 +85,167 @@ func connectDB() *sql.DB {
 	return db
 }
 
-// ClearDB removes all data from the database. Used before seeding the database, and also from tests.
-func ClearDB(db *sql.DB) error {
-	_, err := db.Exec("DELETE FROM galaxies")
-	if err != nil {
-		return fmt.Errorf("clearDB: %v", err)
+// HealpixOrder returns the HEALPix order of the stars table's healpix column, which is
+// healpix.order in config.yml, or healpix.DefaultOrder if that isn't set. The config is read
+// by ConnectDB. Changing the order needs the healpix command to index the stars again.
+func HealpixOrder() (int, error) {
+	order := healpix.DefaultOrder
+	if viper.IsSet("healpix.order") {
+		order = viper.GetInt("healpix.order")
+	}
+	if err := healpix.CheckOrder(order); err != nil {
+		return 0, fmt.Errorf("HealpixOrder: %v", err)
+	}
+	return order, nil
+}
+
+// Get a database handle for the given driver, using the connection details in config.yml
+func openDB(driver string) (*DB, error) {
+	var db *sql.DB
+	var err error
+
+	dialect := Dialect(driver)
+	switch dialect {
+	case MySQL:
+		db, err = openMySQL()
+	case SQLite:
+		db, err = openSQLite()
+	case Postgres:
+		db, err = openPostgres()
+	default:
+		return nil, fmt.Errorf("openDB: unknown database.driver %q", driver)
 	}
 
-	_, err = db.Exec("DELETE FROM stars")
 	if err != nil {
-		return fmt.Errorf("clearDB: %v", err)
+		return nil, err
 	}
 
-	return nil
+	return &DB{DB: db, Dialect: dialect}, nil
 }
 
-// Seed the database with test data
-// I looked for exception handling to avoid checking for an error at every step,
-// but apparently Go doesn't have that.
-func seedData(db *sql.DB) error {
-	galaxy_id1, err := addGalaxy(db, "ugc_number1", "Milky Way")
-	if err != nil {
-		return fmt.Errorf("seedData: %v", err)
+// Get a handle to a mysql database
+func openMySQL() (*sql.DB, error) {
+	cfg := mysql.Config{
+		User:      viper.GetString("database.dbuser"),
+		Passwd:    viper.GetString("database.dbpassword"),
+		Net:       viper.GetString("database.net"),
+		Addr:      viper.GetString("database.addr"),
+		DBName:    viper.GetString("database.dbname"),
+		ParseTime: true,
 	}
-	_, err = addStar(db, galaxy_id1, "Sun", "gaia_catalogue_id1")
-	if err != nil {
-		return fmt.Errorf("seedData: %v", err)
+
+	return sql.Open("mysql", cfg.FormatDSN())
+}
+
+// Get a handle to the sqlite database file in database.path, creating the file if it
+// doesn't exist yet
+func openSQLite() (*sql.DB, error) {
+	path := viper.GetString("database.path")
+	if path == "" {
+		path = defaultSQLitePath
 	}
-	_, err = addStar(db, galaxy_id1, "Alpha Centauri", "gaia_catalogue_id2")
+
+	// WAL and busy_timeout let the pipeline's goroutines read while another connection writes
+	dsn := "file:" + path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
-		return fmt.Errorf("seedData: %v", err)
+		return nil, fmt.Errorf("openSQLite: %v", err)
 	}
 
-	galaxy_id2, err := addGalaxy(db, "ugc_number2", "Andromeda")
-	if err != nil {
-		return fmt.Errorf("seedData: %v", err)
+	return db, nil
+}
+
+// Get a handle to the postgres database described by database.dbname, dbuser, dbpassword
+// and addr. database.sslmode defaults to disable.
+func openPostgres() (*sql.DB, error) {
+	sslmode := viper.GetString("database.sslmode")
+	if sslmode == "" {
+		sslmode = "disable"
 	}
-	_, err = addStar(db, galaxy_id2, "Star3", "gaia_catalogue_id3")
-	if err != nil {
-		return fmt.Errorf("seedData: %v", err)
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(viper.GetString("database.dbuser"), viper.GetString("database.dbpassword")),
+		Host:     viper.GetString("database.addr"),
+		Path:     viper.GetString("database.dbname"),
+		RawQuery: url.Values{"sslmode": {sslmode}}.Encode(),
 	}
-	_, err = addStar(db, galaxy_id2, "Star4", "gaia_catalogue_id4")
+
+	db, err := sql.Open("pgx", dsn.String())
 	if err != nil {
-		return fmt.Errorf("seedData: %v", err)
+		return nil, fmt.Errorf("openPostgres: %v", err)
 	}
-	_, err = addStar(db, galaxy_id2, "Star5", "gaia_catalogue_id5")
+
+	return db, nil
+}
+
+// ClearDB removes all data from the database in one transaction. Used from tests; the seed
+// command uses ClearDBTx.
+// Derived values are deleted before the stars they refer to, and stars and galaxy
+// statistics before their galaxies.
+func ClearDB(db *DB) error {
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("seedData: %v", err)
+		return fmt.Errorf("clearDB: %v", err)
 	}
+	defer tx.Rollback()
 
+	if err := ClearDBTx(ctx, tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("clearDB: %v", err)
+	}
 	return nil
 }
 
-// Add a Galaxy with the given details to the galaxies table
-func addGalaxy(db *sql.DB, ugc_number string, name string) (int64, error) {
-	result, err := db.Exec("INSERT INTO galaxies (ugc_number, name) VALUES (?, ?)", ugc_number, name)
-	if err != nil {
-		return 0, fmt.Errorf("addGalaxy: %v", err)
+// ClearDBTx is ClearDB inside tx, so the seed command can clear the database and seed it in
+// one transaction. tx is left for the caller to commit or roll back.
+func ClearDBTx(ctx context.Context, tx *sql.Tx) error {
+	for _, table := range []string{"star_derived", "galaxy_stats", "stars", "galaxies"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return fmt.Errorf("clearDB: %v", err)
+		}
 	}
-	id, err := result.LastInsertId()
+	return nil
+}
+
+// Add a Galaxy with the given details to the galaxies table. Its stars aren't added.
+func addGalaxy(ctx context.Context, db *DB, tx *sql.Tx, galaxy FixtureGalaxy) (int64, error) {
+	columns := Columns(galaxy)
+
+	query := "INSERT INTO galaxies (" + db.QuoteList(columns) + ") VALUES (" + Placeholders(len(columns)) + ")"
+	id, err := db.InsertReturningIdTx(ctx, tx, query, FieldValues(galaxy)...)
 	if err != nil {
 		return 0, fmt.Errorf("addGalaxy: %v", err)
 	}
 	return id, nil
 }
 
-// Add a Star with the given details to the stars table
-func addStar(db *sql.DB, galaxy_id int64, name string, gaia_catalogue_id string) (int64, error) {
-	result, err := db.Exec("INSERT INTO stars (galaxy_id, name, gaia_catalogue_id) VALUES (?, ?, ?)", galaxy_id, name, gaia_catalogue_id)
-	if err != nil {
-		return 0, fmt.Errorf("addStar: %v", err)
+// Add a Star with the given details to the stars table, in the galaxy with the given galaxy_id.
+// Stars with a position get its HEALPix pixel too.
+// Returns a *GalaxyNotFoundError if there is no such galaxy.
+func addStar(ctx context.Context, db *DB, tx *sql.Tx, galaxy_id int64, star FixtureStar) (int64, error) {
+	columns := append([]string{"galaxy_id"}, Columns(star)...)
+	values := append([]any{galaxy_id}, FieldValues(star)...)
+
+	if star.Ra != nil && star.Dec != nil {
+		order, err := HealpixOrder()
+		if err != nil {
+			return 0, fmt.Errorf("addStar: %v", err)
+		}
+		columns = append(columns, "healpix")
+		values = append(values, healpix.Pixel(order, *star.Ra, *star.Dec))
+	}
+
+	query := "INSERT INTO stars (" + db.QuoteList(columns) + ") VALUES (" + Placeholders(len(columns)) + ")"
+	id, err := db.InsertReturningIdTx(ctx, tx, query, values...)
+	if isForeignKeyViolation(err) {
+		return 0, fmt.Errorf("addStar: %w", &GalaxyNotFoundError{GalaxyId: galaxy_id})
 	}
-	id, err := result.LastInsertId()
 	if err != nil {
 		return 0, fmt.Errorf("addStar: %v", err)
 	}
@@ -131,9 +254,9 @@ func addStar(db *sql.DB, galaxy_id int64, name string, gaia_catalogue_id string)
 
 // Find config file from tests in a subdirectory, but don't look in the parent directory from main.
 // That is: Look in ./ first, and only look in ../ if it's not found. More loop iterations can be
-// added for deeper directory structures.
+// added for deeper directory structures. Reports whether a config file was found.
 // Taken from https://stackoverflow.com/questions/66683505/handling-viper-config-file-path-during-go-tests
-func findConfigFile() {
+func findConfigFile() bool {
 	var err error
 	path := "./"
 	for i := 0; i < 2; i++ { // Increase iterations for deeper directory structure
@@ -148,7 +271,8 @@ func findConfigFile() {
 			}
 			panic("panic in config parser : " + err.Error())
 		} else {
-			break
+			return true
 		}
 	}
+	return false
 }
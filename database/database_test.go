@@ -1,8 +1,15 @@
-// Tests for InitDB and ClearDB
+// Tests for InitDB, ClearDB, addStar and openDB
 package database
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"testing"
+
+	"star-catalog/healpix"
+
+	"github.com/spf13/viper"
 )
 
 // TestInitDB calls database.InitDB and checks that the database
@@ -45,3 +52,115 @@ func TestClearDB(t *testing.T) {
 		t.Fatalf(`Star rows should be %d, is %d, %v`, want, got, err)
 	}
 }
+
+// TestAddStarMissingGalaxy adds a star for a galaxy that doesn't exist and checks that
+// a GalaxyNotFoundError is returned
+func TestAddStarMissingGalaxy(t *testing.T) {
+	db := InitDB()
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = addStar(context.Background(), db, tx, 999999, FixtureStar{Name: "Lost", GaiaCatalogueId: "gaia_lost"})
+
+	var not_found *GalaxyNotFoundError
+	if !errors.As(err, &not_found) || not_found.GalaxyId != 999999 {
+		t.Fatalf(`addStar should return a GalaxyNotFoundError for galaxy 999999, is %v`, err)
+	}
+}
+
+// TestAddStarDuplicateGaiaId adds a star with a gaia_catalogue_id that is already used
+// and checks that it is rejected
+func TestAddStarDuplicateGaiaId(t *testing.T) {
+	db := InitDB()
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	galaxy_id, err := findGalaxyId(context.Background(), db, tx, "ugc_number1")
+	if err != nil {
+		t.Fatalf(`findGalaxyId %v`, err)
+	}
+
+	_, err = addStar(context.Background(), db, tx, galaxy_id, FixtureStar{Name: "Sun again", GaiaCatalogueId: "gaia_catalogue_id1"})
+
+	if err == nil || !strings.HasPrefix(err.Error(), "addStar:") {
+		t.Fatalf(`addStar should reject a duplicate gaia_catalogue_id, is %v`, err)
+	}
+}
+
+// TestAddStarHealpix checks that fixture stars with a position get its HEALPix pixel at the
+// configured order, and those without one don't, and that a bad healpix.order is refused
+func TestAddStarHealpix(t *testing.T) {
+	db := InitDB()
+
+	var pixel *int64
+	err := db.QueryRow("SELECT healpix FROM stars WHERE name = 'Star3'").Scan(&pixel)
+	if want := healpix.Pixel(healpix.DefaultOrder, 10.6847, 41.2690); err != nil || pixel == nil || *pixel != want {
+		t.Fatalf(`Star3 should be in HEALPix pixel %d, is %v, %v`, want, pixel, err)
+	}
+
+	err = db.QueryRow("SELECT healpix FROM stars WHERE name = 'Sun'").Scan(&pixel)
+	if err != nil || pixel != nil {
+		t.Fatalf(`The Sun has no position and should have no HEALPix pixel, is %v, %v`, pixel, err)
+	}
+
+	viper.Set("healpix.order", 30)
+	defer viper.Set("healpix.order", nil)
+	if _, err := HealpixOrder(); err == nil {
+		t.Fatalf(`HealpixOrder should refuse order 30`)
+	}
+}
+
+// TestClearDBForeignKeys checks that ClearDB works with the stars foreign key in place,
+// and that deleting a galaxy that still has stars is refused
+func TestClearDBForeignKeys(t *testing.T) {
+	db := InitDB()
+
+	if _, err := db.Exec("DELETE FROM galaxies"); err == nil {
+		t.Fatalf(`Deleting galaxies with stars should fail`)
+	}
+
+	if err := ClearDB(db); err != nil {
+		t.Fatalf(`ClearDB %v`, err)
+	}
+}
+
+// TestOpenDBUnknownDriver calls openDB with a driver that isn't supported and checks
+// that it returns an error
+func TestOpenDBUnknownDriver(t *testing.T) {
+	want := `openDB: unknown database.driver "oracle"`
+
+	_, err := openDB("oracle")
+
+	if err == nil || err.Error() != want {
+		t.Fatalf(`openDB expected error %v, got %v`, want, err)
+	}
+}
+
+// TestOpenSQLite opens an sqlite database in a temporary directory, migrates it,
+// and checks that the tables are created
+func TestOpenSQLite(t *testing.T) {
+	db := openTestSQLite(t)
+
+	if _, err := MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf(`MigrateUp %v`, err)
+	}
+
+	var got int
+	want := 0
+
+	err := db.QueryRow("SELECT COUNT(*) FROM galaxies").Scan(&got)
+	if got != want || err != nil {
+		t.Fatalf(`Galaxy rows should be %d, is %d, %v`, want, got, err)
+	}
+
+	err = db.QueryRow("SELECT COUNT(*) FROM stars").Scan(&got)
+	if got != want || err != nil {
+		t.Fatalf(`Star rows should be %d, is %d, %v`, want, got, err)
+	}
+}
@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// A Dialect is the flavour of SQL spoken by a database driver.
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// DB is a database handle that knows which Dialect it speaks.
+// Queries are written with ? placeholders and passed through Rebind.
+type DB struct {
+	*sql.DB
+	Dialect Dialect
+}
+
+// Rebind converts the ? placeholders in query to the form used by the dialect.
+// Postgres uses $1, $2, ...; mysql and sqlite are left as they are.
+// Question marks inside single-quoted strings are not placeholders.
+func (dialect Dialect) Rebind(query string) string {
+	if dialect != Postgres {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	quoted := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+		case r == '?' && !quoted:
+			n++
+			builder.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// QuoteIdentifier quotes a table or column name for the dialect, so that names such as
+// dec, which mysql reserves, can be used.
+func (dialect Dialect) QuoteIdentifier(name string) string {
+	if dialect == MySQL {
+		return "`" + name + "`"
+	}
+	return `"` + name + `"`
+}
+
+// Rebind converts the ? placeholders in query to the form used by db's dialect.
+func (db *DB) Rebind(query string) string {
+	return db.Dialect.Rebind(query)
+}
+
+// InsertReturningId runs an INSERT statement written with ? placeholders, and returns the
+// id of the new row. Postgres doesn't support LastInsertId, so RETURNING id is used there.
+func (db *DB) InsertReturningId(ctx context.Context, query string, args ...any) (int64, error) {
+	return db.insertReturningId(ctx, db.DB, query, args...)
+}
+
+// InsertReturningIdTx is InsertReturningId inside tx. tx is left for the caller to commit or
+// roll back.
+func (db *DB) InsertReturningIdTx(ctx context.Context, tx *sql.Tx, query string, args ...any) (int64, error) {
+	return db.insertReturningId(ctx, tx, query, args...)
+}
+
+// execQueryer is what InsertReturningId needs of a *sql.DB or *sql.Tx
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Run an INSERT statement on conn and return the id of the new row
+func (db *DB) insertReturningId(ctx context.Context, conn execQueryer, query string, args ...any) (int64, error) {
+	query = db.Rebind(query)
+
+	if db.Dialect == Postgres {
+		var id int64
+		err := conn.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// maxPlaceholders is the most ? placeholders InsertRows puts in one statement.
+// sqlite allows 32766 by default, and mysql and postgres 65535.
+const maxPlaceholders = 32766
+
+// InsertRows inserts rows into table with multi-row INSERT statements, in one transaction so
+// that either every row is added or none are. Each row is a struct, or pointer to a struct,
+// with db tags as for FieldValues, and every row must be of the same type. Large batches are
+// split into several statements to stay within the drivers' limits on placeholders.
+func (db *DB) InsertRows(ctx context.Context, table string, rows []any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := db.InsertRowsTx(ctx, tx, table, rows); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// InsertRowsTx is InsertRows inside tx, for callers that change other rows in the same
+// transaction. tx is left for the caller to commit or roll back.
+func (db *DB) InsertRowsTx(ctx context.Context, tx *sql.Tx, table string, rows []any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	columns := Columns(rows[0])
+	per_statement := maxPlaceholders / len(columns)
+	row_placeholders := "(" + Placeholders(len(columns)) + ")"
+
+	for start := 0; start < len(rows); start += per_statement {
+		end := min(start+per_statement, len(rows))
+
+		var builder strings.Builder
+		builder.WriteString("INSERT INTO " + table + " (" + db.QuoteList(columns) + ") VALUES ")
+		args := make([]any, 0, (end-start)*len(columns))
+		for i, row := range rows[start:end] {
+			if i > 0 {
+				builder.WriteString(", ")
+			}
+			builder.WriteString(row_placeholders)
+			args = append(args, FieldValues(row)...)
+		}
+
+		if _, err := tx.ExecContext(ctx, db.Rebind(builder.String()), args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// IsConstraintViolation reports whether err is a driver error for a row that breaks one of
+// the table's constraints: a foreign key, unique or NOT NULL constraint. Such errors are
+// about the row, rather than the connection or the statement.
+func IsConstraintViolation(err error) bool {
+	var mysql_err *mysql.MySQLError
+	var sqlite_err *sqlite.Error
+	var pg_err *pgconn.PgError
+
+	switch {
+	case errors.As(err, &mysql_err):
+		switch mysql_err.Number {
+		case 1048, 1062, 1452: // ER_BAD_NULL_ERROR, ER_DUP_ENTRY, ER_NO_REFERENCED_ROW_2
+			return true
+		}
+	case errors.As(err, &sqlite_err):
+		// The primary result code is in the low byte of an extended code
+		return sqlite_err.Code()&0xff == sqlite3.SQLITE_CONSTRAINT
+	case errors.As(err, &pg_err):
+		// Class 23 is integrity_constraint_violation
+		return strings.HasPrefix(pg_err.Code, "23")
+	}
+
+	return false
+}
+
+// isForeignKeyViolation reports whether err is a driver error for a row that refers to a
+// missing row in another table.
+func isForeignKeyViolation(err error) bool {
+	var mysql_err *mysql.MySQLError
+	var sqlite_err *sqlite.Error
+	var pg_err *pgconn.PgError
+
+	switch {
+	case errors.As(err, &mysql_err):
+		return mysql_err.Number == 1452 // ER_NO_REFERENCED_ROW_2
+	case errors.As(err, &sqlite_err):
+		return sqlite_err.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+	case errors.As(err, &pg_err):
+		return pg_err.Code == "23503" // foreign_key_violation
+	}
+
+	return false
+}
@@ -0,0 +1,83 @@
+// Tests for Dialect.Rebind, DB.InsertRows and IsConstraintViolation
+package database
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+// TestRebindPostgres checks that ? placeholders become $1, $2, ... for postgres,
+// leaving question marks in quoted strings alone
+func TestRebindPostgres(t *testing.T) {
+	query := "INSERT INTO stars (galaxy_id, name) VALUES (?, ?) -- 'why?'"
+	want := "INSERT INTO stars (galaxy_id, name) VALUES ($1, $2) -- 'why?'"
+
+	got := Postgres.Rebind(query)
+
+	if got != want {
+		t.Fatalf(`Rebind should return %s, is %s`, want, got)
+	}
+}
+
+// TestRebindUnchanged checks that mysql and sqlite queries are left as they are
+func TestRebindUnchanged(t *testing.T) {
+	query := "SELECT * FROM galaxies WHERE ugc_number = ?"
+
+	for _, dialect := range []Dialect{MySQL, SQLite} {
+		if got := dialect.Rebind(query); got != query {
+			t.Fatalf(`%s Rebind should return %s, is %s`, dialect, query, got)
+		}
+	}
+}
+
+// A testStar is a row of the stars table for TestInsertRows
+type testStar struct {
+	GalaxyId        int64  `db:"galaxy_id"`
+	Name            string `db:"name"`
+	GaiaCatalogueId string `db:"gaia_catalogue_id"`
+}
+
+// TestInsertRows inserts more rows than fit in one statement, then checks that a batch with
+// a duplicate is rolled back entirely and reported as a constraint violation
+func TestInsertRows(t *testing.T) {
+	ctx := context.Background()
+	db := openTestSQLite(t)
+	if _, err := MigrateUp(ctx, db); err != nil {
+		t.Fatalf(`MigrateUp %v`, err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	galaxy_id, err := addGalaxy(ctx, db, tx, FixtureGalaxy{UgcNumber: "ugc_number1", Name: "Milky Way"})
+	if err != nil {
+		t.Fatalf(`addGalaxy %v`, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	num_rows := maxPlaceholders/3 + 10
+	rows := make([]any, num_rows)
+	for i := range rows {
+		rows[i] = testStar{GalaxyId: galaxy_id, Name: "Star", GaiaCatalogueId: strconv.Itoa(i)}
+	}
+	if err := db.InsertRows(ctx, "stars", rows); err != nil {
+		t.Fatalf(`InsertRows %v`, err)
+	}
+
+	duplicate := []any{
+		testStar{GalaxyId: galaxy_id, Name: "New", GaiaCatalogueId: "new"},
+		testStar{GalaxyId: galaxy_id, Name: "Duplicate", GaiaCatalogueId: "0"},
+	}
+	if err := db.InsertRows(ctx, "stars", duplicate); !IsConstraintViolation(err) {
+		t.Fatalf(`InsertRows should fail with a constraint violation, is %v`, err)
+	}
+
+	var got int
+	err = db.QueryRow("SELECT COUNT(*) FROM stars").Scan(&got)
+	if got != num_rows || err != nil {
+		t.Fatalf(`Star rows should be %d, is %d, %v`, num_rows, got, err)
+	}
+}
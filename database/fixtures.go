@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"star-catalog/astro"
+)
+
+// testFixtures is the data loaded by InitDB for tests.
+//
+//go:embed fixtures/test.yml
+var testFixtures string
+
+// Fixtures are galaxies and their stars to be loaded into the database by SeedFixtures.
+type Fixtures struct {
+	Galaxies []FixtureGalaxy `yaml:"galaxies" json:"galaxies"`
+}
+
+// A FixtureGalaxy is a galaxy and the stars that belong to it. The physical properties are
+// optional; redshift and distance are derived from heliocentric_velocity if they're missing.
+// The db tags name the galaxies table column for each field, and are used by addGalaxy.
+type FixtureGalaxy struct {
+	UgcNumber string        `yaml:"ugc_number" json:"ugc_number" db:"ugc_number"`
+	Name      string        `yaml:"name" json:"name" db:"name"`
+	Stars     []FixtureStar `yaml:"stars" json:"stars"`
+
+	Ra                   *float64 `yaml:"ra" json:"ra" db:"ra"`
+	Dec                  *float64 `yaml:"dec" json:"dec" db:"dec"`
+	MorphologicalType    *string  `yaml:"morphological_type" json:"morphological_type" db:"morphological_type"`
+	MajorDiameter        *float64 `yaml:"major_diameter" json:"major_diameter" db:"major_diameter"`
+	MinorDiameter        *float64 `yaml:"minor_diameter" json:"minor_diameter" db:"minor_diameter"`
+	PositionAngle        *float64 `yaml:"position_angle" json:"position_angle" db:"position_angle"`
+	BlueMagnitude        *float64 `yaml:"blue_magnitude" json:"blue_magnitude" db:"blue_magnitude"`
+	HeliocentricVelocity *float64 `yaml:"heliocentric_velocity" json:"heliocentric_velocity" db:"heliocentric_velocity"`
+	Redshift             *float64 `yaml:"redshift" json:"redshift" db:"redshift"`
+	Distance             *float64 `yaml:"distance" json:"distance" db:"distance"`
+}
+
+// Fill in Redshift and Distance from HeliocentricVelocity, where they weren't given.
+// Distance is left nil for galaxies that are approaching, which Hubble's law can't place.
+func (galaxy *FixtureGalaxy) derive() {
+	if galaxy.HeliocentricVelocity == nil {
+		return
+	}
+	velocity := *galaxy.HeliocentricVelocity
+
+	if galaxy.Redshift == nil {
+		redshift := astro.Redshift(velocity)
+		galaxy.Redshift = &redshift
+	}
+	if galaxy.Distance == nil {
+		if distance, ok := astro.HubbleDistance(velocity); ok {
+			galaxy.Distance = &distance
+		}
+	}
+}
+
+// A FixtureStar is a star in a FixtureGalaxy. The astrometry fields are optional.
+// The db tags name the stars table column for each field, and are used by addStar.
+type FixtureStar struct {
+	Name            string `yaml:"name" json:"name" db:"name"`
+	GaiaCatalogueId string `yaml:"gaia_catalogue_id" json:"gaia_catalogue_id" db:"gaia_catalogue_id"`
+
+	Ra             *float64 `yaml:"ra" json:"ra" db:"ra"`
+	Dec            *float64 `yaml:"dec" json:"dec" db:"dec"`
+	Parallax       *float64 `yaml:"parallax" json:"parallax" db:"parallax"`
+	ParallaxError  *float64 `yaml:"parallax_error" json:"parallax_error" db:"parallax_error"`
+	Pmra           *float64 `yaml:"pmra" json:"pmra" db:"pmra"`
+	Pmdec          *float64 `yaml:"pmdec" json:"pmdec" db:"pmdec"`
+	RadialVelocity *float64 `yaml:"radial_velocity" json:"radial_velocity" db:"radial_velocity"`
+	PhotGMeanMag   *float64 `yaml:"phot_g_mean_mag" json:"phot_g_mean_mag" db:"phot_g_mean_mag"`
+	PhotBpMeanMag  *float64 `yaml:"phot_bp_mean_mag" json:"phot_bp_mean_mag" db:"phot_bp_mean_mag"`
+	PhotRpMeanMag  *float64 `yaml:"phot_rp_mean_mag" json:"phot_rp_mean_mag" db:"phot_rp_mean_mag"`
+}
+
+// fixtureCSVHeader is the header line a CSV fixture file must start with.
+// Each row is one star; a row with an empty star_name adds a galaxy with no stars.
+// Galaxy properties can't be given in CSV; use YAML or JSON for those.
+// The header can go on to name any of the astrometry columns of FixtureStar, in any order.
+var fixtureCSVHeader = []string{"ugc_number", "galaxy_name", "star_name", "gaia_catalogue_id"}
+
+// LoadFixtures reads fixtures from a .yml, .yaml, .json or .csv file, chosen by its extension.
+func LoadFixtures(path string) (Fixtures, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("LoadFixtures: %v", err)
+	}
+	defer file.Close()
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	fixtures, err := ReadFixtures(file, format)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("LoadFixtures %s: %v", path, err)
+	}
+
+	return fixtures, nil
+}
+
+// ReadFixtures reads fixtures in the given format: "yml", "yaml", "json" or "csv".
+func ReadFixtures(reader io.Reader, format string) (Fixtures, error) {
+	var fixtures Fixtures
+
+	switch format {
+	case "yml", "yaml":
+		if err := yaml.NewDecoder(reader).Decode(&fixtures); err != nil && !errors.Is(err, io.EOF) {
+			return fixtures, err
+		}
+	case "json":
+		if err := json.NewDecoder(reader).Decode(&fixtures); err != nil {
+			return fixtures, err
+		}
+	case "csv":
+		return readCSVFixtures(reader)
+	default:
+		return fixtures, fmt.Errorf("unknown fixture format %q", format)
+	}
+
+	return fixtures, nil
+}
+
+// Read CSV fixtures, with one row per star. Rows with the same ugc_number belong to the
+// same galaxy, whether or not they are next to each other.
+func readCSVFixtures(reader io.Reader) (Fixtures, error) {
+	var fixtures Fixtures
+
+	csv_reader := csv.NewReader(reader)
+
+	header, err := csv_reader.Read()
+	if err != nil {
+		return fixtures, err
+	}
+	if len(header) < len(fixtureCSVHeader) || strings.Join(header[:len(fixtureCSVHeader)], ",") != strings.Join(fixtureCSVHeader, ",") {
+		return fixtures, fmt.Errorf("CSV header should start with %s", strings.Join(fixtureCSVHeader, ","))
+	}
+
+	// Find the FixtureStar field for each of the optional columns
+	astrometry := map[string]int{}
+	for i, column := range Columns(FixtureStar{}) {
+		astrometry[column] = i
+	}
+	extra_fields := make([]int, len(header)-len(fixtureCSVHeader))
+	for i, column := range header[len(fixtureCSVHeader):] {
+		field, ok := astrometry[column]
+		if !ok || column == "name" || column == "gaia_catalogue_id" {
+			return fixtures, fmt.Errorf("unknown CSV column %s", column)
+		}
+		extra_fields[i] = field
+	}
+
+	galaxy_index := map[string]int{}
+	for {
+		record, err := csv_reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fixtures, err
+		}
+
+		ugc_number, galaxy_name, star_name, gaia_catalogue_id := record[0], record[1], record[2], record[3]
+
+		i, ok := galaxy_index[ugc_number]
+		if !ok {
+			i = len(fixtures.Galaxies)
+			galaxy_index[ugc_number] = i
+			fixtures.Galaxies = append(fixtures.Galaxies, FixtureGalaxy{UgcNumber: ugc_number, Name: galaxy_name})
+		}
+
+		if star_name == "" {
+			continue
+		}
+
+		star := FixtureStar{Name: star_name, GaiaCatalogueId: gaia_catalogue_id}
+		fields := FieldPointers(&star)
+		for j, text := range record[len(fixtureCSVHeader):] {
+			// Empty cells are left nil
+			if text == "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return fixtures, fmt.Errorf("%s: %v", header[len(fixtureCSVHeader)+j], err)
+			}
+			*(fields[extra_fields[j]].(**float64)) = &value
+		}
+		fixtures.Galaxies[i].Stars = append(fixtures.Galaxies[i].Stars, star)
+	}
+
+	return fixtures, nil
+}
+
+// SeedFixtures adds the galaxies and stars in fixtures to the database, in one transaction so
+// that a failure leaves nothing added. A galaxy whose ugc_number is already in the galaxies
+// table is reused rather than added again, and a star whose gaia_catalogue_id is already in
+// the stars table is skipped, so fixtures can be loaded on top of existing data, or loaded
+// again. It returns the number of galaxies and stars added.
+func SeedFixtures(ctx context.Context, db *DB, fixtures Fixtures) (int, int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("SeedFixtures: %v", err)
+	}
+	defer tx.Rollback()
+
+	num_galaxies, num_stars, err := SeedFixturesTx(ctx, db, tx, fixtures)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("SeedFixtures: %v", err)
+	}
+	return num_galaxies, num_stars, nil
+}
+
+// SeedFixturesTx is SeedFixtures inside tx, for loading several sets of fixtures, and
+// clearing the database first, all or nothing. tx is left for the caller to commit or roll
+// back.
+func SeedFixturesTx(ctx context.Context, db *DB, tx *sql.Tx, fixtures Fixtures) (int, int, error) {
+	var num_galaxies, num_stars int
+
+	for _, galaxy := range fixtures.Galaxies {
+		galaxy_id, err := findGalaxyId(ctx, db, tx, galaxy.UgcNumber)
+		if errors.Is(err, sql.ErrNoRows) {
+			galaxy.derive()
+			galaxy_id, err = addGalaxy(ctx, db, tx, galaxy)
+			if err == nil {
+				num_galaxies++
+			}
+		}
+		if err != nil {
+			return num_galaxies, num_stars, fmt.Errorf("SeedFixtures: %v", err)
+		}
+
+		for _, star := range galaxy.Stars {
+			exists, err := starExists(ctx, db, tx, star.GaiaCatalogueId)
+			if err != nil {
+				return num_galaxies, num_stars, fmt.Errorf("SeedFixtures: %v", err)
+			}
+			if exists {
+				continue
+			}
+			if _, err := addStar(ctx, db, tx, galaxy_id, star); err != nil {
+				return num_galaxies, num_stars, fmt.Errorf("SeedFixtures: %w", err)
+			}
+			num_stars++
+		}
+	}
+
+	return num_galaxies, num_stars, nil
+}
+
+// Report whether there is a star with the given gaia_catalogue_id
+func starExists(ctx context.Context, db *DB, tx *sql.Tx, gaia_catalogue_id string) (bool, error) {
+	var count int
+	err := tx.QueryRowContext(ctx, db.Rebind("SELECT COUNT(*) FROM stars WHERE gaia_catalogue_id = ?"), gaia_catalogue_id).Scan(&count)
+	return count > 0, err
+}
+
+// Find the id of the galaxy with the given ugc_number, returning sql.ErrNoRows if there isn't one
+func findGalaxyId(ctx context.Context, db *DB, tx *sql.Tx, ugc_number string) (int64, error) {
+	var id int64
+	err := tx.QueryRowContext(ctx, db.Rebind("SELECT id FROM galaxies WHERE ugc_number = ?"), ugc_number).Scan(&id)
+	return id, err
+}
@@ -0,0 +1,160 @@
+// Tests for ReadFixtures and SeedFixtures
+package database
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestReadFixturesFormats reads the same fixtures as YAML, JSON and CSV and checks
+// that they all give the same result
+func TestReadFixturesFormats(t *testing.T) {
+	want := Fixtures{Galaxies: []FixtureGalaxy{
+		{UgcNumber: "ugc_number1", Name: "Milky Way", Stars: []FixtureStar{
+			{Name: "Sun", GaiaCatalogueId: "gaia_catalogue_id1"},
+			{Name: "Alpha Centauri", GaiaCatalogueId: "gaia_catalogue_id2"},
+		}},
+		{UgcNumber: "ugc_number3", Name: "Empty"},
+	}}
+
+	inputs := map[string]string{
+		"yml": `
+galaxies:
+  - ugc_number: ugc_number1
+    name: Milky Way
+    stars:
+      - {name: Sun, gaia_catalogue_id: gaia_catalogue_id1}
+      - {name: Alpha Centauri, gaia_catalogue_id: gaia_catalogue_id2}
+  - ugc_number: ugc_number3
+    name: Empty
+`,
+		"json": `{"galaxies": [
+			{"ugc_number": "ugc_number1", "name": "Milky Way", "stars": [
+				{"name": "Sun", "gaia_catalogue_id": "gaia_catalogue_id1"},
+				{"name": "Alpha Centauri", "gaia_catalogue_id": "gaia_catalogue_id2"}]},
+			{"ugc_number": "ugc_number3", "name": "Empty"}]}`,
+		"csv": "ugc_number,galaxy_name,star_name,gaia_catalogue_id\n" +
+			"ugc_number1,Milky Way,Sun,gaia_catalogue_id1\n" +
+			"ugc_number3,Empty,,\n" +
+			"ugc_number1,Milky Way,Alpha Centauri,gaia_catalogue_id2\n",
+	}
+
+	for format, input := range inputs {
+		got, err := ReadFixtures(strings.NewReader(input), format)
+		if err != nil {
+			t.Fatalf(`ReadFixtures %s %v`, format, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf(`ReadFixtures %s should return %+v, is %+v`, format, want, got)
+		}
+	}
+}
+
+// TestReadFixturesCSVAstrometry reads a CSV file with some of the astrometry columns,
+// and checks that empty cells are left nil
+func TestReadFixturesCSVAstrometry(t *testing.T) {
+	csv := "ugc_number,galaxy_name,star_name,gaia_catalogue_id,parallax,ra\n" +
+		"ugc_number1,Milky Way,Alpha Centauri,gaia_catalogue_id2,750.81,219.90085\n" +
+		"ugc_number1,Milky Way,Sun,gaia_catalogue_id1,,\n"
+
+	got, err := ReadFixtures(strings.NewReader(csv), "csv")
+	if err != nil {
+		t.Fatalf(`ReadFixtures %v`, err)
+	}
+
+	stars := got.Galaxies[0].Stars
+	if stars[0].Parallax == nil || *stars[0].Parallax != 750.81 || stars[0].Ra == nil || *stars[0].Ra != 219.90085 {
+		t.Fatalf(`Alpha Centauri should have parallax and ra, is %+v`, stars[0])
+	}
+	if stars[0].Dec != nil || stars[1].Parallax != nil || stars[1].Ra != nil {
+		t.Fatalf(`Missing columns and empty cells should be nil, are %+v and %+v`, stars[0], stars[1])
+	}
+}
+
+// TestReadFixturesBadCSVColumn checks that a CSV file with an unknown extra column is rejected
+func TestReadFixturesBadCSVColumn(t *testing.T) {
+	_, err := ReadFixtures(strings.NewReader("ugc_number,galaxy_name,star_name,gaia_catalogue_id,colour\n"), "csv")
+
+	if err == nil || err.Error() != "unknown CSV column colour" {
+		t.Fatalf(`ReadFixtures should reject the colour column, is %v`, err)
+	}
+}
+
+// TestReadFixturesBadCSVHeader checks that a CSV file with the wrong columns is rejected
+func TestReadFixturesBadCSVHeader(t *testing.T) {
+	_, err := ReadFixtures(strings.NewReader("name,galaxy,star,gaia\n"), "csv")
+
+	if err == nil || !strings.Contains(err.Error(), "CSV header should start with") {
+		t.Fatalf(`ReadFixtures should reject the header, is %v`, err)
+	}
+}
+
+// TestSeedFixturesReusesGalaxy seeds a star into an existing galaxy and checks that
+// the galaxy isn't added again
+func TestSeedFixturesReusesGalaxy(t *testing.T) {
+	db := InitDB()
+
+	fixtures := Fixtures{Galaxies: []FixtureGalaxy{
+		{UgcNumber: "ugc_number1", Name: "Milky Way", Stars: []FixtureStar{{Name: "Vega", GaiaCatalogueId: "gaia_vega"}}},
+	}}
+
+	num_galaxies, num_stars, err := SeedFixtures(context.Background(), db, fixtures)
+	if num_galaxies != 0 || num_stars != 1 || err != nil {
+		t.Fatalf(`SeedFixtures should add 0 galaxies and 1 star, added %d and %d, %v`, num_galaxies, num_stars, err)
+	}
+
+	var got int
+	err = db.QueryRow("SELECT COUNT(*) FROM galaxies").Scan(&got)
+	if got != 2 || err != nil {
+		t.Fatalf(`Galaxy rows should be %d, is %d, %v`, 2, got, err)
+	}
+}
+
+// TestSeedFixturesTwice seeds the same fixtures twice, and checks that the second time adds
+// nothing
+func TestSeedFixturesTwice(t *testing.T) {
+	db := InitDB()
+
+	fixtures := Fixtures{Galaxies: []FixtureGalaxy{
+		{UgcNumber: "ugc_number12", Name: "NGC 7479", Stars: []FixtureStar{{Name: "Star A", GaiaCatalogueId: "gaia_a"}, {Name: "Sun", GaiaCatalogueId: "gaia_catalogue_id1"}}},
+	}}
+
+	num_galaxies, num_stars, err := SeedFixtures(context.Background(), db, fixtures)
+	if num_galaxies != 1 || num_stars != 1 || err != nil {
+		t.Fatalf(`SeedFixtures should add 1 galaxy and 1 star, added %d and %d, %v`, num_galaxies, num_stars, err)
+	}
+
+	num_galaxies, num_stars, err = SeedFixtures(context.Background(), db, fixtures)
+	if num_galaxies != 0 || num_stars != 0 || err != nil {
+		t.Fatalf(`SeedFixtures again should add nothing, added %d and %d, %v`, num_galaxies, num_stars, err)
+	}
+}
+
+// TestSeedFixturesDerivesDistance seeds galaxies with only a heliocentric velocity and checks
+// that redshift and distance are derived, except for the distance of an approaching galaxy
+func TestSeedFixturesDerivesDistance(t *testing.T) {
+	db := InitDB()
+
+	receding, approaching := 7000.0, -120.0
+	fixtures := Fixtures{Galaxies: []FixtureGalaxy{
+		{UgcNumber: "ugc_number10", Name: "Receding", HeliocentricVelocity: &receding},
+		{UgcNumber: "ugc_number11", Name: "Approaching", HeliocentricVelocity: &approaching},
+	}}
+	if _, _, err := SeedFixtures(context.Background(), db, fixtures); err != nil {
+		t.Fatalf(`SeedFixtures %v`, err)
+	}
+
+	var redshift, distance *float64
+	err := db.QueryRow("SELECT redshift, distance FROM galaxies WHERE ugc_number = 'ugc_number10'").Scan(&redshift, &distance)
+	if err != nil || redshift == nil || math.Abs(*redshift-0.02335) > 0.00001 || distance == nil || *distance != 100 {
+		t.Fatalf(`Receding galaxy should have redshift 0.02335 and distance 100 Mpc, is %v, %v, %v`, redshift, distance, err)
+	}
+
+	err = db.QueryRow("SELECT redshift, distance FROM galaxies WHERE ugc_number = 'ugc_number11'").Scan(&redshift, &distance)
+	if err != nil || redshift == nil || *redshift >= 0 || distance != nil {
+		t.Fatalf(`Approaching galaxy should have a negative redshift and no distance, is %v, %v, %v`, redshift, distance, err)
+	}
+}
@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are kept in migrations/<dialect>/<version>_<name>.up.sql and .down.sql,
+// and are embedded in the binary so that schema changes ship with the code.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// A Migration is one numbered change to the schema, with the SQL to apply and revert it.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// A MigrationStatus reports whether a Migration has been applied, and when.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// The schema_migrations table records which migrations have been applied.
+// This statement works unchanged in every dialect.
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations(
+    version             INT NOT NULL,
+    name                VARCHAR(200) NOT NULL,
+    applied_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (version)
+)`
+
+// Migrations returns the migrations for the given dialect, in version order.
+func Migrations(dialect Dialect) ([]Migration, error) {
+	dir := path.Join("migrations", string(dialect))
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("Migrations: %v", err)
+	}
+
+	by_version := map[int]*Migration{}
+	for _, entry := range entries {
+		// Files are named like 0001_create_galaxies_and_stars.up.sql
+		file_name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(file_name, ".sql"), ".")
+		version_text, name, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(version_text)
+		if !ok || !found || err != nil || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("Migrations: badly named migration file %s", file_name)
+		}
+
+		contents, err := migrationFiles.ReadFile(path.Join(dir, file_name))
+		if err != nil {
+			return nil, fmt.Errorf("Migrations: %v", err)
+		}
+
+		migration, ok := by_version[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			by_version[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(contents)
+		} else {
+			migration.Down = string(contents)
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range by_version {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("Migrations: migration %04d needs both up and down files", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// MigrateUp applies every migration that hasn't been applied yet, in version order,
+// and returns the ones it applied.
+func MigrateUp(ctx context.Context, db *DB) ([]Migration, error) {
+	statuses, err := MigrateStatus(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("MigrateUp: %v", err)
+	}
+
+	var applied []Migration
+	for _, status := range statuses {
+		if status.Applied {
+			continue
+		}
+		if err := runMigration(ctx, db, status.Migration.Up,
+			"INSERT INTO schema_migrations (version, name) VALUES (?, ?)", status.Version, status.Name); err != nil {
+			return applied, fmt.Errorf("MigrateUp %04d_%s: %v", status.Version, status.Name, err)
+		}
+		applied = append(applied, status.Migration)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the most recently applied migration and returns it.
+// It returns false if no migrations have been applied.
+func MigrateDown(ctx context.Context, db *DB) (Migration, bool, error) {
+	statuses, err := MigrateStatus(ctx, db)
+	if err != nil {
+		return Migration{}, false, fmt.Errorf("MigrateDown: %v", err)
+	}
+
+	for i := len(statuses) - 1; i >= 0; i-- {
+		status := statuses[i]
+		if !status.Applied {
+			continue
+		}
+		if err := runMigration(ctx, db, status.Migration.Down,
+			"DELETE FROM schema_migrations WHERE version = ?", status.Version); err != nil {
+			return Migration{}, false, fmt.Errorf("MigrateDown %04d_%s: %v", status.Version, status.Name, err)
+		}
+		return status.Migration, true, nil
+	}
+
+	return Migration{}, false, nil
+}
+
+// MigrateStatus returns every known migration for db's dialect and whether it has been applied.
+// It creates the schema_migrations table if it doesn't exist yet.
+func MigrateStatus(ctx context.Context, db *DB) ([]MigrationStatus, error) {
+	migrations, err := Migrations(db.Dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("MigrateStatus: %v", err)
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("MigrateStatus: %v", err)
+	}
+	defer rows.Close()
+
+	applied_at := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("MigrateStatus: %v", err)
+		}
+		applied_at[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("MigrateStatus: %v", err)
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, migration := range migrations {
+		at, ok := applied_at[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: at}
+	}
+
+	return statuses, nil
+}
+
+// Run the statements in script followed by the schema_migrations update in a transaction.
+// mysql commits DDL statements implicitly, so a failed mysql migration may be partly applied.
+func runMigration(ctx context.Context, db *DB, script string, record string, args ...any) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, statement := range splitStatements(script) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, db.Rebind(record), args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Split a script into statements at semicolons outside quotes and -- comments, since not
+// every driver accepts several statements in one Exec.
+func splitStatements(script string) []string {
+	var statements []string
+	var builder strings.Builder
+	var quote byte
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			// Skip the comment, keeping the newline that ends it
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+				continue
+			}
+			i += end
+			c = '\n'
+		case c == ';':
+			if statement := strings.TrimSpace(builder.String()); statement != "" {
+				statements = append(statements, statement)
+			}
+			builder.Reset()
+			continue
+		}
+		builder.WriteByte(c)
+	}
+
+	if statement := strings.TrimSpace(builder.String()); statement != "" {
+		statements = append(statements, statement)
+	}
+
+	return statements
+}
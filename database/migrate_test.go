@@ -0,0 +1,115 @@
+// Tests for Migrations, MigrateUp, MigrateDown and MigrateStatus
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// TestMigrationsMatch checks that every dialect has the same numbered migrations
+func TestMigrationsMatch(t *testing.T) {
+	want, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatalf(`Migrations %v`, err)
+	}
+	if len(want) == 0 {
+		t.Fatalf(`There should be at least one migration`)
+	}
+
+	for _, dialect := range []Dialect{MySQL, Postgres} {
+		got, err := Migrations(dialect)
+		if err != nil {
+			t.Fatalf(`Migrations %s %v`, dialect, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf(`%s should have %d migrations, has %d`, dialect, len(want), len(got))
+		}
+		for i := range want {
+			if got[i].Version != want[i].Version || got[i].Name != want[i].Name {
+				t.Fatalf(`%s migration should be %04d_%s, is %04d_%s`, dialect, want[i].Version, want[i].Name, got[i].Version, got[i].Name)
+			}
+		}
+	}
+}
+
+// TestMigrateUpDown migrates an empty sqlite database up, checks the status, and then
+// migrates it back down one step at a time
+func TestMigrateUpDown(t *testing.T) {
+	db := openTestSQLite(t)
+	ctx := context.Background()
+
+	migrations, err := Migrations(SQLite)
+	if err != nil {
+		t.Fatalf(`Migrations %v`, err)
+	}
+
+	applied, err := MigrateUp(ctx, db)
+	if err != nil {
+		t.Fatalf(`MigrateUp %v`, err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf(`MigrateUp should apply %d migrations, applied %d`, len(migrations), len(applied))
+	}
+
+	// A second MigrateUp has nothing to do
+	applied, err = MigrateUp(ctx, db)
+	if len(applied) != 0 || err != nil {
+		t.Fatalf(`MigrateUp should apply nothing, applied %d, %v`, len(applied), err)
+	}
+
+	statuses, err := MigrateStatus(ctx, db)
+	if err != nil {
+		t.Fatalf(`MigrateStatus %v`, err)
+	}
+	for _, status := range statuses {
+		if !status.Applied || status.AppliedAt.IsZero() {
+			t.Fatalf(`Migration %04d should be applied, status is %+v`, status.Version, status)
+		}
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		got, ok, err := MigrateDown(ctx, db)
+		if !ok || err != nil || got.Version != migrations[i].Version {
+			t.Fatalf(`MigrateDown should revert %04d, reverted %04d, %v, %v`, migrations[i].Version, got.Version, ok, err)
+		}
+	}
+
+	// Nothing left to revert, and the tables are gone
+	if _, ok, err := MigrateDown(ctx, db); ok || err != nil {
+		t.Fatalf(`MigrateDown should have nothing to revert, %v, %v`, ok, err)
+	}
+	if _, err := db.Exec("SELECT COUNT(*) FROM galaxies"); err == nil {
+		t.Fatalf(`galaxies table should have been dropped`)
+	}
+}
+
+// TestSplitStatements checks that scripts are split at semicolons, but not at semicolons
+// in quotes or comments
+func TestSplitStatements(t *testing.T) {
+	script := "-- drop; the tables\nDROP TABLE stars;\nINSERT INTO galaxies (name) VALUES ('a;b');\n"
+	want := []string{"DROP TABLE stars", "INSERT INTO galaxies (name) VALUES ('a;b')"}
+
+	got := splitStatements(script)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf(`splitStatements should return %q, is %q`, want, got)
+	}
+}
+
+// Open an empty sqlite database in a temporary directory
+func openTestSQLite(t *testing.T) *DB {
+	viper.Set("database.path", filepath.Join(t.TempDir(), "test.db"))
+	defer viper.Set("database.path", nil)
+
+	db, err := openDB("sqlite")
+	if err != nil {
+		t.Fatalf(`openDB %v`, err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
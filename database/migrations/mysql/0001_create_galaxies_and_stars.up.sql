@@ -1,4 +1,4 @@
-CREATE TABLE galaxies(
+CREATE TABLE IF NOT EXISTS galaxies(
     id                  INT AUTO_INCREMENT NOT NULL,
     name                VARCHAR(200) NOT NULL,
     ugc_number          VARCHAR(200) NOT NULL,
@@ -7,7 +7,7 @@ CREATE TABLE galaxies(
     UNIQUE (ugc_number)
 );
 
-CREATE TABLE stars(
+CREATE TABLE IF NOT EXISTS stars(
     id                  INT AUTO_INCREMENT NOT NULL,
     galaxy_id           INT NOT NULL,
     name                VARCHAR(200) NOT NULL,
@@ -0,0 +1,5 @@
+ALTER TABLE stars DROP INDEX stars_gaia_catalogue_id;
+
+ALTER TABLE stars DROP FOREIGN KEY stars_galaxy_id_fk;
+
+DROP INDEX stars_galaxy_id ON stars;
@@ -0,0 +1,15 @@
+-- Gaia-style astrometry and photometry. Every column is nullable, since Gaia has gaps
+-- (no parallax or proper motion for 2-parameter solutions, few radial velocities, missing
+-- BP/RP photometry), and stars added before this migration have no values at all.
+-- dec is a reserved word in mysql, so column names are quoted.
+ALTER TABLE stars
+    ADD COLUMN `ra` DOUBLE NULL,
+    ADD COLUMN `dec` DOUBLE NULL,
+    ADD COLUMN `parallax` DOUBLE NULL,
+    ADD COLUMN `parallax_error` DOUBLE NULL,
+    ADD COLUMN `pmra` DOUBLE NULL,
+    ADD COLUMN `pmdec` DOUBLE NULL,
+    ADD COLUMN `radial_velocity` DOUBLE NULL,
+    ADD COLUMN `phot_g_mean_mag` DOUBLE NULL,
+    ADD COLUMN `phot_bp_mean_mag` DOUBLE NULL,
+    ADD COLUMN `phot_rp_mean_mag` DOUBLE NULL;
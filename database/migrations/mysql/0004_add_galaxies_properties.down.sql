@@ -0,0 +1,11 @@
+ALTER TABLE galaxies
+    DROP COLUMN `morphological_type`,
+    DROP COLUMN `ra`,
+    DROP COLUMN `dec`,
+    DROP COLUMN `major_diameter`,
+    DROP COLUMN `minor_diameter`,
+    DROP COLUMN `position_angle`,
+    DROP COLUMN `blue_magnitude`,
+    DROP COLUMN `heliocentric_velocity`,
+    DROP COLUMN `redshift`,
+    DROP COLUMN `distance`;
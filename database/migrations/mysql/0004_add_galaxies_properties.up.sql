@@ -0,0 +1,15 @@
+-- UGC catalogue properties. Every column is nullable, since the UGC has gaps and galaxies
+-- added before this migration have no values at all. redshift and distance are derived from
+-- heliocentric_velocity when they aren't given.
+-- dec is a reserved word in mysql, so column names are quoted.
+ALTER TABLE galaxies
+    ADD COLUMN `morphological_type` VARCHAR(50) NULL,
+    ADD COLUMN `ra` DOUBLE NULL,
+    ADD COLUMN `dec` DOUBLE NULL,
+    ADD COLUMN `major_diameter` DOUBLE NULL,
+    ADD COLUMN `minor_diameter` DOUBLE NULL,
+    ADD COLUMN `position_angle` DOUBLE NULL,
+    ADD COLUMN `blue_magnitude` DOUBLE NULL,
+    ADD COLUMN `heliocentric_velocity` DOUBLE NULL,
+    ADD COLUMN `redshift` DOUBLE NULL,
+    ADD COLUMN `distance` DOUBLE NULL;
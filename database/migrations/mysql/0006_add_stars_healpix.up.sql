@@ -0,0 +1,5 @@
+-- The NESTED HEALPix pixel holding each star, at the order healpix.order sets (12 unless
+-- configured). Searches turn a region of sky into a few ranges of pixels, which this index
+-- answers without scanning the stars outside them. Stars without a position have no pixel.
+ALTER TABLE stars ADD COLUMN `healpix` BIGINT NULL;
+CREATE INDEX stars_healpix ON stars (`healpix`);
@@ -0,0 +1,14 @@
+-- Values derived from each star's astrometry and photometry by the pipeline, so analysis
+-- queries can join them instead of working them out again. Every value is nullable, since
+-- a star without a usable parallax or BP/RP photometry has no distance or colour.
+CREATE TABLE IF NOT EXISTS star_derived(
+    star_id             INT NOT NULL,
+    distance            DOUBLE PRECISION NULL,
+    distance_modulus    DOUBLE PRECISION NULL,
+    abs_g_mag           DOUBLE PRECISION NULL,
+    bp_rp               DOUBLE PRECISION NULL,
+    tangential_velocity DOUBLE PRECISION NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (`star_id`),
+    CONSTRAINT star_derived_star_id_fk FOREIGN KEY (star_id) REFERENCES stars (id)
+);
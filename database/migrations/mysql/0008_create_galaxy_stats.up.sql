@@ -0,0 +1,23 @@
+-- Per-galaxy statistics from the last pipeline run, for a view of the catalog's health:
+-- how many stars each galaxy has, the range of their magnitudes and colours, their mean
+-- parallax, the box of sky they cover, and how many of their values are missing. The values
+-- are NULL when none of a galaxy's stars have them. ra_min is more than ra_max when the
+-- box wraps around RA 0.
+CREATE TABLE IF NOT EXISTS galaxy_stats(
+    galaxy_id           INT NOT NULL,
+    star_count          BIGINT NOT NULL,
+    g_mag_min           DOUBLE PRECISION NULL,
+    g_mag_max           DOUBLE PRECISION NULL,
+    g_mag_mean          DOUBLE PRECISION NULL,
+    bp_rp_min           DOUBLE PRECISION NULL,
+    bp_rp_max           DOUBLE PRECISION NULL,
+    mean_parallax       DOUBLE PRECISION NULL,
+    ra_min              DOUBLE PRECISION NULL,
+    ra_max              DOUBLE PRECISION NULL,
+    dec_min             DOUBLE PRECISION NULL,
+    dec_max             DOUBLE PRECISION NULL,
+    missing_fields      BIGINT NOT NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    PRIMARY KEY (`galaxy_id`),
+    CONSTRAINT galaxy_stats_galaxy_id_fk FOREIGN KEY (galaxy_id) REFERENCES galaxies (id)
+);
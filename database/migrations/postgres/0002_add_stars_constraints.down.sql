@@ -0,0 +1,5 @@
+ALTER TABLE stars DROP CONSTRAINT stars_gaia_catalogue_id;
+
+ALTER TABLE stars DROP CONSTRAINT stars_galaxy_id_fk;
+
+DROP INDEX stars_galaxy_id;
@@ -0,0 +1,6 @@
+-- Every GalaxyStarChannel query filters stars on galaxy_id
+CREATE INDEX stars_galaxy_id ON stars (galaxy_id);
+
+ALTER TABLE stars ADD CONSTRAINT stars_galaxy_id_fk FOREIGN KEY (galaxy_id) REFERENCES galaxies (id);
+
+ALTER TABLE stars ADD CONSTRAINT stars_gaia_catalogue_id UNIQUE (gaia_catalogue_id);
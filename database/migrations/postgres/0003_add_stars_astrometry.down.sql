@@ -0,0 +1,11 @@
+ALTER TABLE stars
+    DROP COLUMN ra,
+    DROP COLUMN dec,
+    DROP COLUMN parallax,
+    DROP COLUMN parallax_error,
+    DROP COLUMN pmra,
+    DROP COLUMN pmdec,
+    DROP COLUMN radial_velocity,
+    DROP COLUMN phot_g_mean_mag,
+    DROP COLUMN phot_bp_mean_mag,
+    DROP COLUMN phot_rp_mean_mag;
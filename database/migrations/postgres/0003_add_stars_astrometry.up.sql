@@ -0,0 +1,14 @@
+-- Gaia-style astrometry and photometry. Every column is nullable, since Gaia has gaps
+-- (no parallax or proper motion for 2-parameter solutions, few radial velocities, missing
+-- BP/RP photometry), and stars added before this migration have no values at all.
+ALTER TABLE stars
+    ADD COLUMN ra DOUBLE PRECISION NULL,
+    ADD COLUMN dec DOUBLE PRECISION NULL,
+    ADD COLUMN parallax DOUBLE PRECISION NULL,
+    ADD COLUMN parallax_error DOUBLE PRECISION NULL,
+    ADD COLUMN pmra DOUBLE PRECISION NULL,
+    ADD COLUMN pmdec DOUBLE PRECISION NULL,
+    ADD COLUMN radial_velocity DOUBLE PRECISION NULL,
+    ADD COLUMN phot_g_mean_mag DOUBLE PRECISION NULL,
+    ADD COLUMN phot_bp_mean_mag DOUBLE PRECISION NULL,
+    ADD COLUMN phot_rp_mean_mag DOUBLE PRECISION NULL;
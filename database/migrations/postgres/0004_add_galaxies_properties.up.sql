@@ -0,0 +1,14 @@
+-- UGC catalogue properties. Every column is nullable, since the UGC has gaps and galaxies
+-- added before this migration have no values at all. redshift and distance are derived from
+-- heliocentric_velocity when they aren't given.
+ALTER TABLE galaxies
+    ADD COLUMN morphological_type VARCHAR(50) NULL,
+    ADD COLUMN ra DOUBLE PRECISION NULL,
+    ADD COLUMN dec DOUBLE PRECISION NULL,
+    ADD COLUMN major_diameter DOUBLE PRECISION NULL,
+    ADD COLUMN minor_diameter DOUBLE PRECISION NULL,
+    ADD COLUMN position_angle DOUBLE PRECISION NULL,
+    ADD COLUMN blue_magnitude DOUBLE PRECISION NULL,
+    ADD COLUMN heliocentric_velocity DOUBLE PRECISION NULL,
+    ADD COLUMN redshift DOUBLE PRECISION NULL,
+    ADD COLUMN distance DOUBLE PRECISION NULL;
@@ -0,0 +1 @@
+DROP INDEX stars_dec_ra;
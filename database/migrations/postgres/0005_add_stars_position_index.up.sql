@@ -0,0 +1,3 @@
+-- Cone searches filter on a bounding box in dec and ra before checking the exact distance.
+-- dec comes first since its range is the narrower one, except near the poles.
+CREATE INDEX stars_dec_ra ON stars (dec, ra);
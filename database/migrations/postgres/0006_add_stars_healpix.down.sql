@@ -0,0 +1,2 @@
+DROP INDEX stars_healpix;
+ALTER TABLE stars DROP COLUMN healpix;
@@ -0,0 +1 @@
+DROP TABLE star_derived;
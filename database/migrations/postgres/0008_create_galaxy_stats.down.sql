@@ -0,0 +1 @@
+DROP TABLE galaxy_stats;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS galaxies(
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    name                VARCHAR(200) NOT NULL,
+    ugc_number          VARCHAR(200) NOT NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    UNIQUE (ugc_number)
+);
+
+CREATE TABLE IF NOT EXISTS stars(
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    galaxy_id           INT NOT NULL,
+    name                VARCHAR(200) NOT NULL,
+    gaia_catalogue_id   VARCHAR(200) NOT NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
@@ -0,0 +1,14 @@
+CREATE TABLE stars_old(
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    galaxy_id           INT NOT NULL,
+    name                VARCHAR(200) NOT NULL,
+    gaia_catalogue_id   VARCHAR(200) NOT NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL
+);
+
+INSERT INTO stars_old (id, galaxy_id, name, gaia_catalogue_id, created_at)
+    SELECT id, galaxy_id, name, gaia_catalogue_id, created_at FROM stars;
+
+DROP TABLE stars;
+
+ALTER TABLE stars_old RENAME TO stars;
@@ -0,0 +1,20 @@
+-- sqlite can't add constraints to an existing table, so the stars table is rebuilt
+CREATE TABLE stars_new(
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    galaxy_id           INT NOT NULL,
+    name                VARCHAR(200) NOT NULL,
+    gaia_catalogue_id   VARCHAR(200) NOT NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT stars_galaxy_id_fk FOREIGN KEY (galaxy_id) REFERENCES galaxies (id),
+    CONSTRAINT stars_gaia_catalogue_id UNIQUE (gaia_catalogue_id)
+);
+
+INSERT INTO stars_new (id, galaxy_id, name, gaia_catalogue_id, created_at)
+    SELECT id, galaxy_id, name, gaia_catalogue_id, created_at FROM stars;
+
+DROP TABLE stars;
+
+ALTER TABLE stars_new RENAME TO stars;
+
+-- Every GalaxyStarChannel query filters stars on galaxy_id
+CREATE INDEX stars_galaxy_id ON stars (galaxy_id);
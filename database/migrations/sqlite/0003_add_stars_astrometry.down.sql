@@ -0,0 +1,10 @@
+ALTER TABLE stars DROP COLUMN ra;
+ALTER TABLE stars DROP COLUMN dec;
+ALTER TABLE stars DROP COLUMN parallax;
+ALTER TABLE stars DROP COLUMN parallax_error;
+ALTER TABLE stars DROP COLUMN pmra;
+ALTER TABLE stars DROP COLUMN pmdec;
+ALTER TABLE stars DROP COLUMN radial_velocity;
+ALTER TABLE stars DROP COLUMN phot_g_mean_mag;
+ALTER TABLE stars DROP COLUMN phot_bp_mean_mag;
+ALTER TABLE stars DROP COLUMN phot_rp_mean_mag;
@@ -0,0 +1,14 @@
+-- Gaia-style astrometry and photometry. Every column is nullable, since Gaia has gaps
+-- (no parallax or proper motion for 2-parameter solutions, few radial velocities, missing
+-- BP/RP photometry), and stars added before this migration have no values at all.
+-- sqlite only adds one column per ALTER TABLE.
+ALTER TABLE stars ADD COLUMN ra REAL NULL;
+ALTER TABLE stars ADD COLUMN dec REAL NULL;
+ALTER TABLE stars ADD COLUMN parallax REAL NULL;
+ALTER TABLE stars ADD COLUMN parallax_error REAL NULL;
+ALTER TABLE stars ADD COLUMN pmra REAL NULL;
+ALTER TABLE stars ADD COLUMN pmdec REAL NULL;
+ALTER TABLE stars ADD COLUMN radial_velocity REAL NULL;
+ALTER TABLE stars ADD COLUMN phot_g_mean_mag REAL NULL;
+ALTER TABLE stars ADD COLUMN phot_bp_mean_mag REAL NULL;
+ALTER TABLE stars ADD COLUMN phot_rp_mean_mag REAL NULL;
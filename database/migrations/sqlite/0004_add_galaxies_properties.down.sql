@@ -0,0 +1,10 @@
+ALTER TABLE galaxies DROP COLUMN morphological_type;
+ALTER TABLE galaxies DROP COLUMN ra;
+ALTER TABLE galaxies DROP COLUMN dec;
+ALTER TABLE galaxies DROP COLUMN major_diameter;
+ALTER TABLE galaxies DROP COLUMN minor_diameter;
+ALTER TABLE galaxies DROP COLUMN position_angle;
+ALTER TABLE galaxies DROP COLUMN blue_magnitude;
+ALTER TABLE galaxies DROP COLUMN heliocentric_velocity;
+ALTER TABLE galaxies DROP COLUMN redshift;
+ALTER TABLE galaxies DROP COLUMN distance;
@@ -0,0 +1,14 @@
+-- UGC catalogue properties. Every column is nullable, since the UGC has gaps and galaxies
+-- added before this migration have no values at all. redshift and distance are derived from
+-- heliocentric_velocity when they aren't given.
+-- sqlite only adds one column per ALTER TABLE.
+ALTER TABLE galaxies ADD COLUMN morphological_type VARCHAR(50) NULL;
+ALTER TABLE galaxies ADD COLUMN ra REAL NULL;
+ALTER TABLE galaxies ADD COLUMN dec REAL NULL;
+ALTER TABLE galaxies ADD COLUMN major_diameter REAL NULL;
+ALTER TABLE galaxies ADD COLUMN minor_diameter REAL NULL;
+ALTER TABLE galaxies ADD COLUMN position_angle REAL NULL;
+ALTER TABLE galaxies ADD COLUMN blue_magnitude REAL NULL;
+ALTER TABLE galaxies ADD COLUMN heliocentric_velocity REAL NULL;
+ALTER TABLE galaxies ADD COLUMN redshift REAL NULL;
+ALTER TABLE galaxies ADD COLUMN distance REAL NULL;
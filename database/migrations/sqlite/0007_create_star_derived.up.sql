@@ -0,0 +1,13 @@
+-- Values derived from each star's astrometry and photometry by the pipeline, so analysis
+-- queries can join them instead of working them out again. Every value is nullable, since
+-- a star without a usable parallax or BP/RP photometry has no distance or colour.
+CREATE TABLE IF NOT EXISTS star_derived(
+    star_id             INTEGER NOT NULL PRIMARY KEY,
+    distance            REAL NULL,
+    distance_modulus    REAL NULL,
+    abs_g_mag           REAL NULL,
+    bp_rp               REAL NULL,
+    tangential_velocity REAL NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT star_derived_star_id_fk FOREIGN KEY (star_id) REFERENCES stars (id)
+);
@@ -0,0 +1,22 @@
+-- Per-galaxy statistics from the last pipeline run, for a view of the catalog's health:
+-- how many stars each galaxy has, the range of their magnitudes and colours, their mean
+-- parallax, the box of sky they cover, and how many of their values are missing. The values
+-- are NULL when none of a galaxy's stars have them. ra_min is more than ra_max when the
+-- box wraps around RA 0.
+CREATE TABLE IF NOT EXISTS galaxy_stats(
+    galaxy_id           INTEGER NOT NULL PRIMARY KEY,
+    star_count          BIGINT NOT NULL,
+    g_mag_min           REAL NULL,
+    g_mag_max           REAL NULL,
+    g_mag_mean          REAL NULL,
+    bp_rp_min           REAL NULL,
+    bp_rp_max           REAL NULL,
+    mean_parallax       REAL NULL,
+    ra_min              REAL NULL,
+    ra_max              REAL NULL,
+    dec_min             REAL NULL,
+    dec_max             REAL NULL,
+    missing_fields      BIGINT NOT NULL,
+    created_at          TIMESTAMP DEFAULT CURRENT_TIMESTAMP NOT NULL,
+    CONSTRAINT galaxy_stats_galaxy_id_fk FOREIGN KEY (galaxy_id) REFERENCES galaxies (id)
+);
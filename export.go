@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"star-catalog/astro"
+	"star-catalog/database"
+	"star-catalog/exporter"
+	"star-catalog/fits"
+	galaxypkg "star-catalog/galaxy"
+	starpkg "star-catalog/star"
+)
+
+// exportFormats maps file extensions to export formats
+var exportFormats = map[string]string{
+	".csv":     exporter.CSV,
+	".ndjson":  exporter.NDJSON,
+	".jsonl":   exporter.NDJSON,
+	".parquet": exporter.Parquet,
+	".vot":     exporter.VOTable,
+	".xml":     exporter.VOTable,
+	".fits":    "fits",
+	".fit":     "fits",
+}
+
+// exportCompressions maps file extensions to export compressions
+var exportCompressions = map[string]string{
+	".gz":  exporter.Gzip,
+	".zst": exporter.Zstd,
+}
+
+// runExport writes galaxies, stars, or stars joined to their galaxies to a file, all of
+// them or only those of the -galaxy given, and writes what it did to out.
+// The format and compression follow the file's extension, as in stars.csv.gz, unless -format
+// and -compress are given. A file of - writes to out instead, as CSV unless -format is given.
+// FITS files always have both a GALAXIES and a STARS table, with all their columns.
+// With -epoch the stars' positions are moved to that date by their proper motions.
+// The file is removed again if the export fails, so a partial file isn't mistaken for a
+// complete one.
+func runExport(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(out)
+	galaxy := flags.String("galaxy", "", "ugc_number of the only galaxy to export")
+	table := flags.String("table", exporter.Stars, "table to export: galaxies, stars, or joined for stars with their galaxy's columns")
+	columns := flags.String("columns", "", "comma-separated columns to export, in order (default all)")
+	format := flags.String("format", "", "csv, ndjson, parquet, votable or fits (default from the file extension)")
+	compression := flags.String("compress", "", "gzip or zstd (default from the file extension)")
+	epoch_text := flags.String("epoch", "", "epoch of the stars' positions, like J2000 or 2024-03-01 (default J2016.0)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("export needs one file\n%s", usage)
+	}
+	path := flags.Arg(0)
+
+	name := path
+	if extension := filepath.Ext(name); *compression == "" && exportCompressions[extension] != "" {
+		*compression = exportCompressions[extension]
+		name = strings.TrimSuffix(name, extension)
+	}
+	if *format == "" {
+		*format = exportFormats[filepath.Ext(name)]
+	}
+	if *format == "" && path == "-" {
+		*format = exporter.CSV
+	}
+	if *format == "" {
+		return fmt.Errorf("can't tell the format of %s, use -format", path)
+	}
+
+	options := exporter.Options{Table: *table, Format: *format, Compression: *compression, Galaxy: *galaxy}
+	if *columns != "" {
+		options.Columns = strings.Split(*columns, ",")
+	}
+	if *format == "fits" {
+		set := map[string]bool{}
+		flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if set["table"] || set["columns"] || *compression != "" || path == "-" {
+			return errors.New("FITS exports are both tables, uncompressed, to a file")
+		}
+	}
+
+	var epoch float64
+	if *epoch_text != "" {
+		if *table == exporter.Galaxies {
+			return errors.New("-epoch only applies to stars")
+		}
+		var err error
+		if epoch, err = astro.ParseEpoch(*epoch_text); err != nil {
+			return fmt.Errorf("export: %v", err)
+		}
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+	galaxies := galaxypkg.NewSQLStore(db)
+	var stars starpkg.StarStore = starpkg.NewSQLStore(db)
+	if *epoch_text != "" {
+		stars = starpkg.EpochStore{StarStore: stars, Epoch: epoch}
+	}
+
+	if path == "-" {
+		result, err := exporter.Export(ctx, out, galaxies, stars, options)
+		if err != nil {
+			return err
+		}
+		log.Printf("runExport exported %d rows\n", result.Rows)
+		return nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var summary string
+	if *format == "fits" {
+		var result fits.ExportResult
+		result, err = fits.Export(ctx, file, galaxies, stars, *galaxy)
+		summary = fmt.Sprintf("%d galaxies and %d stars", result.Galaxies, result.Stars)
+	} else {
+		var result exporter.Result
+		result, err = exporter.Export(ctx, file, galaxies, stars, options)
+		summary = fmt.Sprintf("%d %s rows", result.Rows, options.Table)
+	}
+	if err == nil {
+		err = file.Close()
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	fmt.Fprintf(out, "Exported %s to %s\n", summary, path)
+
+	return nil
+}
@@ -0,0 +1,167 @@
+// Tests for the export command
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"star-catalog/database"
+	starpkg "star-catalog/star"
+	"star-catalog/votable"
+)
+
+// TestExportCommand exports one galaxy from the fixtures, and checks the output and that
+// the file is FITS
+func TestExportCommand(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "andromeda.fits")
+	var out bytes.Buffer
+	if err := runExport(context.Background(), []string{"-galaxy", "ugc_number2", path}, &out); err != nil {
+		t.Fatalf(`export %v`, err)
+	}
+
+	if want := "Exported 1 galaxies and 3 stars to " + path; !strings.Contains(out.String(), want) {
+		t.Fatalf(`export output should contain %s, is %s`, want, out.String())
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(content, []byte("SIMPLE  =                    T")) || len(content)%2880 != 0 {
+		t.Fatalf(`export should write a FITS file, starts %q and is %d bytes`, content[:30], len(content))
+	}
+}
+
+// TestExportMissingGalaxy checks that nothing is left behind when the galaxy isn't found
+func TestExportMissingGalaxy(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "missing.fits")
+	var out bytes.Buffer
+	if err := runExport(context.Background(), []string{"-galaxy", "ugc_number9", path}, &out); err == nil {
+		t.Fatalf(`export of a missing galaxy should fail`)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf(`The FITS file should have been removed, %v`, err)
+	}
+}
+
+// TestExportCSVCommand exports joined stars to a gzipped CSV file, and checks the contents
+func TestExportCSVCommand(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "andromeda.csv.gz")
+	var out bytes.Buffer
+	args := []string{"-table", "joined", "-columns", "gaia_catalogue_id,galaxy_name", "-galaxy", "ugc_number2", path}
+	if err := runExport(context.Background(), args, &out); err != nil {
+		t.Fatalf(`export %v`, err)
+	}
+	if want := "Exported 3 joined rows to " + path; !strings.Contains(out.String(), want) {
+		t.Fatalf(`export output should contain %s, is %s`, want, out.String())
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf(`The export should be gzipped, %v`, err)
+	}
+	content, err := io.ReadAll(reader)
+	if want := "gaia_catalogue_id,galaxy_name\ngaia_catalogue_id3,Andromeda\n"; !strings.HasPrefix(string(content), want) || err != nil {
+		t.Fatalf(`The export should start %q, is %q, %v`, want, content, err)
+	}
+}
+
+// TestExportVOTableCommand exports stars to a VOTable file, and reads them back
+func TestExportVOTableCommand(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "andromeda.vot")
+	var out bytes.Buffer
+	if err := runExport(context.Background(), []string{"-galaxy", "ugc_number2", path}, &out); err != nil {
+		t.Fatalf(`export %v`, err)
+	}
+	if want := "Exported 3 stars rows to " + path; !strings.Contains(out.String(), want) {
+		t.Fatalf(`export output should contain %s, is %s`, want, out.String())
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader, err := votable.NewReader(file)
+	if err != nil {
+		t.Fatalf(`The export should be a VOTable, %v`, err)
+	}
+	var star starpkg.Star
+	if err := reader.Decode(&star); err != nil || star.Name != "Star3" || star.Ra == nil || *star.Ra != 10.6847 {
+		t.Fatalf(`The first star should be Star3 at ra 10.6847, is %+v, %v`, star, err)
+	}
+}
+
+// TestExportStdout exports galaxies as NDJSON to out
+func TestExportStdout(t *testing.T) {
+	database.InitDB()
+
+	var out bytes.Buffer
+	if err := runExport(context.Background(), []string{"-table", "galaxies", "-format", "ndjson", "-columns", "ugc_number", "-"}, &out); err != nil {
+		t.Fatalf(`export %v`, err)
+	}
+	if want := "{\"ugc_number\":\"ugc_number1\"}\n{\"ugc_number\":\"ugc_number2\"}\n"; out.String() != want {
+		t.Fatalf(`export output should be %q, is %q`, want, out.String())
+	}
+}
+
+// TestExportEpoch exports Star3 at J2000, when its proper motion of -0.03 mas/yr in dec
+// had it 0.48 milliarcseconds further north
+func TestExportEpoch(t *testing.T) {
+	database.InitDB()
+
+	var out bytes.Buffer
+	args := []string{"-galaxy", "ugc_number2", "-columns", "name,dec", "-epoch", "J2000", "-"}
+	if err := runExport(context.Background(), args, &out); err != nil {
+		t.Fatalf(`export %v`, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	name, dec, _ := strings.Cut(lines[1], ",")
+	got, err := strconv.ParseFloat(dec, 64)
+	if name != "Star3" || err != nil || math.Abs((got-41.2690)*3.6e6-0.48) > 1e-6 {
+		t.Fatalf(`Star3 should be 0.48 mas north of 41.2690 at J2000, is %q`, lines[1])
+	}
+}
+
+// TestExportBadArguments checks that unknown formats, and options FITS can't do, fail
+// before anything is written
+func TestExportBadArguments(t *testing.T) {
+	dir := t.TempDir()
+	tests := [][]string{
+		{filepath.Join(dir, "stars.txt")},
+		{"-columns", "name", filepath.Join(dir, "stars.fits")},
+		{filepath.Join(dir, "stars.fits.gz")},
+		{"-epoch", "soon", filepath.Join(dir, "stars.csv")},
+		{"-epoch", "J2000", "-table", "galaxies", filepath.Join(dir, "galaxies.csv")},
+	}
+
+	for _, args := range tests {
+		var out bytes.Buffer
+		if err := runExport(context.Background(), args, &out); err == nil {
+			t.Fatalf(`export %v should fail`, args)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Package exporter writes the catalog out as CSV, NDJSON (one JSON object per line), Parquet
+// or VOTable, for use outside this app.
+// Export writes the galaxies table, the stars table, or a joined view with each star's
+// galaxy, for every galaxy or just one, and can select and order the columns.
+// Galaxies are streamed with galaxy.GalaxyChannel and their stars with
+// star.GalaxyStarChannel, so exports of millions of stars run in constant memory.
+// Columns are named by the db tags of galaxy.Galaxy and star.Star; in the joined view the
+// galaxy's columns are prefixed with galaxy_. VOTable columns also have the UCDs and units of
+// the fields' ucd and unit tags.
+package exporter
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	galaxypkg "star-catalog/galaxy"
+	starpkg "star-catalog/star"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The tables Export can write
+const (
+	Galaxies = "galaxies"
+	Stars    = "stars"
+	// Joined has the columns of stars followed by those of the star's galaxy, other than
+	// its id, which is the same as galaxy_id
+	Joined = "joined"
+)
+
+// The formats Export can write
+const (
+	CSV     = "csv"
+	NDJSON  = "ndjson"
+	Parquet = "parquet"
+	// VOTable is written with BINARY2 serialization, which keeps floats exact
+	VOTable = "votable"
+)
+
+// The compressions Export can apply. CSV, NDJSON and VOTable are compressed as a whole, and Parquet
+// compresses its column chunks, so the file stays readable by Parquet tools.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Options says what to export, and how.
+type Options struct {
+	// Table is Galaxies, Stars or Joined. The default is Stars.
+	Table string
+	// Format is CSV, NDJSON, Parquet or VOTable. The default is CSV.
+	Format string
+	// Compression is Gzip, Zstd, or empty for none.
+	Compression string
+	// Columns are the names of the columns to write, in order. The default is all of them.
+	Columns []string
+	// Galaxy is the ugc_number of the only galaxy to export. The default is all of them.
+	Galaxy string
+}
+
+// A Result counts the rows written by Export.
+type Result struct {
+	Rows int64
+}
+
+// A column is a column of the exported table, read from a db tagged field of a Galaxy or a Star
+type column struct {
+	name   string
+	typ    reflect.Type
+	index  int
+	galaxy bool
+	// The UCD and unit of the field, from its ucd and unit tags
+	ucd  string
+	unit string
+}
+
+// A rowWriter writes rows of values, one for each column, in some format. Values are nil
+// for null, and never pointers.
+type rowWriter interface {
+	Write(values []any) error
+	Close() error
+}
+
+// Export writes the table and columns given by options to w. It stops at the first error,
+// including a cancelled ctx. An unknown ugc_number is an error wrapping sql.ErrNoRows.
+func Export(ctx context.Context, w io.Writer, galaxies galaxypkg.GalaxyStore, stars starpkg.StarStore, options Options) (Result, error) {
+	var result Result
+
+	if options.Table == "" {
+		options.Table = Stars
+	}
+	if options.Format == "" {
+		options.Format = CSV
+	}
+
+	columns, err := selectColumns(options.Table, options.Columns)
+	if err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+
+	// Parquet does its own compression, inside the file
+	output := w
+	var compressor io.WriteCloser
+	if options.Format != Parquet {
+		compressor, err = compress(w, options.Compression)
+		if err != nil {
+			return result, fmt.Errorf("Export: %v", err)
+		}
+		if compressor != nil {
+			output = compressor
+		}
+	}
+
+	var writer rowWriter
+	switch options.Format {
+	case CSV:
+		writer, err = newCSVWriter(output, columns)
+	case NDJSON:
+		writer, err = newNDJSONWriter(output, columns)
+	case Parquet:
+		writer, err = newParquetWriter(output, columns, options.Compression)
+	case VOTable:
+		writer, err = newVOTableWriter(output, columns, options.Table)
+	default:
+		err = fmt.Errorf("unknown format %q", options.Format)
+	}
+	if err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+
+	values := make([]any, len(columns))
+	write := func(galaxy galaxypkg.Galaxy, star *starpkg.Star) error {
+		rowValues(values, columns, galaxy, star)
+		if err := writer.Write(values); err != nil {
+			return err
+		}
+		result.Rows++
+		return nil
+	}
+
+	err = eachGalaxy(ctx, galaxies, options.Galaxy, func(galaxy galaxypkg.Galaxy) error {
+		if options.Table == Galaxies {
+			return write(galaxy, nil)
+		}
+		return eachStar(ctx, stars, galaxy, func(star starpkg.Star) error {
+			return write(galaxy, &star)
+		})
+	})
+	if err != nil {
+		return result, fmt.Errorf("Export: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return result, fmt.Errorf("Export: %v", err)
+		}
+	}
+
+	return result, nil
+}
+
+// Call fn for the galaxy with ugc_number, or for every galaxy from GalaxyChannel if
+// ugc_number is empty
+func eachGalaxy(ctx context.Context, store galaxypkg.GalaxyStore, ugc_number string, fn func(galaxypkg.Galaxy) error) error {
+	if ugc_number != "" {
+		galaxy, err := store.FindGalaxy(ctx, ugc_number)
+		if err != nil {
+			return err
+		}
+		return fn(galaxy)
+	}
+
+	// Cancelling stops the producer if fn fails
+	galaxy_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	galaxy_channel := make(chan galaxypkg.Galaxy)
+	error_channel := make(chan error, 1)
+	go galaxypkg.GalaxyChannel(galaxy_ctx, store, galaxy_channel, error_channel)
+
+	var fn_err error
+	for galaxy := range galaxy_channel {
+		if fn_err != nil {
+			continue
+		}
+		if fn_err = fn(galaxy); fn_err != nil {
+			cancel()
+		}
+	}
+
+	if fn_err != nil {
+		return fn_err
+	}
+	return <-error_channel
+}
+
+// Call fn for each star of galaxy, as they arrive from GalaxyStarChannel
+func eachStar(ctx context.Context, store starpkg.StarStore, galaxy galaxypkg.Galaxy, fn func(starpkg.Star) error) error {
+	// Cancelling stops the producer if fn fails
+	star_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	star_channel := make(chan starpkg.Star)
+	error_channel := make(chan error, 1)
+	go func() {
+		error_channel <- starpkg.GalaxyStarChannel(star_ctx, store, galaxy, star_channel)
+	}()
+
+	var fn_err error
+	for star := range star_channel {
+		if fn_err != nil {
+			continue
+		}
+		if fn_err = fn(star); fn_err != nil {
+			cancel()
+		}
+	}
+
+	err := <-error_channel
+	if fn_err != nil {
+		return fn_err
+	}
+	return err
+}
+
+// Return every column of table
+func tableColumns(table string) ([]column, error) {
+	switch table {
+	case Galaxies:
+		return structColumns(reflect.TypeOf(galaxypkg.Galaxy{}), "", true, nil), nil
+	case Stars:
+		return structColumns(reflect.TypeOf(starpkg.Star{}), "", false, nil), nil
+	case Joined:
+		columns := structColumns(reflect.TypeOf(starpkg.Star{}), "", false, nil)
+		return structColumns(reflect.TypeOf(galaxypkg.Galaxy{}), "galaxy_", true, columns), nil
+	}
+	return nil, fmt.Errorf("unknown table %q", table)
+}
+
+// Append a column for each db tagged field of t to columns, named with prefix. A galaxy id
+// with a prefix is left out, as it is the star's galaxy_id, and the prefixed columns' UCDs
+// lose meta.main, which belongs to the star's columns.
+func structColumns(t reflect.Type, prefix string, galaxy bool, columns []column) []column {
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag
+		name, ok := tag.Lookup("db")
+		if !ok || name == "-" || (prefix != "" && name == "id") {
+			continue
+		}
+		ucd := tag.Get("ucd")
+		if prefix != "" {
+			ucd = strings.TrimSuffix(ucd, ";meta.main")
+		}
+		columns = append(columns, column{name: prefix + name, typ: t.Field(i).Type, index: i, galaxy: galaxy, ucd: ucd, unit: tag.Get("unit")})
+	}
+	return columns
+}
+
+// Return the columns of table with the given names, in that order, or all of them if
+// names is empty
+func selectColumns(table string, names []string) ([]column, error) {
+	columns, err := tableColumns(table)
+	if err != nil || len(names) == 0 {
+		return columns, err
+	}
+
+	selected := make([]column, 0, len(names))
+	for _, name := range names {
+		index := slices.IndexFunc(columns, func(column column) bool { return column.name == name })
+		if index < 0 {
+			names := make([]string, len(columns))
+			for i, column := range columns {
+				names[i] = column.name
+			}
+			return nil, fmt.Errorf("%s has no column %q, only %s", table, name, strings.Join(names, ", "))
+		}
+		selected = append(selected, columns[index])
+	}
+	return selected, nil
+}
+
+// Fill values with the value of each column for galaxy and star, taking values out of
+// pointers and leaving nil for null
+func rowValues(values []any, columns []column, galaxy galaxypkg.Galaxy, star *starpkg.Star) {
+	galaxy_value := reflect.ValueOf(galaxy)
+	var star_value reflect.Value
+	if star != nil {
+		star_value = reflect.ValueOf(*star)
+	}
+
+	for i, column := range columns {
+		var field reflect.Value
+		if column.galaxy {
+			field = galaxy_value.Field(column.index)
+		} else {
+			field = star_value.Field(column.index)
+		}
+
+		values[i] = nil
+		if field.Kind() != reflect.Pointer {
+			values[i] = field.Interface()
+		} else if !field.IsNil() {
+			values[i] = field.Elem().Interface()
+		}
+	}
+}
+
+// Wrap w in a compressor, or return nil if compression is empty
+func compress(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "":
+		return nil, nil
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unknown compression %q", compression)
+}
@@ -0,0 +1,128 @@
+// Tests for Export
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"star-catalog/memstore"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// TestExportTables exports each table, with and without a galaxy, and checks the CSV
+func TestExportTables(t *testing.T) {
+	store := memstore.NewTestStore()
+
+	tests := []struct {
+		options Options
+		want    string
+	}{
+		{Options{Table: Galaxies, Columns: []string{"ugc_number", "ra"}},
+			"ugc_number,ra\nugc_number1,\nugc_number2,10.6847\n"},
+		{Options{Columns: []string{"name", "gaia_catalogue_id"}},
+			"name,gaia_catalogue_id\nSun,gaia_catalogue_id1\nAlpha Centauri,gaia_catalogue_id2\nStar3,gaia_catalogue_id3\n"},
+		{Options{Table: Joined, Galaxy: "ugc_number2", Columns: []string{"name", "ra", "galaxy_name", "galaxy_dec"}},
+			"name,ra,galaxy_name,galaxy_dec\nStar3,10.6847,Andromeda,41.269\n"},
+	}
+
+	for _, test := range tests {
+		var buffer bytes.Buffer
+		result, err := Export(context.Background(), &buffer, store, store, test.options)
+		if err != nil {
+			t.Fatalf(`Export %+v %v`, test.options, err)
+		}
+		if buffer.String() != test.want {
+			t.Fatalf(`Export %+v should write %q, is %q`, test.options, test.want, buffer.String())
+		}
+		if want := int64(strings.Count(test.want, "\n") - 1); result.Rows != want {
+			t.Fatalf(`Export %+v rows should be %d, is %d`, test.options, want, result.Rows)
+		}
+	}
+}
+
+// TestExportAllColumns checks the header of the joined view, which has the galaxy's
+// columns other than id
+func TestExportAllColumns(t *testing.T) {
+	var buffer bytes.Buffer
+	store := memstore.NewTestStore()
+	if _, err := Export(context.Background(), &buffer, store, store, Options{Table: Joined}); err != nil {
+		t.Fatalf(`Export %v`, err)
+	}
+
+	header, _, _ := strings.Cut(buffer.String(), "\n")
+	if !strings.HasPrefix(header, "id,galaxy_id,name,") || !strings.Contains(header, ",galaxy_name,galaxy_ugc_number,") || strings.Contains(header, "galaxy_id,galaxy_id") {
+		t.Fatalf(`Joined header should have the star columns then the galaxy columns, is %s`, header)
+	}
+	if strings.Count(header, ",") != 15+13-1 {
+		t.Fatalf(`Joined header should have %d columns, is %s`, 15+13, header)
+	}
+}
+
+// TestExportErrors checks unknown tables, columns, formats and galaxies
+func TestExportErrors(t *testing.T) {
+	store := memstore.NewTestStore()
+
+	tests := []Options{
+		{Table: "planets"},
+		{Columns: []string{"name", "colour"}},
+		{Table: Galaxies, Columns: []string{"galaxy_name"}},
+		{Format: "xlsx"},
+		{Compression: "bzip2"},
+	}
+	for _, options := range tests {
+		if _, err := Export(context.Background(), io.Discard, store, store, options); err == nil {
+			t.Fatalf(`Export %+v should fail`, options)
+		}
+	}
+
+	_, err := Export(context.Background(), io.Discard, store, store, Options{Galaxy: "ugc_number9"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf(`Export of a missing galaxy should be sql.ErrNoRows, is %v`, err)
+	}
+}
+
+// TestExportCompression exports NDJSON with each compression, and decompresses it
+func TestExportCompression(t *testing.T) {
+	store := memstore.NewTestStore()
+
+	for _, compression := range []string{Gzip, Zstd} {
+		var buffer bytes.Buffer
+		options := Options{Format: NDJSON, Compression: compression, Galaxy: "ugc_number2", Columns: []string{"name"}}
+		if _, err := Export(context.Background(), &buffer, store, store, options); err != nil {
+			t.Fatalf(`Export %v`, err)
+		}
+
+		var reader io.Reader
+		var err error
+		if compression == Gzip {
+			reader, err = gzip.NewReader(&buffer)
+		} else {
+			reader, err = zstd.NewReader(&buffer)
+		}
+		if err != nil {
+			t.Fatalf(`%s reader %v`, compression, err)
+		}
+		got, err := io.ReadAll(reader)
+		if want := "{\"name\":\"Star3\"}\n"; string(got) != want || err != nil {
+			t.Fatalf(`%s export should be %q, is %q, %v`, compression, want, got, err)
+		}
+	}
+}
+
+// TestExportCancel checks that a cancelled context stops the export
+func TestExportCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	store := memstore.NewTestStore()
+	if _, err := Export(ctx, io.Discard, store, store, Options{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf(`Export should be context.Canceled, is %v`, err)
+	}
+}
@@ -0,0 +1,201 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"time"
+
+	"star-catalog/votable"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// csvWriter writes a header line of column names, then a line for each row. Nulls are
+// empty, and timestamps are RFC 3339 in UTC.
+type csvWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []column) (*csvWriter, error) {
+	writer := &csvWriter{writer: csv.NewWriter(w), record: make([]string, len(columns))}
+	for i, column := range columns {
+		writer.record[i] = column.name
+	}
+	if err := writer.writer.Write(writer.record); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *csvWriter) Write(values []any) error {
+	for i, value := range values {
+		writer.record[i] = formatValue(value)
+	}
+	return writer.writer.Write(writer.record)
+}
+
+func (writer *csvWriter) Close() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+// Format a value as CSV text, keeping floats exact
+func formatValue(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
+
+// ndjsonWriter writes each row as a JSON object on its own line, with the keys in column
+// order. Nulls are null.
+type ndjsonWriter struct {
+	writer *bufio.Writer
+	// The column names as JSON strings followed by a colon
+	keys []string
+	line []byte
+}
+
+func newNDJSONWriter(w io.Writer, columns []column) (*ndjsonWriter, error) {
+	writer := &ndjsonWriter{writer: bufio.NewWriter(w), keys: make([]string, len(columns))}
+	for i, column := range columns {
+		key, err := json.Marshal(column.name)
+		if err != nil {
+			return nil, err
+		}
+		writer.keys[i] = string(key) + ":"
+	}
+	return writer, nil
+}
+
+func (writer *ndjsonWriter) Write(values []any) error {
+	line := append(writer.line[:0], '{')
+	for i, value := range values {
+		if i > 0 {
+			line = append(line, ',')
+		}
+		line = append(line, writer.keys[i]...)
+
+		if t, ok := value.(time.Time); ok {
+			value = t.UTC()
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		line = append(line, encoded...)
+	}
+	line = append(line, '}', '\n')
+
+	writer.line = line
+	_, err := writer.writer.Write(line)
+	return err
+}
+
+func (writer *ndjsonWriter) Close() error {
+	return writer.writer.Flush()
+}
+
+// parquetWriter writes rows through a struct type made from the columns, so that the Parquet
+// schema has the columns in order. Pointer fields are optional columns, and timestamps are
+// UTC timestamps.
+type parquetWriter struct {
+	writer *parquet.Writer
+	row    reflect.Value
+}
+
+func newParquetWriter(w io.Writer, columns []column, compression string) (*parquetWriter, error) {
+	fields := make([]reflect.StructField, len(columns))
+	for i, column := range columns {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Column%d", i),
+			Type: column.typ,
+			Tag:  reflect.StructTag(fmt.Sprintf(`parquet:%q`, column.name)),
+		}
+	}
+	row := reflect.New(reflect.StructOf(fields))
+
+	options := []parquet.WriterOption{parquet.SchemaOf(row.Interface())}
+	switch compression {
+	case "":
+	case Gzip:
+		options = append(options, parquet.Compression(&parquet.Gzip))
+	case Zstd:
+		options = append(options, parquet.Compression(&parquet.Zstd))
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+
+	return &parquetWriter{writer: parquet.NewWriter(w, options...), row: row}, nil
+}
+
+func (writer *parquetWriter) Write(values []any) error {
+	row := writer.row.Elem()
+	for i, value := range values {
+		field := row.Field(i)
+		switch {
+		case value == nil:
+			field.SetZero()
+		case field.Kind() == reflect.Pointer:
+			pointer := reflect.New(field.Type().Elem())
+			pointer.Elem().Set(reflect.ValueOf(value))
+			field.Set(pointer)
+		default:
+			field.Set(reflect.ValueOf(value))
+		}
+	}
+	return writer.writer.Write(writer.row.Interface())
+}
+
+func (writer *parquetWriter) Close() error {
+	return writer.writer.Close()
+}
+
+// votableWriter writes a VOTable with one table, in BINARY2 serialization. The fields are
+// made by votable.FieldsOf from a struct type made from the columns, as for Parquet, so the
+// datatypes, UCDs and units are the ones the columns' own fields would have.
+type votableWriter struct {
+	writer *votable.Writer
+}
+
+func newVOTableWriter(w io.Writer, columns []column, table string) (*votableWriter, error) {
+	fields := make([]reflect.StructField, len(columns))
+	for i, column := range columns {
+		fields[i] = reflect.StructField{
+			Name: fmt.Sprintf("Column%d", i),
+			Type: column.typ,
+			Tag:  reflect.StructTag(fmt.Sprintf(`db:%q ucd:%q unit:%q`, column.name, column.ucd, column.unit)),
+		}
+	}
+	votable_fields, err := votable.FieldsOf(reflect.New(reflect.StructOf(fields)).Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	writer, err := votable.NewWriter(w, table, votable_fields, votable.Binary2)
+	if err != nil {
+		return nil, err
+	}
+	return &votableWriter{writer: writer}, nil
+}
+
+func (writer *votableWriter) Write(values []any) error {
+	return writer.writer.WriteRow(values...)
+}
+
+func (writer *votableWriter) Close() error {
+	return writer.writer.Close()
+}
@@ -0,0 +1,153 @@
+// Tests for the CSV, NDJSON, Parquet and VOTable writers
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"star-catalog/galaxy"
+	"star-catalog/memstore"
+	"star-catalog/star"
+	"star-catalog/votable"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// TestFormatValue checks that CSV values are exact, and nulls empty
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{nil, ""},
+		{int64(-42), "-42"},
+		{1.0 / 3, "0.3333333333333333"},
+		{1e-20, "1e-20"},
+		{"Alpha, Centauri", "Alpha, Centauri"},
+		{time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60)), "2024-05-01T10:30:00Z"},
+	}
+
+	for _, test := range tests {
+		if got := formatValue(test.value); got != test.want {
+			t.Fatalf(`formatValue %v should be %q, is %q`, test.value, test.want, got)
+		}
+	}
+}
+
+// TestNDJSON checks that each line is a JSON object with the keys in column order
+func TestNDJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	store := memstore.NewTestStore()
+	options := Options{Format: NDJSON, Galaxy: "ugc_number2", Columns: []string{"ra", "name", "dec"}}
+	if _, err := Export(context.Background(), &buffer, store, store, options); err != nil {
+		t.Fatalf(`Export %v`, err)
+	}
+
+	if want := "{\"ra\":10.6847,\"name\":\"Star3\",\"dec\":null}\n"; buffer.String() != want {
+		t.Fatalf(`NDJSON should be %q, is %q`, want, buffer.String())
+	}
+
+	var decoded map[string]any
+	if err := json.Unmarshal(buffer.Bytes(), &decoded); err != nil {
+		t.Fatalf(`NDJSON should be valid JSON, %v`, err)
+	}
+}
+
+// parquetStar is how a reader sees the selected Star columns
+type parquetStar struct {
+	Name      string    `parquet:"name"`
+	Ra        *float64  `parquet:"ra,optional"`
+	Dec       *float64  `parquet:"dec,optional"`
+	CreatedAt time.Time `parquet:"created_at"`
+	GalaxyRa  *float64  `parquet:"galaxy_ra,optional"`
+}
+
+// TestParquet exports joined stars to Parquet with each compression, and reads them back
+func TestParquet(t *testing.T) {
+	created_at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	store := memstore.New()
+	ra := 10.6847
+	galaxy_id := store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number2", Name: "Andromeda", Ra: &ra})
+	store.AddStar(star.Star{GalaxyId: galaxy_id, Name: "Star3", Ra: &ra, CreatedAt: created_at})
+	store.AddStar(star.Star{GalaxyId: galaxy_id, Name: "Star4"})
+
+	for _, compression := range []string{"", Gzip, Zstd} {
+		var buffer bytes.Buffer
+		options := Options{Table: Joined, Format: Parquet, Compression: compression, Columns: []string{"name", "ra", "dec", "created_at", "galaxy_ra"}}
+		if _, err := Export(context.Background(), &buffer, store, store, options); err != nil {
+			t.Fatalf(`Export %v`, err)
+		}
+		if !bytes.HasPrefix(buffer.Bytes(), []byte("PAR1")) {
+			t.Fatalf(`Parquet file should start with PAR1, is %q`, buffer.Bytes()[:4])
+		}
+
+		file, err := parquet.OpenFile(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+		if err != nil {
+			t.Fatalf(`OpenFile %v`, err)
+		}
+		var names []string
+		for _, field := range file.Schema().Fields() {
+			names = append(names, field.Name())
+		}
+		if got := strings.Join(names, ","); got != "name,ra,dec,created_at,galaxy_ra" {
+			t.Fatalf(`Parquet columns should be in the order given, are %s`, got)
+		}
+
+		rows, err := parquet.Read[parquetStar](bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+		if err != nil {
+			t.Fatalf(`Read %v`, err)
+		}
+		if len(rows) != 2 || rows[0].Name != "Star3" || *rows[0].Ra != ra || rows[0].Dec != nil || !rows[0].CreatedAt.Equal(created_at) {
+			t.Fatalf(`Parquet %q rows should be Star3 and Star4, are %+v`, compression, rows)
+		}
+		if rows[1].Ra != nil || rows[1].GalaxyRa == nil || *rows[1].GalaxyRa != ra {
+			t.Fatalf(`Parquet %q Star4 should have a null ra and the galaxy's ra, is %+v`, compression, rows[1])
+		}
+	}
+}
+
+// TestVOTable exports joined stars to a VOTable, and reads them back with votable.Reader,
+// checking the UCDs and units, and that the galaxy's position isn't the main one
+func TestVOTable(t *testing.T) {
+	store := memstore.New()
+	ra := 10.6847
+	galaxy_id := store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number2", Name: "Andromeda", Ra: &ra})
+	store.AddStar(star.Star{GalaxyId: galaxy_id, Name: "Star3", Ra: &ra})
+	store.AddStar(star.Star{GalaxyId: galaxy_id, Name: "Star4"})
+
+	var buffer bytes.Buffer
+	options := Options{Table: Joined, Format: VOTable, Columns: []string{"name", "ra", "galaxy_ra"}}
+	if _, err := Export(context.Background(), &buffer, store, store, options); err != nil {
+		t.Fatalf(`Export %v`, err)
+	}
+
+	reader, err := votable.NewReader(&buffer)
+	if err != nil {
+		t.Fatalf(`NewReader %v`, err)
+	}
+	fields := reader.Fields()
+	if len(fields) != 3 || fields[1].UCD != "pos.eq.ra;meta.main" || fields[1].Unit != "deg" || fields[2].UCD != "pos.eq.ra" || fields[2].Datatype != "double" {
+		t.Fatalf(`VOTable fields should be name, ra and galaxy_ra with their UCDs and units, are %+v`, fields)
+	}
+
+	var rows [][]any
+	for {
+		row, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf(`Next %v`, err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != 2 || rows[0][0] != "Star3" || rows[0][1] != ra || rows[1][1] != nil || rows[1][2] != ra {
+		t.Fatalf(`VOTable rows should be Star3 and Star4 with a null ra, are %v`, rows)
+	}
+}
@@ -0,0 +1,114 @@
+package fits
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	galaxypkg "star-catalog/galaxy"
+	starpkg "star-catalog/star"
+)
+
+// An ExportResult counts the rows written by Export.
+type ExportResult struct {
+	Galaxies int64
+	Stars    int64
+}
+
+// Export writes a FITS file to w with two BINTABLE extensions: GALAXIES, with a row for each
+// galaxy, and STARS, with a row for each of their stars. If ugc_number isn't empty only that
+// galaxy and its stars are written, otherwise the whole catalog is.
+// Stars are streamed a galaxy at a time from star.GalaxyStarChannel, so only the galaxies
+// are held in memory. The stars' galaxy_id column matches the galaxies' id column.
+func Export(ctx context.Context, w io.WriteSeeker, galaxies galaxypkg.GalaxyStore, stars starpkg.StarStore, ugc_number string) (ExportResult, error) {
+	var result ExportResult
+
+	var selected []galaxypkg.Galaxy
+	if ugc_number != "" {
+		galaxy, err := galaxies.FindGalaxy(ctx, ugc_number)
+		if err != nil {
+			return result, fmt.Errorf("Export: %w", err)
+		}
+		selected = append(selected, galaxy)
+	} else {
+		err := galaxies.EachGalaxy(ctx, func(galaxy galaxypkg.Galaxy) error {
+			selected = append(selected, galaxy)
+			return nil
+		})
+		if err != nil {
+			return result, fmt.Errorf("Export: %v", err)
+		}
+	}
+
+	file, err := NewFile(w)
+	if err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+
+	galaxy_columns, err := ColumnsOf(galaxypkg.Galaxy{})
+	if err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+	galaxy_table, err := file.NewTable("GALAXIES", galaxy_columns)
+	if err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+	for _, galaxy := range selected {
+		if err := galaxy_table.WriteStruct(galaxy); err != nil {
+			return result, fmt.Errorf("Export galaxy %s: %v", galaxy.UgcNumber, err)
+		}
+	}
+	if err := galaxy_table.Close(); err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+	result.Galaxies = galaxy_table.Rows()
+
+	star_columns, err := ColumnsOf(starpkg.Star{})
+	if err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+	star_table, err := file.NewTable("STARS", star_columns)
+	if err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+	for _, galaxy := range selected {
+		if err := writeGalaxyStars(ctx, star_table, stars, galaxy); err != nil {
+			return result, fmt.Errorf("Export galaxy %s: %v", galaxy.UgcNumber, err)
+		}
+	}
+	if err := star_table.Close(); err != nil {
+		return result, fmt.Errorf("Export: %v", err)
+	}
+	result.Stars = star_table.Rows()
+
+	return result, nil
+}
+
+// Write the stars of one galaxy to table as they arrive from GalaxyStarChannel
+func writeGalaxyStars(ctx context.Context, table *Table, stars starpkg.StarStore, galaxy galaxypkg.Galaxy) error {
+	// Cancelling stops the producer if a row can't be written
+	galaxy_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	star_channel := make(chan starpkg.Star)
+	error_channel := make(chan error, 1)
+	go func() {
+		error_channel <- starpkg.GalaxyStarChannel(galaxy_ctx, stars, galaxy, star_channel)
+	}()
+
+	var write_err error
+	for star := range star_channel {
+		if write_err != nil {
+			continue
+		}
+		if write_err = table.WriteStruct(star); write_err != nil {
+			cancel()
+		}
+	}
+
+	err := <-error_channel
+	if write_err != nil {
+		return write_err
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+// Tests for Export
+package fits
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"star-catalog/memstore"
+	"star-catalog/star"
+)
+
+// TestExport exports the whole catalog and one galaxy, and checks the tables
+func TestExport(t *testing.T) {
+	store := memstore.NewTestStore()
+
+	tests := []struct {
+		ugc_number string
+		galaxies   int64
+		stars      int64
+	}{
+		{"", 2, 3},
+		{"ugc_number2", 1, 1},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "catalog.fits")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := Export(context.Background(), file, store, store, test.ugc_number)
+		file.Close()
+		if err != nil {
+			t.Fatalf(`Export %v`, err)
+		}
+		if result.Galaxies != test.galaxies || result.Stars != test.stars {
+			t.Fatalf(`Export %q should write %d galaxies and %d stars, is %+v`, test.ugc_number, test.galaxies, test.stars, result)
+		}
+
+		hdus := readFITS(t, path)
+		if len(hdus) != 3 || hdus[1].keywords["EXTNAME"] != "GALAXIES" || hdus[2].keywords["EXTNAME"] != "STARS" {
+			t.Fatalf(`Export should write GALAXIES and STARS tables, is %d HDUs`, len(hdus))
+		}
+		if hdus[1].keywords["TUNIT14"] != "Mpc" {
+			t.Fatalf(`Galaxy distance unit should be Mpc, is %s`, hdus[1].keywords["TUNIT14"])
+		}
+
+		// Each star's galaxy_id, the second column, should be an exported galaxy's id
+		ids := map[uint64]bool{}
+		galaxies := hdus[1]
+		for i := 0; i < len(galaxies.data); i += len(galaxies.data) / int(test.galaxies) {
+			ids[binary.BigEndian.Uint64(galaxies.data[i:])] = true
+		}
+		stars := hdus[2]
+		for i := 0; i < len(stars.data); i += len(stars.data) / int(test.stars) {
+			if galaxy_id := binary.BigEndian.Uint64(stars.data[i+8:]); !ids[galaxy_id] {
+				t.Fatalf(`Star galaxy_id %d should be an exported galaxy, is not in %v`, galaxy_id, ids)
+			}
+		}
+	}
+}
+
+// TestExportMissingGalaxy checks that an unknown ugc_number is sql.ErrNoRows
+func TestExportMissingGalaxy(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "missing.fits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = Export(context.Background(), file, memstore.NewTestStore(), memstore.NewTestStore(), "ugc_number9")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf(`Export of a missing galaxy should be sql.ErrNoRows, is %v`, err)
+	}
+}
+
+// TestExportStarError checks that a star that can't be written stops the export
+func TestExportStarError(t *testing.T) {
+	store := memstore.NewTestStore()
+	store.AddStar(star.Star{GalaxyId: 1, Name: string(make([]byte, DefaultStringWidth+1))})
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "long.fits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, err := Export(context.Background(), file, store, store, "ugc_number1"); err == nil {
+		t.Fatalf(`Export should fail for a name longer than %d bytes`, DefaultStringWidth)
+	}
+}
@@ -0,0 +1,160 @@
+// Package fits writes FITS files with binary table (BINTABLE) extensions, in pure Go.
+// A File starts with an empty primary HDU, and tables are added to it one at a time.
+// Rows are written as they come, and each table's row count is patched into its header
+// when the table is closed, so a table can be larger than memory.
+// Columns are usually the db tagged fields of a struct such as star.Star, with units from
+// their unit tags. Export writes galaxies and their stars this way.
+// See https://fits.gsfc.nasa.gov/fits_standard.html for the format.
+package fits
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// blockSize is the size of a FITS block. Headers and data are padded to a whole number of blocks.
+const blockSize = 2880
+
+// cardSize is the size of a header card
+const cardSize = 80
+
+// DefaultStringWidth is the number of bytes given to string columns by ColumnsOf.
+// FITS binary tables have fixed width strings, and longer values are an error.
+const DefaultStringWidth = 64
+
+// timestampLayout is how time.Time values are written, always in UTC
+const timestampLayout = "2006-01-02T15:04:05Z"
+
+// A Column is a column of a binary table.
+type Column struct {
+	// Name is the TTYPE of the column
+	Name string
+	// Format is the TFORM of the column: K for 64-bit integers, D for doubles, L for
+	// logicals, or nA for strings of n bytes
+	Format string
+	// Unit is the TUNIT of the column, if it has one
+	Unit string
+	// Null is the TNULL value that marks a null integer. Null doubles are NaN.
+	Null *int64
+}
+
+// ColumnsOf returns a Column for each db tagged field of v, which is a struct or a pointer
+// to one, in field order. Integers are K, floats D, bools L, and strings
+// DefaultStringWidth A. time.Time is written as a string like 2024-05-01T12:30:00Z.
+// Nullable integer fields, which are pointers, get a TNULL of the smallest int64.
+func ColumnsOf(v any) ([]Column, error) {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ColumnsOf: %T is not a struct", v)
+	}
+
+	var columns []Column
+	for i := 0; i < t.NumField(); i++ {
+		struct_field := t.Field(i)
+		name, ok := struct_field.Tag.Lookup("db")
+		if !ok || name == "-" {
+			continue
+		}
+
+		column := Column{Name: name, Unit: struct_field.Tag.Get("unit")}
+
+		field_type := struct_field.Type
+		nullable := field_type.Kind() == reflect.Pointer
+		if nullable {
+			field_type = field_type.Elem()
+		}
+		switch {
+		case field_type == reflect.TypeOf(time.Time{}):
+			column.Format = strconv.Itoa(len(timestampLayout)) + "A"
+		case field_type.Kind() == reflect.String:
+			column.Format = strconv.Itoa(DefaultStringWidth) + "A"
+		case field_type.Kind() == reflect.Bool:
+			column.Format = "L"
+		case field_type.Kind() >= reflect.Int && field_type.Kind() <= reflect.Int64:
+			column.Format = "K"
+			if nullable {
+				null := int64(math.MinInt64)
+				column.Null = &null
+			}
+		case field_type.Kind() == reflect.Float32 || field_type.Kind() == reflect.Float64:
+			column.Format = "D"
+		default:
+			return nil, fmt.Errorf("ColumnsOf: %s has unsupported type %s", name, struct_field.Type)
+		}
+
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// Return the number of bytes a column takes in each row, or an error if its format isn't
+// one that Table can write
+func (column Column) width() (int, error) {
+	switch column.Format {
+	case "K", "D":
+		return 8, nil
+	case "L":
+		return 1, nil
+	}
+
+	if count, ok := strings.CutSuffix(column.Format, "A"); ok {
+		if n, err := strconv.Atoi(count); err == nil && n > 0 {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("column %s: TFORM %q isn't supported", column.Name, column.Format)
+}
+
+// Format a header card with a value that is already formatted, padded to 80 characters.
+// Comments that don't fit are cut short.
+func card(keyword string, value string, comment string) string {
+	text := fmt.Sprintf("%-8s= %s", keyword, value)
+	if comment != "" {
+		text += " / " + comment
+	}
+	if len(text) > cardSize {
+		text = text[:cardSize]
+	}
+	return fmt.Sprintf("%-80s", text)
+}
+
+// Format an integer card value, right justified in columns 11 to 30
+func intValue(n int64) string {
+	return fmt.Sprintf("%20d", n)
+}
+
+// Format a logical card value, right justified in columns 11 to 30
+func boolValue(b bool) string {
+	if b {
+		return fmt.Sprintf("%20s", "T")
+	}
+	return fmt.Sprintf("%20s", "F")
+}
+
+// Format a string card value: quoted, with quotes doubled and at least 8 characters
+func stringValue(s string) string {
+	return "'" + fmt.Sprintf("%-8s", strings.ReplaceAll(s, "'", "''")) + "'"
+}
+
+// Join header cards, ending them with END and padding them to a whole number of blocks
+func header(cards []string) []byte {
+	text := strings.Join(cards, "") + fmt.Sprintf("%-80s", "END")
+	return append([]byte(text), padding(len(text), ' ')...)
+}
+
+// Return the fill needed to bring size up to a whole number of blocks
+func padding(size int, fill byte) []byte {
+	remainder := size % blockSize
+	if remainder == 0 {
+		return nil
+	}
+	return []byte(strings.Repeat(string(fill), blockSize-remainder))
+}
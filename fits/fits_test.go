@@ -0,0 +1,77 @@
+// Tests for ColumnsOf and header cards
+package fits
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"star-catalog/galaxy"
+	"star-catalog/star"
+)
+
+// TestColumnsOf checks the formats, units and nulls of the Star columns
+func TestColumnsOf(t *testing.T) {
+	columns, err := ColumnsOf(&star.Star{})
+	if err != nil {
+		t.Fatalf(`ColumnsOf %v`, err)
+	}
+
+	want := map[string]Column{
+		"id":         {Name: "id", Format: "K"},
+		"name":       {Name: "name", Format: "64A"},
+		"created_at": {Name: "created_at", Format: "20A"},
+		"pmra":       {Name: "pmra", Format: "D", Unit: "mas/yr"},
+	}
+	for _, column := range columns {
+		if want, ok := want[column.Name]; ok && column != want {
+			t.Fatalf(`Column %s should be %+v, is %+v`, column.Name, want, column)
+		}
+	}
+	if len(columns) != 15 {
+		t.Fatalf(`Star columns should be %d, is %d`, 15, len(columns))
+	}
+
+	type nullable struct {
+		Count *int `db:"count"`
+	}
+	columns, err = ColumnsOf(nullable{})
+	if err != nil || columns[0].Null == nil || *columns[0].Null != math.MinInt64 {
+		t.Fatalf(`Nullable integer should have TNULL %d, is %+v, %v`, int64(math.MinInt64), columns, err)
+	}
+
+	if _, err := ColumnsOf(galaxy.Galaxy{}); err != nil {
+		t.Fatalf(`ColumnsOf Galaxy %v`, err)
+	}
+	if _, err := ColumnsOf(struct {
+		Tags []string `db:"tags"`
+	}{}); err == nil {
+		t.Fatalf(`ColumnsOf should fail for a slice field`)
+	}
+}
+
+// TestCard checks that cards are 80 characters, with values where the standard puts them
+func TestCard(t *testing.T) {
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{card("NAXIS2", intValue(42), ""), "NAXIS2  =                   42"},
+		{card("SIMPLE", boolValue(true), ""), "SIMPLE  =                    T"},
+		{card("TTYPE1", stringValue("id"), ""), "TTYPE1  = 'id      '"},
+		{card("EXTNAME", stringValue("O'Brien"), "owner"), "EXTNAME = 'O''Brien' / owner"},
+	}
+
+	for _, test := range tests {
+		if len(test.got) != cardSize {
+			t.Fatalf(`Card %q should be %d characters, is %d`, test.got, cardSize, len(test.got))
+		}
+		if strings.TrimRight(test.got, " ") != test.want {
+			t.Fatalf(`Card should be %q, is %q`, test.want, test.got)
+		}
+	}
+
+	if got := len(header([]string{card("SIMPLE", boolValue(true), "")})); got != blockSize {
+		t.Fatalf(`Header should be %d bytes, is %d`, blockSize, got)
+	}
+}
@@ -0,0 +1,251 @@
+package fits
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// A File writes a FITS file: a primary HDU with no data, followed by binary tables.
+type File struct {
+	writer io.WriteSeeker
+	table  *Table
+}
+
+// A Table writes the rows of a BINTABLE extension. It is created by File.NewTable, and must
+// be closed before the next table is started.
+type Table struct {
+	file    *File
+	buffer  *bufio.Writer
+	columns []Column
+	widths  []int
+	row     []byte
+	rows    int64
+	bytes   int64
+
+	// Where the NAXIS2 value is in the file, to be filled in by Close
+	naxis2_offset int64
+}
+
+// NewFile writes the primary header to w, which must be seekable so that the row counts of
+// tables can be filled in when they are closed. An *os.File will do.
+func NewFile(w io.WriteSeeker) (*File, error) {
+	cards := []string{
+		card("SIMPLE", boolValue(true), "conforms to FITS standard"),
+		card("BITPIX", intValue(8), "array data type"),
+		card("NAXIS", intValue(0), "no primary data"),
+		card("EXTEND", boolValue(true), "extensions follow"),
+		card("ORIGIN", stringValue("star-catalog"), "written by"),
+	}
+	if _, err := w.Write(header(cards)); err != nil {
+		return nil, fmt.Errorf("NewFile: %v", err)
+	}
+
+	return &File{writer: w}, nil
+}
+
+// NewTable starts a BINTABLE extension called extname, with the given columns.
+func (file *File) NewTable(extname string, columns []Column) (*Table, error) {
+	if file.table != nil {
+		return nil, errors.New("NewTable: the previous table hasn't been closed")
+	}
+
+	table := &Table{file: file, columns: columns}
+	row_width := 0
+	for _, column := range columns {
+		width, err := column.width()
+		if err != nil {
+			return nil, fmt.Errorf("NewTable: %v", err)
+		}
+		table.widths = append(table.widths, width)
+		row_width += width
+	}
+
+	cards := []string{
+		card("XTENSION", stringValue("BINTABLE"), "binary table extension"),
+		card("BITPIX", intValue(8), "8-bit bytes"),
+		card("NAXIS", intValue(2), "2-dimensional table"),
+		card("NAXIS1", intValue(int64(row_width)), "width of a row in bytes"),
+		card("NAXIS2", intValue(0), "number of rows"),
+		card("PCOUNT", intValue(0), "no heap"),
+		card("GCOUNT", intValue(1), "one group"),
+		card("TFIELDS", intValue(int64(len(columns))), "number of columns"),
+	}
+	// NAXIS2 is the fifth card, and its value starts after "NAXIS2  = "
+	naxis2_card := 4
+
+	for i, column := range columns {
+		n := strconv.Itoa(i + 1)
+		cards = append(cards, card("TTYPE"+n, stringValue(column.Name), ""))
+		cards = append(cards, card("TFORM"+n, stringValue(column.Format), ""))
+		if column.Unit != "" {
+			cards = append(cards, card("TUNIT"+n, stringValue(column.Unit), ""))
+		}
+		if column.Null != nil {
+			cards = append(cards, card("TNULL"+n, intValue(*column.Null), "null value"))
+		}
+	}
+	cards = append(cards, card("EXTNAME", stringValue(extname), "name of this table"))
+
+	start, err := file.writer.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("NewTable: %v", err)
+	}
+	if _, err := file.writer.Write(header(cards)); err != nil {
+		return nil, fmt.Errorf("NewTable: %v", err)
+	}
+
+	table.naxis2_offset = start + int64(naxis2_card*cardSize) + 10
+	table.buffer = bufio.NewWriter(file.writer)
+	table.row = make([]byte, 0, row_width)
+	file.table = table
+
+	return table, nil
+}
+
+// WriteStruct writes a row with the values of the db tagged fields of v, which is a struct
+// or a pointer to one, such as a star.Star. Its columns should be the ones ColumnsOf returns.
+func (table *Table) WriteStruct(v any) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	indexes := map[string]int{}
+	for i := 0; i < value.NumField(); i++ {
+		if name, ok := value.Type().Field(i).Tag.Lookup("db"); ok && name != "-" {
+			indexes[name] = i
+		}
+	}
+
+	values := make([]any, len(table.columns))
+	for i, column := range table.columns {
+		index, ok := indexes[column.Name]
+		if !ok {
+			return fmt.Errorf("WriteStruct: %T has no %s field", v, column.Name)
+		}
+		values[i] = value.Field(index).Interface()
+	}
+
+	return table.WriteRow(values...)
+}
+
+// WriteRow writes a row with one value for each column. Values can be integers, floats,
+// strings, bools or time.Time, or pointers to them; nil and nil pointers are written as null.
+// Strings longer than their column are an error.
+func (table *Table) WriteRow(values ...any) error {
+	if len(values) != len(table.columns) {
+		return fmt.Errorf("WriteRow: %d values for %d columns", len(values), len(table.columns))
+	}
+
+	row := table.row[:0]
+	for i, value := range values {
+		reflected := reflect.ValueOf(value)
+		if reflected.Kind() == reflect.Pointer {
+			value = nil
+			if !reflected.IsNil() {
+				value = reflected.Elem().Interface()
+			}
+		}
+
+		var err error
+		row, err = appendValue(row, table.columns[i], table.widths[i], value)
+		if err != nil {
+			return fmt.Errorf("WriteRow: %v", err)
+		}
+	}
+
+	if _, err := table.buffer.Write(row); err != nil {
+		return fmt.Errorf("WriteRow: %v", err)
+	}
+	table.row = row
+	table.rows++
+	table.bytes += int64(len(row))
+	return nil
+}
+
+// Rows returns the number of rows written so far.
+func (table *Table) Rows() int64 {
+	return table.rows
+}
+
+// Close pads the table's data to a whole number of blocks, and fills in its row count.
+func (table *Table) Close() error {
+	table.buffer.Write(padding(int(table.bytes%blockSize), 0))
+	if err := table.buffer.Flush(); err != nil {
+		return fmt.Errorf("Close: %v", err)
+	}
+
+	writer := table.file.writer
+	end, err := writer.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("Close: %v", err)
+	}
+	if _, err := writer.Seek(table.naxis2_offset, io.SeekStart); err != nil {
+		return fmt.Errorf("Close: %v", err)
+	}
+	if _, err := writer.Write([]byte(intValue(table.rows))); err != nil {
+		return fmt.Errorf("Close: %v", err)
+	}
+	if _, err := writer.Seek(end, io.SeekStart); err != nil {
+		return fmt.Errorf("Close: %v", err)
+	}
+
+	table.file.table = nil
+	return nil
+}
+
+// Append the big-endian binary form of value to row
+func appendValue(row []byte, column Column, width int, value any) ([]byte, error) {
+	switch column.Format {
+	case "K":
+		if value == nil {
+			if column.Null == nil {
+				return row, fmt.Errorf("column %s: null value, and no TNULL", column.Name)
+			}
+			return binary.BigEndian.AppendUint64(row, uint64(*column.Null)), nil
+		}
+		reflected := reflect.ValueOf(value)
+		if reflected.CanInt() {
+			return binary.BigEndian.AppendUint64(row, uint64(reflected.Int())), nil
+		}
+	case "D":
+		if value == nil {
+			return binary.BigEndian.AppendUint64(row, math.Float64bits(math.NaN())), nil
+		}
+		reflected := reflect.ValueOf(value)
+		if reflected.CanFloat() {
+			return binary.BigEndian.AppendUint64(row, math.Float64bits(reflected.Float())), nil
+		}
+	case "L":
+		switch value {
+		case nil:
+			return append(row, 0), nil
+		case true:
+			return append(row, 'T'), nil
+		case false:
+			return append(row, 'F'), nil
+		}
+	default:
+		// An A column. Strings shorter than the column are padded with NULs, and null is all NULs
+		var text string
+		switch value := value.(type) {
+		case nil:
+		case string:
+			text = value
+		case time.Time:
+			text = value.UTC().Format(timestampLayout)
+		default:
+			return row, fmt.Errorf("column %s: can't write %T as %s", column.Name, value, column.Format)
+		}
+		if len(text) > width {
+			return row, fmt.Errorf("column %s: %q is longer than %d bytes", column.Name, text, width)
+		}
+		row = append(row, text...)
+		return append(row, make([]byte, width-len(text))...), nil
+	}
+
+	return row, fmt.Errorf("column %s: can't write %T as %s", column.Name, value, column.Format)
+}
@@ -0,0 +1,202 @@
+// Tests for File and Table, reading what they write with a minimal FITS parser
+package fits
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"star-catalog/star"
+)
+
+// An hdu is a header and data unit read back by readFITS
+type hdu struct {
+	keywords map[string]string
+	data     []byte
+}
+
+// Read the HDUs of a FITS file, checking that every header and data part is a whole number
+// of blocks. Values are kept as text, with string quotes removed.
+func readFITS(t *testing.T, path string) []hdu {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content)%blockSize != 0 {
+		t.Fatalf(`File should be whole blocks, is %d bytes`, len(content))
+	}
+
+	var hdus []hdu
+	for len(content) > 0 {
+		unit := hdu{keywords: map[string]string{}}
+		for {
+			text := string(content[:cardSize])
+			content = content[cardSize:]
+			keyword := strings.TrimSpace(text[:8])
+			if keyword == "END" {
+				break
+			}
+			if text[8:10] != "= " {
+				t.Fatalf(`Card %q should have a value indicator`, text)
+			}
+			value, _, _ := strings.Cut(text[10:], " /")
+			value = strings.TrimSpace(value)
+			if strings.HasPrefix(value, "'") {
+				value = strings.ReplaceAll(strings.TrimSpace(strings.Trim(value, "'")), "''", "'")
+			}
+			unit.keywords[keyword] = value
+		}
+		// Skip the rest of the header's last block
+		content = content[len(content)%blockSize:]
+
+		width, _ := strconv.Atoi(unit.keywords["NAXIS1"])
+		rows, _ := strconv.Atoi(unit.keywords["NAXIS2"])
+		size := width * rows
+		unit.data = content[:size]
+		content = content[size+len(padding(size, 0)):]
+
+		hdus = append(hdus, unit)
+	}
+
+	return hdus
+}
+
+// TestWriteTables writes two tables of stars, and checks the headers and the values
+func TestWriteTables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stars.fits")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	fits, err := NewFile(file)
+	if err != nil {
+		t.Fatalf(`NewFile %v`, err)
+	}
+	columns, err := ColumnsOf(star.Star{})
+	if err != nil {
+		t.Fatalf(`ColumnsOf %v`, err)
+	}
+
+	ra, parallax := 219.90085, 750.81
+	table, err := fits.NewTable("STARS", columns)
+	if err != nil {
+		t.Fatalf(`NewTable %v`, err)
+	}
+	// Enough rows to fill more than one block
+	for i := 0; i < 100; i++ {
+		s := star.Star{Id: int64(i + 1), GalaxyId: 1, Name: "Alpha Centauri", GaiaCatalogueId: "gaia_catalogue_id2",
+			CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.FixedZone("CEST", 2*60*60)), Ra: &ra, Parallax: &parallax}
+		if err := table.WriteStruct(s); err != nil {
+			t.Fatalf(`WriteStruct %v`, err)
+		}
+	}
+	if _, err := fits.NewTable("MORE", columns); err == nil {
+		t.Fatalf(`NewTable should fail while a table is open`)
+	}
+	if err := table.Close(); err != nil {
+		t.Fatalf(`Close %v`, err)
+	}
+
+	empty, err := fits.NewTable("EMPTY", columns[:1])
+	if err != nil {
+		t.Fatalf(`NewTable %v`, err)
+	}
+	if err := empty.Close(); err != nil {
+		t.Fatalf(`Close %v`, err)
+	}
+
+	hdus := readFITS(t, path)
+	if len(hdus) != 3 {
+		t.Fatalf(`HDUs should be %d, is %d`, 3, len(hdus))
+	}
+	if hdus[0].keywords["SIMPLE"] != "T" || hdus[0].keywords["NAXIS"] != "0" {
+		t.Fatalf(`Primary header should be empty, is %v`, hdus[0].keywords)
+	}
+
+	stars := hdus[1]
+	want := map[string]string{
+		"XTENSION": "BINTABLE", "EXTNAME": "STARS", "NAXIS1": "244", "NAXIS2": "100", "TFIELDS": "15",
+		"TTYPE3": "name", "TFORM3": "64A", "TTYPE6": "ra", "TFORM6": "D", "TUNIT6": "deg",
+	}
+	for keyword, value := range want {
+		if stars.keywords[keyword] != value {
+			t.Fatalf(`%s should be %s, is %s`, keyword, value, stars.keywords[keyword])
+		}
+	}
+	if hdus[2].keywords["NAXIS2"] != "0" || len(hdus[2].data) != 0 {
+		t.Fatalf(`EMPTY should have no rows, has %s`, hdus[2].keywords["NAXIS2"])
+	}
+
+	// The last row: id, then name at 16, created_at at 144, ra at 164 and dec at 172
+	row := stars.data[99*244:]
+	if got := int64(binary.BigEndian.Uint64(row)); got != 100 {
+		t.Fatalf(`id should be %d, is %d`, 100, got)
+	}
+	if got := strings.TrimRight(string(row[16:80]), "\x00"); got != "Alpha Centauri" {
+		t.Fatalf(`name should be %s, is %q`, "Alpha Centauri", got)
+	}
+	if got := string(row[144:164]); got != "2024-05-01T10:30:00Z" {
+		t.Fatalf(`created_at should be in UTC, is %s`, got)
+	}
+	if got := math.Float64frombits(binary.BigEndian.Uint64(row[164:])); got != ra {
+		t.Fatalf(`ra should be %v, is %v`, ra, got)
+	}
+	if got := math.Float64frombits(binary.BigEndian.Uint64(row[172:])); !math.IsNaN(got) {
+		t.Fatalf(`Null dec should be NaN, is %v`, got)
+	}
+}
+
+// TestWriteRowErrors checks that values that don't fit their columns are errors, and
+// that nullable integers use TNULL
+func TestWriteRowErrors(t *testing.T) {
+	file, err := os.Create(filepath.Join(t.TempDir(), "errors.fits"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	fits, err := NewFile(file)
+	if err != nil {
+		t.Fatalf(`NewFile %v`, err)
+	}
+	null := int64(-1)
+	table, err := fits.NewTable("T", []Column{{Name: "count", Format: "K", Null: &null}, {Name: "code", Format: "4A"}})
+	if err != nil {
+		t.Fatalf(`NewTable %v`, err)
+	}
+
+	if err := table.WriteRow(nil, "ABCDE"); err == nil || !strings.Contains(err.Error(), "longer than 4 bytes") {
+		t.Fatalf(`WriteRow should fail for a long string, is %v`, err)
+	}
+	if err := table.WriteRow(1.5, "A"); err == nil {
+		t.Fatalf(`WriteRow should fail for a float in a K column`)
+	}
+	if err := table.WriteRow(1); err == nil {
+		t.Fatalf(`WriteRow should fail for too few values`)
+	}
+	var count *int
+	if err := table.WriteRow(count, "ABCD"); err != nil {
+		t.Fatalf(`WriteRow %v`, err)
+	}
+	if table.Rows() != 1 {
+		t.Fatalf(`Rows should be %d, is %d`, 1, table.Rows())
+	}
+	if got := int64(binary.BigEndian.Uint64(table.row)); got != null {
+		t.Fatalf(`Null count should be %d, is %d`, null, got)
+	}
+
+	if err := table.Close(); err != nil {
+		t.Fatalf(`Close %v`, err)
+	}
+	if _, err := fits.NewTable("BAD", []Column{{Name: "x", Format: "E"}}); err == nil {
+		t.Fatalf(`NewTable should fail for an unsupported TFORM`)
+	}
+}
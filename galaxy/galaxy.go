@@ -1,66 +1,145 @@
-// Package galaxy implements the Galaxy struct, and GalaxyChannel and FindGalaxy functions.
+// Package galaxy implements the Galaxy struct, the GalaxyStore interface and its SQL
+// implementation SQLStore, and the GalaxyChannel function.
 // ValidateGalaxy is available to use in tests.
 // Galaxies are saved to the galaxies table.
 package galaxy
 
 import (
-	"database/sql"
+	"context"
 	"fmt"
 	"time"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
 )
 
-// A Galaxy has a UGC number, and has Stars associated with it
+// A Galaxy has a UGC number, and has Stars associated with it.
+// The db tags name the galaxies table column for each field, and the ucd and unit tags
+// describe it as an IVOA UCD and VOUnit, for package votable.
+// The physical properties are pointers because the catalogue doesn't have every value for
+// every galaxy; nil means unknown. Redshift and Distance are derived from
+// HeliocentricVelocity when the galaxy is added, unless they were given.
 type Galaxy struct {
-	Id        int64
-	Name      string
-	UgcNumber string
-	CreatedAt time.Time
+	Id        int64     `db:"id" ucd:"meta.id"`
+	Name      string    `db:"name" ucd:"meta.id"`
+	UgcNumber string    `db:"ugc_number" ucd:"meta.id;meta.main"`
+	CreatedAt time.Time `db:"created_at" ucd:"time.creation"`
+
+	Ra                   *float64 `db:"ra" ucd:"pos.eq.ra;meta.main" unit:"deg"`                                     // ICRS, degrees
+	Dec                  *float64 `db:"dec" ucd:"pos.eq.dec;meta.main" unit:"deg"`                                   // ICRS, degrees
+	MorphologicalType    *string  `db:"morphological_type" ucd:"src.morph.type"`                                     // Hubble type, e.g. "SA(s)b"
+	MajorDiameter        *float64 `db:"major_diameter" ucd:"phys.angSize.smajAxis" unit:"arcmin"`                    // arcmin
+	MinorDiameter        *float64 `db:"minor_diameter" ucd:"phys.angSize.sminAxis" unit:"arcmin"`                    // arcmin
+	PositionAngle        *float64 `db:"position_angle" ucd:"pos.posAng" unit:"deg"`                                  // degrees, east of north
+	BlueMagnitude        *float64 `db:"blue_magnitude" ucd:"phot.mag;em.opt.B" unit:"mag"`                           // B band, mag
+	HeliocentricVelocity *float64 `db:"heliocentric_velocity" ucd:"spect.dopplerVeloc;pos.heliocentric" unit:"km/s"` // km/s
+	Redshift             *float64 `db:"redshift" ucd:"src.redshift"`                                                 // z
+	Distance             *float64 `db:"distance" ucd:"pos.distance" unit:"Mpc"`                                      // Mpc
 }
 
-// GalaxyChannel takes a database connection, and fills galaxy_channel with Galaxy structs
-// from database table galaxies.
-// If there is an error it is put on error_channel.
-func GalaxyChannel(db *sql.DB, galaxy_channel chan Galaxy, error_channel chan error) {
-	// Make sure the channels are closed when the method returns
-	defer close(galaxy_channel)
-	defer close(error_channel)
-	rows, err := db.Query("SELECT * FROM galaxies")
+// Position returns the galaxy's position in frame, as a longitude and latitude in degrees,
+// or false if it has no position.
+func (galaxy Galaxy) Position(frame coords.Frame) (float64, float64, bool) {
+	if galaxy.Ra == nil || galaxy.Dec == nil {
+		return 0, 0, false
+	}
+	lon, lat := coords.FromICRS(frame, *galaxy.Ra, *galaxy.Dec)
+	return lon, lat, true
+}
+
+// Galactic returns the galaxy's Galactic longitude and latitude, l and b, in degrees, or false
+// if it has no position.
+func (galaxy Galaxy) Galactic() (float64, float64, bool) {
+	return galaxy.Position(coords.Galactic)
+}
+
+// Ecliptic returns the galaxy's ecliptic longitude and latitude in degrees, or false if it
+// has no position.
+func (galaxy Galaxy) Ecliptic() (float64, float64, bool) {
+	return galaxy.Position(coords.Ecliptic)
+}
+
+// A GalaxyStore reads galaxies from wherever they are kept.
+// SQLStore reads them from the database, and package memstore keeps them in memory for tests.
+type GalaxyStore interface {
+	// EachGalaxy calls fn for every galaxy, stopping at the first error from fn or the store.
+	EachGalaxy(ctx context.Context, fn func(Galaxy) error) error
+	// FindGalaxy returns the galaxy with the given UgcNumber, or an error wrapping
+	// sql.ErrNoRows if there isn't one.
+	FindGalaxy(ctx context.Context, ugc_number string) (Galaxy, error)
+}
+
+// SQLStore is a GalaxyStore backed by the galaxies table
+type SQLStore struct {
+	db *database.DB
+}
+
+// NewSQLStore returns a GalaxyStore that reads from the galaxies table using db.
+func NewSQLStore(db *database.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EachGalaxy calls fn for each row of the galaxies table.
+func (store *SQLStore) EachGalaxy(ctx context.Context, fn func(Galaxy) error) error {
+	rows, err := store.db.QueryContext(ctx, "SELECT "+store.db.ColumnList(Galaxy{})+" FROM galaxies")
 	if err != nil {
-		error_channel <- err
-		return
+		return err
 	}
 	defer rows.Close()
 
-	// Loop through rows, using Scan to assign column data to struct fields.
+	// Loop through rows, using ScanStruct to assign column data to struct fields.
 	for rows.Next() {
 		var galaxy Galaxy
-		if err := rows.Scan(&galaxy.Id, &galaxy.Name, &galaxy.UgcNumber, &galaxy.CreatedAt); err != nil {
-			error_channel <- err
-			return
+		if err := database.ScanStruct(rows, &galaxy); err != nil {
+			return err
+		}
+		if err := fn(galaxy); err != nil {
+			return err
 		}
-		galaxy_channel <- galaxy
 	}
 
-	if err := rows.Err(); err != nil {
-		error_channel <- err
-	}
+	return rows.Err()
 }
 
-// FindGalaxy takes a database connection and an UgcNumber, and returns the Galaxy struct
-// found, or an error if not.
-func FindGalaxy(db *sql.DB, ugc_number string) (Galaxy, error) {
+// FindGalaxy takes a context and an UgcNumber, and returns the Galaxy struct found,
+// or an error if not. The error wraps sql.ErrNoRows if there is no such galaxy.
+func (store *SQLStore) FindGalaxy(ctx context.Context, ugc_number string) (Galaxy, error) {
 	var galaxy Galaxy
 
-	err := db.QueryRow("SELECT * FROM galaxies WHERE ugc_number = ?", ugc_number).
-		Scan(&galaxy.Id, &galaxy.Name, &galaxy.UgcNumber, &galaxy.CreatedAt)
+	row := store.db.QueryRowContext(ctx, store.db.Rebind("SELECT "+store.db.ColumnList(Galaxy{})+" FROM galaxies WHERE ugc_number = ?"), ugc_number)
+	err := database.ScanStruct(row, &galaxy)
 
 	if err != nil {
-		return galaxy, fmt.Errorf("FindGalaxy %v", err)
+		return galaxy, fmt.Errorf("FindGalaxy %w", err)
 	}
 
 	return galaxy, nil
 }
 
+// GalaxyChannel takes a context and a GalaxyStore, and fills galaxy_channel with the
+// Galaxy structs in the store.
+// If there is an error it is put on error_channel. If ctx is cancelled, it stops sending
+// and puts ctx.Err() on error_channel.
+func GalaxyChannel(ctx context.Context, store GalaxyStore, galaxy_channel chan Galaxy, error_channel chan error) {
+	// Make sure the channels are closed when the method returns
+	defer close(galaxy_channel)
+	defer close(error_channel)
+
+	err := store.EachGalaxy(ctx, func(galaxy Galaxy) error {
+		// Don't block forever if the consumer has gone away
+		select {
+		case galaxy_channel <- galaxy:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	if err != nil {
+		error_channel <- err
+	}
+}
+
 // ValidateGalaxy reports whether the two Galaxies have the same ugc_number.
 // Useful for tests.
 func ValidateGalaxy(got Galaxy, want Galaxy) bool {
@@ -1,7 +1,10 @@
-// Tests for package galaxy functions FindGalaxy and GalaxyChannel
+// Tests for package galaxy functions SQLStore.FindGalaxy and GalaxyChannel
 package galaxy
 
 import (
+	"context"
+	"errors"
+	"math"
 	"testing"
 
 	"star-catalog/database"
@@ -10,10 +13,10 @@ import (
 // TestFindGalaxy calls FindGalaxy with a known ugc_number and checks that
 // returns the correct galaxy
 func TestFindGalaxy(t *testing.T) {
-	db := database.InitDB()
+	store := NewSQLStore(database.InitDB())
 
 	want := Galaxy{Name: "Milky Way", UgcNumber: "ugc_number1"}
-	got, err := FindGalaxy(db, "ugc_number1")
+	got, err := store.FindGalaxy(context.Background(), "ugc_number1")
 
 	if err != nil {
 		t.Fatalf("FindGalaxy %v\n", err)
@@ -24,14 +27,43 @@ func TestFindGalaxy(t *testing.T) {
 	}
 }
 
+// TestFindGalaxyProperties checks that the physical properties are read for Andromeda, that
+// the redshift was derived from its velocity, and that the Milky Way's unknowns are nil
+func TestFindGalaxyProperties(t *testing.T) {
+	store := NewSQLStore(database.InitDB())
+
+	andromeda, err := store.FindGalaxy(context.Background(), "ugc_number2")
+	if err != nil {
+		t.Fatalf("FindGalaxy %v\n", err)
+	}
+
+	if andromeda.MorphologicalType == nil || *andromeda.MorphologicalType != "SA(s)b" || andromeda.Dec == nil || *andromeda.Dec != 41.2691 {
+		t.Fatalf(`Andromeda should be type SA(s)b at dec 41.2691, is %+v`, andromeda)
+	}
+	if andromeda.Redshift == nil || math.Abs(*andromeda.Redshift+0.001) > 0.00001 {
+		t.Fatalf(`Andromeda should have a redshift of -0.001 derived from its velocity, is %+v`, andromeda)
+	}
+	if andromeda.Distance == nil || *andromeda.Distance != 0.78 {
+		t.Fatalf(`Andromeda should keep its given distance of 0.78 Mpc, is %+v`, andromeda)
+	}
+
+	milky_way, err := store.FindGalaxy(context.Background(), "ugc_number1")
+	if err != nil {
+		t.Fatalf("FindGalaxy %v\n", err)
+	}
+	if milky_way.Ra != nil || milky_way.Redshift != nil || milky_way.Distance != nil {
+		t.Fatalf(`The Milky Way should have no position, redshift or distance, is %+v`, milky_way)
+	}
+}
+
 // TestFindGalaxyMissing calls FindGalaxy with a missing ugc_number and checks that
 // returns an error
 func TestFindGalaxyMissing(t *testing.T) {
-	db := database.InitDB()
+	store := NewSQLStore(database.InitDB())
 
 	want := "FindGalaxy sql: no rows in result set"
 
-	_, err := FindGalaxy(db, "not_an_ugc_number")
+	_, err := store.FindGalaxy(context.Background(), "not_an_ugc_number")
 
 	if err.Error() != want {
 		t.Fatalf("FindGalaxy expected error %v, got %v\n", want, err)
@@ -51,7 +83,7 @@ func TestGalaxyChannel(t *testing.T) {
 		{Name: "", UgcNumber: ""},
 	}
 
-	go GalaxyChannel(db, galaxy_channel, error_channel)
+	go GalaxyChannel(context.Background(), NewSQLStore(db), galaxy_channel, error_channel)
 
 	// Check the error channel for errors, otherwise verify output
 	select {
@@ -79,7 +111,7 @@ func TestGalaxyChannelEmpty(t *testing.T) {
 	galaxy_channel := make(chan Galaxy)
 	error_channel := make(chan error, 1)
 
-	go GalaxyChannel(db, galaxy_channel, error_channel)
+	go GalaxyChannel(context.Background(), NewSQLStore(db), galaxy_channel, error_channel)
 
 	var want Galaxy // null Galaxy
 
@@ -95,3 +127,50 @@ func TestGalaxyChannelEmpty(t *testing.T) {
 		}
 	}
 }
+
+// TestGalaxyChannelCancelled calls GalaxyChannel with a cancelled context and checks that
+// it puts the cancellation error on error_channel and closes galaxy_channel
+func TestGalaxyChannelCancelled(t *testing.T) {
+	db := database.InitDB()
+
+	galaxy_channel := make(chan Galaxy)
+	error_channel := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	go GalaxyChannel(ctx, NewSQLStore(db), galaxy_channel, error_channel)
+
+	// Nothing is read from galaxy_channel, so the producer must not block on it
+	err := <-error_channel
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf(`GalaxyChannel should return context.Canceled, is %v`, err)
+	}
+
+	for got := range galaxy_channel {
+		t.Fatalf(`No galaxies should be sent after cancellation, got %+v`, got)
+	}
+}
+
+// TestGalaxyPosition checks Andromeda's Galactic position against SIMBAD's for M31, and
+// that the Milky Way, which has no position, has none
+func TestGalaxyPosition(t *testing.T) {
+	store := NewSQLStore(database.InitDB())
+
+	andromeda, err := store.FindGalaxy(context.Background(), "ugc_number2")
+	if err != nil {
+		t.Fatalf(`FindGalaxy %v`, err)
+	}
+	l, b, ok := andromeda.Galactic()
+	if !ok || math.Abs(l-121.1743) > 1e-3 || math.Abs(b+21.5733) > 1e-3 {
+		t.Fatalf(`Andromeda should be at l 121.1743, b -21.5733, is %v, %v`, l, b)
+	}
+
+	milky_way, err := store.FindGalaxy(context.Background(), "ugc_number1")
+	if err != nil {
+		t.Fatalf(`FindGalaxy %v`, err)
+	}
+	if _, _, ok := milky_way.Ecliptic(); ok {
+		t.Fatalf(`The Milky Way has no position, so should have no ecliptic position`)
+	}
+}
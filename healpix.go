@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"star-catalog/database"
+	starpkg "star-catalog/star"
+)
+
+// runHealpix gives every star in the database the HEALPix pixel of its position, at the
+// order in config.yml, writing how many stars were indexed to out.
+func runHealpix(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("healpix takes no arguments\n%s", usage)
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	order, err := database.HealpixOrder()
+	if err != nil {
+		return err
+	}
+
+	indexed, err := starpkg.NewSQLStore(db).IndexHealpix(ctx, order)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Indexed %d stars at HEALPix order %d\n", indexed, order)
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package healpix computes HEALPix pixel indices in the NESTED scheme, which divides the
+// sky into 12 * 4^order pixels of equal area.
+// In the NESTED scheme the pixels inside a pixel of a lower order are numbered
+// consecutively, so a region of the sky becomes a short list of index ranges, which an
+// indexed column can answer quickly. Pixel gives the index of a position, DiscRanges and
+// BoxRanges the ranges covering a region, and GaiaPixel reads the index that Gaia
+// source_ids carry in their high bits.
+// See Gorski et al. 2005, ApJ 622, 759, and https://healpix.sourceforge.io.
+package healpix
+
+import (
+	"fmt"
+	"math"
+
+	"star-catalog/astro"
+)
+
+// MaxOrder is the highest order whose indices fit in an int64
+const MaxOrder = 29
+
+// DefaultOrder is the order stars are indexed at unless healpix.order is set in config.yml.
+// Its pixels are about 0.86 arcminutes across, and it is the order Gaia source_ids use.
+const DefaultOrder = 12
+
+// GaiaOrder is the order of the pixel index in a Gaia source_id
+const GaiaOrder = 12
+
+// gaiaShift is the number of bits below the pixel index in a Gaia source_id
+const gaiaShift = 35
+
+// The row and column of each of the 12 base pixels, in units of a base pixel's half width
+var jrll = [12]int64{2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4}
+var jpll = [12]int64{1, 3, 5, 7, 0, 2, 4, 6, 1, 3, 5, 7}
+
+// Nside returns the number of pixels along a side of a base pixel at order.
+func Nside(order int) int64 {
+	return 1 << order
+}
+
+// Npix returns the number of pixels on the sky at order.
+func Npix(order int) int64 {
+	return 12 << (2 * order)
+}
+
+// CheckOrder returns an error if order isn't between 0 and MaxOrder.
+func CheckOrder(order int) error {
+	if order < 0 || order > MaxOrder {
+		return fmt.Errorf("HEALPix order %d is not between 0 and %d", order, MaxOrder)
+	}
+	return nil
+}
+
+// Pixel returns the NESTED index at order of the pixel holding ra and dec, in degrees.
+func Pixel(order int, ra float64, dec float64) int64 {
+	nside := Nside(order)
+	z := math.Sin(dec * math.Pi / 180)
+	za := math.Abs(z)
+
+	// RA in quarters of the sky, from 0 up to 4
+	tt := math.Mod(ra/90, 4)
+	if tt < 0 {
+		tt += 4
+	}
+
+	var face, ix, iy int64
+	if za <= 2.0/3 {
+		// The equatorial belt, where pixel edges are straight lines in tt and z
+		temp1 := float64(nside) * (0.5 + tt)
+		temp2 := float64(nside) * z * 0.75
+		jp := int64(temp1 - temp2)
+		jm := int64(temp1 + temp2)
+		ifp, ifm := jp>>order, jm>>order
+		switch {
+		case ifp == ifm:
+			face = ifp | 4
+		case ifp < ifm:
+			face = ifp
+		default:
+			face = ifm + 8
+		}
+		ix = jm & (nside - 1)
+		iy = nside - (jp & (nside - 1)) - 1
+	} else {
+		// The polar caps. sqrt(3 * (1 - |z|)) is written with the colatitude so that it
+		// stays accurate right up to the poles.
+		ntt := min(int64(tt), 3)
+		tp := tt - float64(ntt)
+		colatitude := (90 - math.Abs(dec)) * math.Pi / 180
+		tmp := float64(nside) * math.Sqrt(6) * math.Sin(colatitude/2)
+
+		jp := min(int64(tp*tmp), nside-1)
+		jm := min(int64((1-tp)*tmp), nside-1)
+		if z >= 0 {
+			face, ix, iy = ntt, nside-jm-1, nside-jp-1
+		} else {
+			face, ix, iy = ntt+8, jp, jm
+		}
+	}
+
+	return face<<(2*order) + spreadBits(ix) + spreadBits(iy)<<1
+}
+
+// Center returns the ra and dec, in degrees, of the centre of a NESTED pixel at order.
+func Center(order int, pixel int64) (float64, float64) {
+	nside := Nside(order)
+	npface := nside * nside
+	face := pixel >> (2 * order)
+	ix := compressBits(pixel & (npface - 1))
+	iy := compressBits(pixel & (npface - 1) >> 1)
+
+	// The ring of the centre, counted from the north pole, and its number of pixels / 4
+	jr := jrll[face]<<order - ix - iy - 1
+	fact2 := 4 / float64(Npix(order))
+
+	var nr int64
+	var z float64
+	switch {
+	case jr < nside:
+		nr = jr
+		z = 1 - float64(nr*nr)*fact2
+	case jr > 3*nside:
+		nr = 4*nside - jr
+		z = float64(nr*nr)*fact2 - 1
+	default:
+		nr = nside
+		z = float64(2*nside-jr) * 2 / float64(3*nside)
+	}
+
+	tmp := jpll[face]*nr + ix - iy
+	if tmp < 0 {
+		tmp += 8 * nr
+	}
+	ra := 45 * float64(tmp) / float64(nr)
+
+	return math.Mod(ra, 360), math.Asin(z) * 180 / math.Pi
+}
+
+// MaxPixelRadius returns, in degrees, the largest distance from the centre of any pixel at
+// order to its edge. A pixel lies inside the circle of this radius around its centre.
+func MaxPixelRadius(order int) float64 {
+	nside := float64(Nside(order))
+
+	// From a corner of the base pixels at z = 2/3 to the nearest centre, which is the
+	// furthest any pixel reaches (healpix_base max_pixrad)
+	t1 := 1 - 1/nside
+	t1 *= t1
+	to_degrees := 180 / math.Pi
+	return astro.AngularDistance(45/nside, math.Asin(2.0/3)*to_degrees, 0, math.Asin(1-t1/3)*to_degrees)
+}
+
+// Parent returns the pixel at the lower order to that holds pixel at order.
+func Parent(order int, pixel int64, to int) int64 {
+	return pixel >> (2 * (order - to))
+}
+
+// GaiaPixel returns the NESTED pixel at GaiaOrder that Gaia encodes in a source_id, which is
+// the source_id divided by 2^35. The pixel holds the source's position at the catalogue
+// epoch, to within Gaia's astrometric accuracy.
+func GaiaPixel(source_id int64) int64 {
+	return source_id >> gaiaShift
+}
+
+// Spread the bits of v out to the even bits of the result, interleaving x and y coordinates
+// into a NESTED index
+func spreadBits(v int64) int64 {
+	var spread int64
+	for i := 0; i < MaxOrder; i++ {
+		spread |= (v >> i & 1) << (2 * i)
+	}
+	return spread
+}
+
+// Gather the even bits of v, undoing spreadBits
+func compressBits(v int64) int64 {
+	var compressed int64
+	for i := 0; i < MaxOrder; i++ {
+		compressed |= (v >> (2 * i) & 1) << i
+	}
+	return compressed
+}
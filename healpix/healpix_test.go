@@ -0,0 +1,117 @@
+// Tests for Pixel, Center, MaxPixelRadius, Parent and GaiaPixel
+package healpix
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"star-catalog/astro"
+)
+
+// TestPixel checks the poles and equator, where the base pixels are easy to work out
+func TestPixel(t *testing.T) {
+	tests := []struct {
+		order   int
+		ra, dec float64
+		want    int64
+	}{
+		// The north pole is at the corner of base pixels 0 to 3, the south pole of 8 to 11
+		{0, 10, 90, 0},
+		{0, 100, 90, 1},
+		{0, 350, 90, 3},
+		{0, 10, -90, 8},
+		{0, 280, -90, 11},
+		// On the equator the centres of base pixels 4 to 7 are at RA 0, 90, 180 and 270
+		{0, 0, 0, 4},
+		{0, 90, 0, 5},
+		{0, 180.5, 0, 6},
+		{0, 269.5, 0, 7},
+		{0, -90, 0, 7},
+		{0, 360, 0, 4},
+		// Nested pixels next to the north pole are the last of each base pixel
+		{1, 10, 89.9, 3},
+		{2, 10, 89.9, 15},
+		// and next to the south pole, the first
+		{2, 10, -89.9, 8 << 4},
+	}
+
+	for _, test := range tests {
+		if got := Pixel(test.order, test.ra, test.dec); got != test.want {
+			t.Fatalf(`Pixel %d, %v, %v should be %d, is %d`, test.order, test.ra, test.dec, test.want, got)
+		}
+	}
+}
+
+// TestCenter checks that the centre of every pixel up to order 5 is in that pixel, and the
+// centre of a base pixel on the equator
+func TestCenter(t *testing.T) {
+	for order := 0; order <= 5; order++ {
+		for pixel := int64(0); pixel < Npix(order); pixel++ {
+			ra, dec := Center(order, pixel)
+			if got := Pixel(order, ra, dec); got != pixel {
+				t.Fatalf(`Center %d, %d is %v, %v, which is in pixel %d`, order, pixel, ra, dec, got)
+			}
+		}
+	}
+
+	if ra, dec := Center(0, 4); ra != 0 || dec != 0 {
+		t.Fatalf(`Center 0, 4 should be 0, 0, is %v, %v`, ra, dec)
+	}
+}
+
+// TestMaxPixelRadius checks that random positions are within MaxPixelRadius of the centre
+// of their pixel, and that the radius is about the size of a pixel
+func TestMaxPixelRadius(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for order := 0; order <= 12; order += 3 {
+		radius := MaxPixelRadius(order)
+		for i := 0; i < 10000; i++ {
+			ra, dec := random.Float64()*360, math.Asin(random.Float64()*2-1)*180/math.Pi
+			center_ra, center_dec := Center(order, Pixel(order, ra, dec))
+			if distance := astro.AngularDistance(ra, dec, center_ra, center_dec); distance > radius {
+				t.Fatalf(`%v, %v is %v from the centre of its pixel at order %d, more than %v`, ra, dec, distance, order, radius)
+			}
+		}
+	}
+
+	// Order 12 pixels are about 52 arcseconds across, and reach further at their corners
+	if radius := MaxPixelRadius(12) * 3600; radius < 40 || radius > 60 {
+		t.Fatalf(`MaxPixelRadius 12 should be around 50 arcseconds, is %v`, radius)
+	}
+}
+
+// TestParent checks that a pixel's parent holds its position
+func TestParent(t *testing.T) {
+	ra, dec := 217.39232, -62.67608
+	pixel := Pixel(12, ra, dec)
+
+	for to := 0; to <= 12; to++ {
+		if got, want := Parent(12, pixel, to), Pixel(to, ra, dec); got != want {
+			t.Fatalf(`Parent 12, %d, %d should be %d, is %d`, pixel, to, want, got)
+		}
+	}
+}
+
+// TestGaiaPixel checks the pixel of Proxima Centauri, Gaia DR3 5853498713190525696, against
+// its Gaia position. Stars with a high proper motion can have moved out of their source_id's
+// pixel since the source_id was given, so this is checked for one star only.
+func TestGaiaPixel(t *testing.T) {
+	source_id := int64(5853498713190525696)
+	want := Pixel(GaiaOrder, 217.39232147200883, -62.67607511676666)
+
+	if got := GaiaPixel(source_id); got != want || got != 170359234 {
+		t.Fatalf(`GaiaPixel %d should be %d, is %d`, source_id, want, got)
+	}
+}
+
+// TestCheckOrder checks the ends of the range of orders
+func TestCheckOrder(t *testing.T) {
+	if CheckOrder(0) != nil || CheckOrder(MaxOrder) != nil {
+		t.Fatalf(`CheckOrder should allow 0 to %d`, MaxOrder)
+	}
+	if CheckOrder(-1) == nil || CheckOrder(MaxOrder+1) == nil {
+		t.Fatalf(`CheckOrder should refuse -1 and %d`, MaxOrder+1)
+	}
+}
@@ -0,0 +1,129 @@
+package healpix
+
+import (
+	"math"
+
+	"star-catalog/astro"
+)
+
+// A Range is the NESTED pixels from First to Last, inclusive, at some order.
+type Range struct {
+	First, Last int64
+}
+
+// AtOrder returns the range at the higher order to covering the same sky as r, which
+// is at order.
+func (r Range) AtOrder(order int, to int) Range {
+	shift := 2 * (to - order)
+	return Range{First: r.First << shift, Last: (r.Last+1)<<shift - 1}
+}
+
+// DiscRanges returns the sorted ranges of pixels at order that cover the disc of radius
+// degrees around ra and dec. The ranges can hold pixels just outside the disc, but never
+// leave out one that is inside it, so positions still need an exact distance check.
+func DiscRanges(order int, ra float64, dec float64, radius float64) []Range {
+	return cover(order, func(pixel_ra, pixel_dec, pixel_radius float64) (bool, bool) {
+		distance := astro.AngularDistance(ra, dec, pixel_ra, pixel_dec)
+		return distance <= radius+pixel_radius, distance+pixel_radius <= radius
+	})
+}
+
+// BoxRanges returns the sorted ranges of pixels at order that cover the positions with a dec
+// from min_dec to max_dec and an ra from min_ra to max_ra, all in degrees. min_ra is greater
+// than max_ra for a box that wraps around RA 0, as in star.Box. Like DiscRanges, the ranges
+// can hold pixels just outside the box.
+func BoxRanges(order int, min_ra float64, max_ra float64, min_dec float64, max_dec float64) []Range {
+	box := raIntervals(min_ra, max_ra)
+
+	return cover(order, func(pixel_ra, pixel_dec, pixel_radius float64) (bool, bool) {
+		// Compare the box with the box around the pixel's circle
+		low, high := pixel_dec-pixel_radius, pixel_dec+pixel_radius
+		if high < min_dec || low > max_dec {
+			return false, false
+		}
+		circle := [][2]float64{{0, 360}}
+		if width, ok := raHalfWidth(pixel_dec, pixel_radius); ok {
+			circle = raIntervals(math.Mod(pixel_ra-width+360, 360), math.Mod(pixel_ra+width, 360))
+		}
+
+		overlaps, inside := false, low >= min_dec && high <= max_dec
+		for _, c := range circle {
+			contained := false
+			for _, b := range box {
+				overlaps = overlaps || (c[0] <= b[1] && c[1] >= b[0])
+				contained = contained || (c[0] >= b[0] && c[1] <= b[1])
+			}
+			inside = inside && contained
+		}
+		return overlaps, inside
+	})
+}
+
+// SearchOrder returns the order, up to max, to find the ranges of a region size degrees
+// across at: the highest whose pixels are at least a quarter of size across, so that the
+// region takes a few dozen ranges whatever its size.
+func SearchOrder(size float64, max int) int {
+	order := 0
+	for order < max && 2*MaxPixelRadius(order+1) >= size/4 {
+		order++
+	}
+	return order
+}
+
+// Walk the pixel tree from the base pixels down to order, collecting the pixels that test
+// says overlap the region. test is given a pixel's centre and the radius of a circle holding
+// it, and reports whether the region overlaps that circle and whether it holds all of it.
+// A pixel the region holds is taken whole, without looking at its children.
+func cover(order int, test func(ra, dec, radius float64) (overlaps bool, inside bool)) []Range {
+	var ranges []Range
+
+	var visit func(pixel_order int, pixel int64)
+	visit = func(pixel_order int, pixel int64) {
+		ra, dec := Center(pixel_order, pixel)
+		overlaps, inside := test(ra, dec, MaxPixelRadius(pixel_order))
+		if !overlaps {
+			return
+		}
+
+		if inside || pixel_order == order {
+			r := Range{First: pixel, Last: pixel}.AtOrder(pixel_order, order)
+			// Pixels are visited in order, so a range can only join on to the last one
+			if len(ranges) > 0 && ranges[len(ranges)-1].Last+1 == r.First {
+				ranges[len(ranges)-1].Last = r.Last
+			} else {
+				ranges = append(ranges, r)
+			}
+			return
+		}
+
+		for child := pixel * 4; child < pixel*4+4; child++ {
+			visit(pixel_order+1, child)
+		}
+	}
+
+	for pixel := int64(0); pixel < 12; pixel++ {
+		visit(0, pixel)
+	}
+	return ranges
+}
+
+// Return the ra intervals of a range from low to high that may wrap around RA 0
+func raIntervals(low float64, high float64) [][2]float64 {
+	if low <= high {
+		return [][2]float64{{low, high}}
+	}
+	return [][2]float64{{low, 360}, {0, high}}
+}
+
+// Return how far in RA a circle of radius around dec reaches either side of its centre, or
+// false if it holds a pole and so reaches every RA
+func raHalfWidth(dec float64, radius float64) (float64, bool) {
+	if math.Abs(dec)+radius >= 90 {
+		return 0, false
+	}
+	sin_width := math.Sin(radius*math.Pi/180) / math.Cos(dec*math.Pi/180)
+	if sin_width >= 1 {
+		return 0, false
+	}
+	return math.Asin(sin_width) * 180 / math.Pi, true
+}
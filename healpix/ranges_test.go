@@ -0,0 +1,134 @@
+// Tests for DiscRanges, BoxRanges, SearchOrder and Range.AtOrder
+package healpix
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"star-catalog/astro"
+)
+
+// Report whether pixel is in one of ranges
+func inRanges(ranges []Range, pixel int64) bool {
+	for _, r := range ranges {
+		if pixel >= r.First && pixel <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// Check that ranges are sorted, don't touch, and hold fewer pixels than the whole sky
+func checkRanges(t *testing.T, order int, ranges []Range) {
+	var count int64
+	for i, r := range ranges {
+		if r.First > r.Last || (i > 0 && r.First <= ranges[i-1].Last+1) {
+			t.Fatalf(`Ranges should be sorted and separate, are %v`, ranges)
+		}
+		count += r.Last - r.First + 1
+	}
+	if count == 0 || count > Npix(order) {
+		t.Fatalf(`Ranges at order %d hold %d pixels`, order, count)
+	}
+}
+
+// TestDiscRanges checks that random discs' ranges hold the pixels of random positions
+// inside them, including discs around the poles and across RA 0, and that there are only
+// a few dozen ranges at the SearchOrder of each disc
+func TestDiscRanges(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	discs := [][3]float64{{0, 90, 1}, {180, -89.5, 2}, {359.9, 0, 0.5}, {0.1, 45, 3}}
+	for i := 0; i < 100; i++ {
+		discs = append(discs, [3]float64{random.Float64() * 360, random.Float64()*180 - 90, random.Float64() * 5})
+	}
+
+	for _, disc := range discs {
+		order := SearchOrder(2*disc[2], 12)
+		ranges := DiscRanges(order, disc[0], disc[1], disc[2])
+		checkRanges(t, order, ranges)
+
+		for i := 0; i < 200; i++ {
+			ra := math.Mod(disc[0]+(random.Float64()*2-1)*disc[2]*3+360, 360)
+			dec := math.Max(-90, math.Min(90, disc[1]+(random.Float64()*2-1)*disc[2]))
+			if astro.AngularDistance(disc[0], disc[1], ra, dec) > disc[2] {
+				continue
+			}
+			if !inRanges(ranges, Pixel(order, ra, dec)) {
+				t.Fatalf(`DiscRanges %d, %v is %v, and should hold %v, %v`, order, disc, ranges, ra, dec)
+			}
+		}
+
+		if len(ranges) > 100 {
+			t.Fatalf(`DiscRanges %d, %v should be a few dozen ranges, is %d`, order, disc, len(ranges))
+		}
+	}
+
+	// A disc well inside one pixel is covered by that pixel, or a few around it
+	ranges := DiscRanges(6, 30, 10, 0.01)
+	if !inRanges(ranges, Pixel(6, 30, 10)) || len(ranges) > 4 {
+		t.Fatalf(`DiscRanges 6, 30, 10, 0.01 should be a few pixels, is %v`, ranges)
+	}
+
+	// The whole sky is one range
+	ranges = DiscRanges(3, 0, 0, 180)
+	if len(ranges) != 1 || ranges[0] != (Range{0, Npix(3) - 1}) {
+		t.Fatalf(`DiscRanges 3, 0, 0, 180 should be every pixel, is %v`, ranges)
+	}
+}
+
+// TestBoxRanges checks that the ranges of random boxes, some of them wrapping around RA 0,
+// hold the pixels of random positions inside them
+func TestBoxRanges(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+
+	for i := 0; i < 100; i++ {
+		min_ra, width := random.Float64()*360, random.Float64()*10
+		max_ra := math.Mod(min_ra+width, 360)
+		min_dec := random.Float64()*170 - 90
+		max_dec := math.Min(90, min_dec+random.Float64()*10)
+
+		order := SearchOrder(max_dec-min_dec, 12)
+		ranges := BoxRanges(order, min_ra, max_ra, min_dec, max_dec)
+		checkRanges(t, order, ranges)
+
+		for j := 0; j < 200; j++ {
+			ra := math.Mod(min_ra+random.Float64()*width, 360)
+			dec := min_dec + random.Float64()*(max_dec-min_dec)
+			if !inRanges(ranges, Pixel(order, ra, dec)) {
+				t.Fatalf(`BoxRanges %d, %v, %v, %v, %v is %v, and should hold %v, %v`, order, min_ra, max_ra, min_dec, max_dec, ranges, ra, dec)
+			}
+		}
+	}
+
+	// A box around the south pole holds all of the base pixels 8 to 11 that are in it
+	ranges := BoxRanges(2, 0, 360, -90, -80)
+	if !inRanges(ranges, 8<<4) || !inRanges(ranges, 11<<4) || inRanges(ranges, Pixel(2, 0, 0)) {
+		t.Fatalf(`BoxRanges 2, 0, 360, -90, -80 should hold the pixels at the south pole only, is %v`, ranges)
+	}
+}
+
+// TestSearchOrder checks that smaller regions are searched at higher orders, up to max
+func TestSearchOrder(t *testing.T) {
+	if SearchOrder(360, 12) != 0 {
+		t.Fatalf(`SearchOrder 360, 12 should be 0, is %d`, SearchOrder(360, 12))
+	}
+	if SearchOrder(1e-6, 12) != 12 || SearchOrder(1e-6, 8) != 8 {
+		t.Fatalf(`SearchOrder of a tiny region should be max`)
+	}
+	if SearchOrder(1, 12) <= SearchOrder(10, 12) {
+		t.Fatalf(`SearchOrder of 1 degree should be higher than of 10 degrees`)
+	}
+}
+
+// TestAtOrder checks that a range at a higher order holds the pixels inside the original ones
+func TestAtOrder(t *testing.T) {
+	got := Range{First: 5, Last: 6}.AtOrder(1, 3)
+	if got != (Range{First: 80, Last: 111}) {
+		t.Fatalf(`Range 5-6 at order 3 should be 80-111, is %v`, got)
+	}
+	if got := (Range{First: 7, Last: 7}).AtOrder(2, 2); got != (Range{First: 7, Last: 7}) {
+		t.Fatalf(`Range 7-7 at the same order should be unchanged, is %v`, got)
+	}
+}
@@ -0,0 +1,27 @@
+// Tests for the healpix command
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"star-catalog/database"
+)
+
+// TestHealpixCommand indexes the fixture stars and checks the output
+func TestHealpixCommand(t *testing.T) {
+	database.InitDB()
+
+	var out bytes.Buffer
+	if err := runHealpix(context.Background(), nil, &out); err != nil {
+		t.Fatalf(`healpix %v`, err)
+	}
+	if want := "Indexed 4 stars at HEALPix order 12\n"; out.String() != want {
+		t.Fatalf(`healpix should write %q, is %q`, want, out.String())
+	}
+
+	if err := runHealpix(context.Background(), []string{"12"}, &out); err == nil {
+		t.Fatalf(`healpix should fail with an argument`)
+	}
+}
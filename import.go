@@ -0,0 +1,215 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+	galaxypkg "star-catalog/galaxy"
+	"star-catalog/importer"
+
+	"github.com/spf13/viper"
+)
+
+// runImport runs the import subcommand named by args[0], writing what it did to out.
+func runImport(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("import needs a catalogue\n%s", usage)
+	}
+
+	switch args[0] {
+	case "gaia":
+		return runImportGaia(ctx, args[1:], out)
+	case "ugc":
+		return runImportUGC(ctx, args[1:], out)
+	}
+
+	return fmt.Errorf("unknown catalogue %q\n%s", args[0], usage)
+}
+
+// columnFlags collects repeated flags like -column star_column=csv_column
+type columnFlags map[string]string
+
+func (columns columnFlags) String() string {
+	return fmt.Sprint(map[string]string(columns))
+}
+
+func (columns columnFlags) Set(value string) error {
+	column, csv_column, ok := strings.Cut(value, "=")
+	if !ok || column == "" || csv_column == "" {
+		return fmt.Errorf("should be column=value, is %q", value)
+	}
+	columns[column] = csv_column
+	return nil
+}
+
+// runImportGaia imports the stars in a Gaia archive CSV file, or a VOTable if the file ends
+// in .vot or .xml. Either may be gzipped. Positions in another frame, given by -frame, are
+// stored as ICRS.
+// Rejected rows go to <file>.rejects.csv unless -rejects names another file, and the file
+// is removed again if nothing was rejected.
+// Column mappings and the batch size can also be set in config.yml, as import.gaia.columns
+// and import.batch_size; flags take precedence.
+func runImportGaia(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import gaia", flag.ContinueOnError)
+	flags.SetOutput(out)
+	galaxy := flags.String("galaxy", "", "ugc_number of the galaxy for every star, instead of a ugc_number column")
+	batch_size := flags.Int("batch", 0, "number of stars inserted at a time")
+	rejects_path := flags.String("rejects", "", "file for rejected rows (default <file>.rejects.csv)")
+	frame_name := flags.String("frame", "icrs", fmt.Sprintf("frame of the ra and dec columns, one of %v", coords.Frames))
+	columns := columnFlags{}
+	flags.Var(columns, "column", "read a stars column from a differently named CSV column, as star_column=csv_column; can be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import gaia needs one CSV file\n%s", usage)
+	}
+	path := flags.Arg(0)
+	frame, err := coords.ParseFrame(*frame_name)
+	if err != nil {
+		return fmt.Errorf("import gaia: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := decompress(path, file)
+	if err != nil {
+		return err
+	}
+
+	// ConnectDB reads config.yml, so the config settings are read after it
+	db := database.ConnectDB()
+	defer db.Close()
+
+	options := importer.GaiaOptions{Galaxy: *galaxy, BatchSize: *batch_size, Frame: frame, Columns: viper.GetStringMapString("import.gaia.columns")}
+	if options.BatchSize == 0 {
+		options.BatchSize = viper.GetInt("import.batch_size")
+	}
+	if options.Columns == nil {
+		options.Columns = map[string]string{}
+	}
+	for column, csv_column := range columns {
+		options.Columns[column] = csv_column
+	}
+
+	// VOTables are recognised by their extension, like gzipped files
+	switch filepath.Ext(strings.TrimSuffix(path, ".gz")) {
+	case ".vot", ".xml":
+		options.Format = "votable"
+	}
+
+	if *rejects_path == "" {
+		*rejects_path = strings.TrimSuffix(path, ".gz") + ".rejects.csv"
+	}
+	rejects, err := os.Create(*rejects_path)
+	if err != nil {
+		return err
+	}
+	defer rejects.Close()
+	options.Rejects = rejects
+
+	result, err := importer.ImportGaia(ctx, db, galaxypkg.NewSQLStore(db), reader, options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Imported %d stars from %s\n", result.Imported, path)
+	if result.Rejected == 0 {
+		rejects.Close()
+		return os.Remove(*rejects_path)
+	}
+	fmt.Fprintf(out, "Rejected %d rows, see %s\n", result.Rejected, *rejects_path)
+
+	return nil
+}
+
+// runImportUGC upserts the galaxies in a UGC catalogue file, which may be gzipped.
+// The file is HEASARC's pipe-separated ASCII output unless -fixed gives the byte ranges of
+// fixed-width columns, or a VOTable if it ends in .vot or .xml. Positions in another frame,
+// given by -frame, are stored as ICRS. Both can also be set in config.yml, as import.ugc.columns and
+// import.ugc.fixed; flags take precedence.
+func runImportUGC(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("import ugc", flag.ContinueOnError)
+	flags.SetOutput(out)
+	columns := columnFlags{}
+	flags.Var(columns, "column", "read a galaxies column from a differently named field, as galaxies_column=field; can be repeated")
+	fixed := columnFlags{}
+	flags.Var(fixed, "fixed", "read a galaxies column from fixed-width bytes, as galaxies_column=start-end; can be repeated")
+	frame_name := flags.String("frame", "icrs", fmt.Sprintf("frame of the ra and dec fields, one of %v", coords.Frames))
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("import ugc needs one catalogue file\n%s", usage)
+	}
+	path := flags.Arg(0)
+	frame, err := coords.ParseFrame(*frame_name)
+	if err != nil {
+		return fmt.Errorf("import ugc: %v", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := decompress(path, file)
+	if err != nil {
+		return err
+	}
+
+	// ConnectDB reads config.yml, so the config settings are read after it
+	db := database.ConnectDB()
+	defer db.Close()
+
+	options := importer.UGCOptions{
+		Columns: viper.GetStringMapString("import.ugc.columns"),
+		Fixed:   viper.GetStringMapString("import.ugc.fixed"),
+		Frame:   frame,
+	}
+	if len(columns) > 0 {
+		options.Columns = columns
+	}
+	if len(fixed) > 0 {
+		options.Fixed = fixed
+	}
+	switch filepath.Ext(strings.TrimSuffix(path, ".gz")) {
+	case ".vot", ".xml":
+		options.Format = "votable"
+	}
+
+	result, err := importer.ImportUGC(ctx, db, reader, options)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Inserted %d, updated %d and left %d galaxies unchanged from %s\n", result.Inserted, result.Updated, result.Unchanged, path)
+
+	return nil
+}
+
+// Return a reader for the contents of file, which is gunzipped if path ends in .gz
+func decompress(path string, file io.Reader) (io.Reader, error) {
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	gzip_reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return gzip_reader, nil
+}
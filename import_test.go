@@ -0,0 +1,140 @@
+// Tests for the import command
+package main
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+)
+
+// TestImportGaiaCommand imports a file with one bad row, and checks the output and the
+// rejects file
+func TestImportGaiaCommand(t *testing.T) {
+	db := database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "gaia.csv")
+	csv := "source_id,ra,dec,parallax\n" +
+		"3001,10.68,41.27,0.01\n" +
+		"3002,10.70,-95,\n"
+	if err := os.WriteFile(path, []byte(csv), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runImport(context.Background(), []string{"gaia", "-galaxy", "ugc_number2", path}, &out); err != nil {
+		t.Fatalf(`import gaia %v`, err)
+	}
+	out.Reset()
+	if err := runImport(context.Background(), []string{"gaia", "-galaxy", "ugc_number1", "-column", "ra=ra", path}, &out); err != nil {
+		t.Fatalf(`import gaia %v`, err)
+	}
+
+	// The second import rejects every row, since 3001 is already there
+	for _, want := range []string{"Imported 0 stars from " + path, "Rejected 2 rows, see " + path + ".rejects.csv"} {
+		if !strings.Contains(out.String(), want) {
+			t.Fatalf(`import gaia output should contain %s, is %s`, want, out.String())
+		}
+	}
+
+	var got int
+	err := db.QueryRow("SELECT COUNT(*) FROM stars WHERE gaia_catalogue_id = '3001'").Scan(&got)
+	if got != 1 || err != nil {
+		t.Fatalf(`Star 3001 rows should be %d, is %d, %v`, 1, got, err)
+	}
+
+	if err := runImport(context.Background(), []string{"gaia", "-frame", "supergalactic", path}, &out); err == nil || !strings.Contains(err.Error(), "unknown frame") {
+		t.Fatalf(`import gaia should fail for an unknown frame, is %v`, err)
+	}
+}
+
+// TestImportNoRejects checks that the rejects file is removed when every row is imported
+func TestImportNoRejects(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "gaia.csv")
+	if err := os.WriteFile(path, []byte("source_id,ugc_number\n4001,ugc_number1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runImport(context.Background(), []string{"gaia", path}, &out); err != nil {
+		t.Fatalf(`import gaia %v`, err)
+	}
+
+	if _, err := os.Stat(path + ".rejects.csv"); !os.IsNotExist(err) {
+		t.Fatalf(`The rejects file should have been removed, %v`, err)
+	}
+}
+
+// TestImportUGCCommand imports a HEASARC-style file and checks the output
+func TestImportUGCCommand(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "ugc.txt")
+	file := "|name |ra    |dec   |\n" +
+		"|1    |0.771 |21.961|\n" +
+		"|454  |10.685|41.269|\n"
+	if err := os.WriteFile(path, []byte(file), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runImport(context.Background(), []string{"ugc", path}, &out); err != nil {
+		t.Fatalf(`import ugc %v`, err)
+	}
+
+	if want := "Inserted 2, updated 0 and left 0 galaxies unchanged from " + path; !strings.Contains(out.String(), want) {
+		t.Fatalf(`import ugc output should contain %s, is %s`, want, out.String())
+	}
+}
+
+// TestImportUGCFrameCommand imports an ecliptic position and checks that an unknown frame
+// fails
+func TestImportUGCFrameCommand(t *testing.T) {
+	db := database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "ugc.txt")
+	if err := os.WriteFile(path, []byte("|name |ra   |dec |\n|1    |90   |0   |\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runImport(context.Background(), []string{"ugc", "-frame", "ecliptic", path}, &out); err != nil {
+		t.Fatalf(`import ugc %v`, err)
+	}
+	var ra, dec float64
+	err := db.QueryRow("SELECT ra, dec FROM galaxies WHERE ugc_number = 'UGC 1'").Scan(&ra, &dec)
+	if want_ra, want_dec := coords.ToICRS(coords.Ecliptic, 90, 0); err != nil || math.Abs(ra-want_ra) > 1e-9 || math.Abs(dec-want_dec) > 1e-9 {
+		t.Fatalf(`UGC 1 should be at %v %v, is %v %v, %v`, want_ra, want_dec, ra, dec, err)
+	}
+
+	if err := runImport(context.Background(), []string{"ugc", "-frame", "fk4", path}, &out); err == nil {
+		t.Fatalf(`import ugc should fail for an unknown frame`)
+	}
+}
+
+// TestImportUGCVOTableCommand exports the galaxies to a VOTable, and imports it again, which
+// should leave them unchanged
+func TestImportUGCVOTableCommand(t *testing.T) {
+	database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "galaxies.vot")
+	var out bytes.Buffer
+	if err := runExport(context.Background(), []string{"-table", "galaxies", path}, &out); err != nil {
+		t.Fatalf(`export %v`, err)
+	}
+	if err := runImport(context.Background(), []string{"ugc", path}, &out); err != nil {
+		t.Fatalf(`import ugc %v`, err)
+	}
+
+	if want := "Inserted 0, updated 0 and left 2 galaxies unchanged from " + path; !strings.Contains(out.String(), want) {
+		t.Fatalf(`import ugc output should contain %s, is %s`, want, out.String())
+	}
+}
@@ -0,0 +1,516 @@
+// Package importer loads external catalogues into the database.
+// ImportGaia streams Gaia archive CSV exports into the stars table, in batches, so that
+// files of any size can be imported in bounded memory. ImportUGC upserts the Uppsala
+// General Catalogue into the galaxies table.
+package importer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"slices"
+	"strconv"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+	"star-catalog/galaxy"
+	"star-catalog/healpix"
+	"star-catalog/votable"
+)
+
+// DefaultBatchSize is the number of stars inserted together when GaiaOptions.BatchSize isn't set.
+const DefaultBatchSize = 1000
+
+// DefaultProgressEvery is how many rows are read between progress log lines when
+// GaiaOptions.ProgressEvery isn't set.
+const DefaultProgressEvery = 100000
+
+// DefaultGaiaColumns maps each stars table column to the Gaia archive CSV column it is read
+// from. ugc_number isn't a stars column: it names the galaxy each star is added to.
+// Files without a designation column get names like "Gaia DR3 <source_id>", as the archive does.
+var DefaultGaiaColumns = map[string]string{
+	"gaia_catalogue_id": "source_id",
+	"name":              "designation",
+	"ugc_number":        "ugc_number",
+	"ra":                "ra",
+	"dec":               "dec",
+	"parallax":          "parallax",
+	"parallax_error":    "parallax_error",
+	"pmra":              "pmra",
+	"pmdec":             "pmdec",
+	"radial_velocity":   "radial_velocity",
+	"phot_g_mean_mag":   "phot_g_mean_mag",
+	"phot_bp_mean_mag":  "phot_bp_mean_mag",
+	"phot_rp_mean_mag":  "phot_rp_mean_mag",
+}
+
+// designationPrefix names stars read from files with no designation column
+const designationPrefix = "Gaia DR3 "
+
+// Valid ranges of the stars and galaxies columns that have them. Values outside these are rejected.
+var valueRanges = map[string][2]float64{
+	"ra":             {0, 360},
+	"dec":            {-90, 90},
+	"parallax_error": {0, math.Inf(1)},
+	"major_diameter": {0, math.Inf(1)},
+	"minor_diameter": {0, math.Inf(1)},
+	"position_angle": {0, 180},
+}
+
+// GaiaOptions control how ImportGaia reads a file. The zero value imports a file in the
+// Gaia archive's own column names, with a ugc_number column giving each star's galaxy.
+type GaiaOptions struct {
+	// Columns overrides DefaultGaiaColumns for the stars columns it names
+	Columns map[string]string
+	// Galaxy is the ugc_number of the galaxy every star is added to. If it is empty,
+	// each row's galaxy is read from its ugc_number column.
+	Galaxy string
+	// BatchSize is the number of stars inserted together, DefaultBatchSize if it is 0
+	BatchSize int
+	// Rejects gets each rejected row as CSV, followed by a reject_reason column.
+	// Rejected rows are only counted if it is nil.
+	Rejects io.Writer
+	// ProgressEvery is how many rows are read between progress log lines,
+	// DefaultProgressEvery if it is 0
+	ProgressEvery int
+	// Format is "csv", the default, or "votable" for a VOTable such as the archive's
+	// query results, which is read with package votable. Its field names are the columns.
+	Format string
+	// Frame is the frame of the positions in the ra and dec columns, which are then its
+	// longitude and latitude. They are converted to ICRS, which is the default. Proper
+	// motions aren't converted, so they have to be ICRS already.
+	Frame coords.Frame
+}
+
+// A recordReader reads rows of a file as text, with the column names as the first row
+type recordReader interface {
+	Read() ([]string, error)
+}
+
+// GaiaResult counts the rows ImportGaia read, and how many were imported and rejected.
+type GaiaResult struct {
+	Rows     int
+	Imported int
+	Rejected int
+}
+
+// A gaiaStar is a row of the stars table, with the db tags used by database.InsertRows
+type gaiaStar struct {
+	GalaxyId        int64  `db:"galaxy_id"`
+	Name            string `db:"name"`
+	GaiaCatalogueId string `db:"gaia_catalogue_id"`
+
+	Ra             *float64 `db:"ra"`
+	Dec            *float64 `db:"dec"`
+	Parallax       *float64 `db:"parallax"`
+	ParallaxError  *float64 `db:"parallax_error"`
+	Pmra           *float64 `db:"pmra"`
+	Pmdec          *float64 `db:"pmdec"`
+	RadialVelocity *float64 `db:"radial_velocity"`
+	PhotGMeanMag   *float64 `db:"phot_g_mean_mag"`
+	PhotBpMeanMag  *float64 `db:"phot_bp_mean_mag"`
+	PhotRpMeanMag  *float64 `db:"phot_rp_mean_mag"`
+
+	// Healpix is worked out from Ra and Dec, rather than read from the file
+	Healpix *int64 `db:"healpix"`
+}
+
+// A floatColumn is a CSV column read into one of the *float64 fields of gaiaStar
+type floatColumn struct {
+	name   string
+	record int
+	field  int
+}
+
+// The positions of the mapped columns in a file's header, or -1 for those that are missing
+type gaiaMapping struct {
+	source_id  int
+	name       int
+	ugc_number int
+	floats     []floatColumn
+	frame      coords.Frame
+}
+
+// gaiaImport is the state of one ImportGaia call
+type gaiaImport struct {
+	db       *database.DB
+	galaxies galaxy.GalaxyStore
+	options  GaiaOptions
+	mapping  gaiaMapping
+	header   []string
+	rejects  *csv.Writer
+	result   GaiaResult
+
+	// The HEALPix order of the stars table's healpix column
+	healpix_order int
+
+	// The stars waiting to be inserted, with copies of the records they came from
+	batch         []any
+	batch_records [][]string
+
+	// Galaxy ids by ugc_number, with 0 for galaxies that don't exist
+	galaxy_ids map[string]int64
+}
+
+// ImportGaia reads Gaia archive CSV from reader and adds a star for each row, in the galaxy
+// given by its ugc_number or by options.Galaxy. Rows that can't be imported, because a
+// value is missing, malformed or out of range, the galaxy doesn't exist, or the source_id
+// is already in the stars table, are written to options.Rejects and the import carries on.
+// Duplicates are only found when their batch is inserted, so they can come after later rows.
+// Stars are inserted options.BatchSize at a time, and only one batch is held in memory.
+// Other errors stop the import, leaving the batches already inserted in place.
+func ImportGaia(ctx context.Context, db *database.DB, galaxies galaxy.GalaxyStore, reader io.Reader, options GaiaOptions) (GaiaResult, error) {
+	if options.BatchSize <= 0 {
+		options.BatchSize = DefaultBatchSize
+	}
+	if options.ProgressEvery <= 0 {
+		options.ProgressEvery = DefaultProgressEvery
+	}
+
+	var records recordReader
+	switch options.Format {
+	case "", "csv":
+		csv_reader := csv.NewReader(reader)
+		// Gaia archive files can start with # comment lines, and records are copied when kept
+		csv_reader.Comment = '#'
+		csv_reader.ReuseRecord = true
+		records = csv_reader
+	case "votable":
+		votable_reader, err := votable.NewReader(reader)
+		if err != nil {
+			return GaiaResult{}, fmt.Errorf("ImportGaia: %w", err)
+		}
+		records = &votableRecords{reader: votable_reader}
+	default:
+		return GaiaResult{}, fmt.Errorf("ImportGaia: unknown format %q", options.Format)
+	}
+
+	header, err := records.Read()
+	if err != nil {
+		return GaiaResult{}, fmt.Errorf("ImportGaia: reading header: %w", err)
+	}
+	header = slices.Clone(header)
+
+	mapping, err := newGaiaMapping(header, options)
+	if err != nil {
+		return GaiaResult{}, fmt.Errorf("ImportGaia: %w", err)
+	}
+
+	healpix_order, err := database.HealpixOrder()
+	if err != nil {
+		return GaiaResult{}, fmt.Errorf("ImportGaia: %w", err)
+	}
+
+	importer := &gaiaImport{
+		db:            db,
+		galaxies:      galaxies,
+		options:       options,
+		mapping:       mapping,
+		header:        header,
+		healpix_order: healpix_order,
+		galaxy_ids:    map[string]int64{},
+	}
+	if options.Rejects != nil {
+		importer.rejects = csv.NewWriter(options.Rejects)
+	}
+
+	if err := importer.run(ctx, records); err != nil {
+		return importer.result, fmt.Errorf("ImportGaia: %w", err)
+	}
+
+	log.Printf("ImportGaia finished: %d rows read, %d stars imported, %d rows rejected\n",
+		importer.result.Rows, importer.result.Imported, importer.result.Rejected)
+
+	return importer.result, nil
+}
+
+// Read every record, inserting the stars in batches, then insert the last partial batch
+func (importer *gaiaImport) run(ctx context.Context, records recordReader) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		record, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		importer.result.Rows++
+
+		// A row with the wrong number of fields is the row's fault, anything else is the file's
+		if errors.Is(err, csv.ErrFieldCount) {
+			if err := importer.reject(record, err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := importer.add(ctx, record); err != nil {
+			return err
+		}
+
+		if importer.result.Rows%importer.options.ProgressEvery == 0 {
+			log.Printf("ImportGaia: %d rows read, %d stars imported, %d rows rejected\n",
+				importer.result.Rows, importer.result.Imported, importer.result.Rejected)
+		}
+	}
+
+	if err := importer.flush(ctx); err != nil {
+		return err
+	}
+
+	if importer.rejects != nil {
+		importer.rejects.Flush()
+		return importer.rejects.Error()
+	}
+	return nil
+}
+
+// Add the star in record to the batch, or reject it, inserting the batch once it is full
+func (importer *gaiaImport) add(ctx context.Context, record []string) error {
+	star, ugc_number, err := importer.mapping.parse(record)
+	if err != nil {
+		return importer.reject(record, err)
+	}
+	if importer.options.Galaxy != "" {
+		ugc_number = importer.options.Galaxy
+	}
+
+	star.GalaxyId, err = importer.galaxyId(ctx, ugc_number)
+	if err != nil {
+		return err
+	}
+	if star.GalaxyId == 0 {
+		return importer.reject(record, fmt.Errorf("no galaxy with ugc_number %q", ugc_number))
+	}
+
+	if star.Ra != nil && star.Dec != nil {
+		pixel := healpix.Pixel(importer.healpix_order, *star.Ra, *star.Dec)
+		star.Healpix = &pixel
+	}
+
+	importer.batch = append(importer.batch, star)
+	importer.batch_records = append(importer.batch_records, slices.Clone(record))
+
+	if len(importer.batch) >= importer.options.BatchSize {
+		return importer.flush(ctx)
+	}
+	return nil
+}
+
+// Insert the batch. If a row breaks a constraint, such as a duplicate source_id, the whole
+// batch is rolled back, so its rows are inserted one at a time to find and reject the bad ones.
+func (importer *gaiaImport) flush(ctx context.Context) error {
+	defer func() {
+		importer.batch = importer.batch[:0]
+		importer.batch_records = importer.batch_records[:0]
+	}()
+
+	err := importer.db.InsertRows(ctx, "stars", importer.batch)
+	if err == nil {
+		importer.result.Imported += len(importer.batch)
+		return nil
+	}
+	if !database.IsConstraintViolation(err) {
+		return err
+	}
+
+	for i := range importer.batch {
+		err := importer.db.InsertRows(ctx, "stars", importer.batch[i:i+1])
+		if database.IsConstraintViolation(err) {
+			if err := importer.reject(importer.batch_records[i], err); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		importer.result.Imported++
+	}
+
+	return nil
+}
+
+// Count a rejected record and write it to the rejects file, if there is one
+func (importer *gaiaImport) reject(record []string, reason error) error {
+	importer.result.Rejected++
+	if importer.rejects == nil {
+		return nil
+	}
+
+	// The header goes before the first rejected row, so there is nothing to read if all is well
+	if importer.result.Rejected == 1 {
+		if err := importer.rejects.Write(append(slices.Clone(importer.header), "reject_reason")); err != nil {
+			return err
+		}
+	}
+	return importer.rejects.Write(append(slices.Clone(record), reason.Error()))
+}
+
+// Find the id of the galaxy with the given ugc_number, or 0 if there isn't one.
+// Ids are cached, since there are far fewer galaxies than stars.
+func (importer *gaiaImport) galaxyId(ctx context.Context, ugc_number string) (int64, error) {
+	if id, ok := importer.galaxy_ids[ugc_number]; ok {
+		return id, nil
+	}
+
+	found, err := importer.galaxies.FindGalaxy(ctx, ugc_number)
+	if errors.Is(err, sql.ErrNoRows) {
+		importer.galaxy_ids[ugc_number] = 0
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	importer.galaxy_ids[ugc_number] = found.Id
+	return found.Id, nil
+}
+
+// Find the mapped columns in header. source_id must be there, and so must ugc_number unless
+// options.Galaxy is set. Other columns are optional, unless options.Columns names them.
+func newGaiaMapping(header []string, options GaiaOptions) (gaiaMapping, error) {
+	mapping := gaiaMapping{source_id: -1, name: -1, ugc_number: -1, frame: options.Frame}
+
+	for column := range options.Columns {
+		if _, ok := DefaultGaiaColumns[column]; !ok {
+			return mapping, fmt.Errorf("unknown stars column %s", column)
+		}
+	}
+
+	position := map[string]int{}
+	for i, name := range header {
+		position[name] = i
+	}
+
+	star_fields := map[string]int{}
+	for i, column := range database.Columns(gaiaStar{}) {
+		star_fields[column] = i
+	}
+
+	for column, csv_column := range DefaultGaiaColumns {
+		if override, ok := options.Columns[column]; ok {
+			csv_column = override
+		}
+
+		i, found := position[csv_column]
+		if !found {
+			_, explicit := options.Columns[column]
+			switch {
+			case explicit:
+				return mapping, fmt.Errorf("column %s, mapped to %s, is not in the header", csv_column, column)
+			case column == "gaia_catalogue_id":
+				return mapping, fmt.Errorf("the header has no %s column for the Gaia source_id", csv_column)
+			case column == "ugc_number" && options.Galaxy == "":
+				return mapping, fmt.Errorf("the header has no %s column, and no galaxy was given", csv_column)
+			}
+			continue
+		}
+
+		switch column {
+		case "gaia_catalogue_id":
+			mapping.source_id = i
+		case "name":
+			mapping.name = i
+		case "ugc_number":
+			mapping.ugc_number = i
+		default:
+			mapping.floats = append(mapping.floats, floatColumn{name: column, record: i, field: star_fields[column]})
+		}
+	}
+
+	return mapping, nil
+}
+
+// Parse a record into a star, without its galaxy, and return the record's ugc_number.
+// Empty and "null" cells are missing values.
+func (mapping gaiaMapping) parse(record []string) (gaiaStar, string, error) {
+	var star gaiaStar
+
+	source_id := record[mapping.source_id]
+	if id, err := strconv.ParseInt(source_id, 10, 64); err != nil || id <= 0 {
+		return star, "", fmt.Errorf("source_id %q is not a positive integer", source_id)
+	}
+	star.GaiaCatalogueId = source_id
+
+	star.Name = designationPrefix + source_id
+	if mapping.name >= 0 && record[mapping.name] != "" {
+		star.Name = record[mapping.name]
+	}
+
+	fields := database.FieldPointers(&star)
+	for _, column := range mapping.floats {
+		text := record[column.record]
+		if text == "" || text == "null" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return star, "", fmt.Errorf("%s %q is not a number", column.name, text)
+		}
+		if bounds, ok := valueRanges[column.name]; ok && (value < bounds[0] || value > bounds[1]) {
+			return star, "", fmt.Errorf("%s %v is outside %v to %v", column.name, value, bounds[0], bounds[1])
+		}
+		*(fields[column.field].(**float64)) = &value
+	}
+
+	if mapping.frame != "" && mapping.frame != coords.ICRS {
+		if star.Ra == nil || star.Dec == nil {
+			return star, "", fmt.Errorf("a %s position needs both ra and dec", mapping.frame)
+		}
+		ra, dec := coords.ToICRS(mapping.frame, *star.Ra, *star.Dec)
+		star.Ra, star.Dec = &ra, &dec
+	}
+
+	var ugc_number string
+	if mapping.ugc_number >= 0 {
+		ugc_number = record[mapping.ugc_number]
+	}
+
+	return star, ugc_number, nil
+}
+
+// votableRecords reads the rows of a VOTable as text, so that they can be imported like CSV
+type votableRecords struct {
+	reader      *votable.Reader
+	read_header bool
+}
+
+func (records *votableRecords) Read() ([]string, error) {
+	if !records.read_header {
+		records.read_header = true
+		var header []string
+		for _, field := range records.reader.Fields() {
+			header = append(header, field.Name)
+		}
+		return header, nil
+	}
+
+	row, err := records.reader.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	// Nulls become empty cells
+	record := make([]string, len(row))
+	for i, value := range row {
+		switch value := value.(type) {
+		case float64:
+			record[i] = strconv.FormatFloat(value, 'g', -1, 64)
+		case nil:
+		default:
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return record, nil
+}
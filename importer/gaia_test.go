@@ -0,0 +1,170 @@
+// Tests for ImportGaia
+package importer
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+	"star-catalog/galaxy"
+	"star-catalog/healpix"
+)
+
+// TestImportGaia imports a file with good and bad rows, in batches of 2 so that a duplicate
+// source_id makes a batch fall back to row by row inserts, and checks what was rejected
+func TestImportGaia(t *testing.T) {
+	db := database.InitDB()
+
+	csv := "# Gaia archive export\n" +
+		"source_id,ra,dec,parallax,phot_g_mean_mag,ugc_number\n" +
+		"1001,10.68,41.27,0.01,20.1,ugc_number2\n" +
+		"1002,10.70,41.30,,null,ugc_number2\n" +
+		"1003,400,41.30,,,ugc_number2\n" +
+		"1001,10.68,41.27,0.01,20.1,ugc_number2\n" +
+		"1004,10.71,41.31,,,not_a_galaxy\n" +
+		"abc,10.71,41.31,,,ugc_number2\n" +
+		"1005,10.72,41.32,0.02,19.9,ugc_number1\n" +
+		"1006,10.73\n"
+
+	var rejects bytes.Buffer
+	result, err := ImportGaia(context.Background(), db, galaxy.NewSQLStore(db), strings.NewReader(csv),
+		GaiaOptions{BatchSize: 2, Rejects: &rejects})
+	if err != nil {
+		t.Fatalf(`ImportGaia %v`, err)
+	}
+
+	want := GaiaResult{Rows: 8, Imported: 3, Rejected: 5}
+	if result != want {
+		t.Fatalf(`ImportGaia should return %+v, is %+v`, want, result)
+	}
+
+	lines := strings.Split(strings.TrimSpace(rejects.String()), "\n")
+	if len(lines) != 6 || !strings.HasSuffix(lines[0], ",reject_reason") {
+		t.Fatalf(`Rejects should be a header and 5 rows, is %q`, rejects.String())
+	}
+	for _, reason := range []string{"ra 400 is outside 0 to 360", "\n1001,", "not_a_galaxy\"\"\"", "is not a positive integer", "wrong number of fields"} {
+		if !strings.Contains(rejects.String(), reason) {
+			t.Fatalf(`Rejects should contain %s, is %s`, reason, rejects.String())
+		}
+	}
+
+	var name string
+	var phot_g_mean_mag *float64
+	err = db.QueryRow("SELECT name, phot_g_mean_mag FROM stars WHERE gaia_catalogue_id = '1002'").Scan(&name, &phot_g_mean_mag)
+	if err != nil || name != "Gaia DR3 1002" || phot_g_mean_mag != nil {
+		t.Fatalf(`Star 1002 should be named Gaia DR3 1002 with no G magnitude, is %s, %v, %v`, name, phot_g_mean_mag, err)
+	}
+
+	var pixel int64
+	err = db.QueryRow("SELECT healpix FROM stars WHERE gaia_catalogue_id = '1005'").Scan(&pixel)
+	if want := healpix.Pixel(healpix.DefaultOrder, 10.72, 41.32); err != nil || pixel != want {
+		t.Fatalf(`Star 1005 should be in HEALPix pixel %d, is %d, %v`, want, pixel, err)
+	}
+}
+
+// TestImportGaiaColumns imports a file with its own column names into one galaxy
+func TestImportGaiaColumns(t *testing.T) {
+	db := database.InitDB()
+
+	csv := "id,name,ra_icrs,de_icrs\n" +
+		"2001,Star X,10.68,41.27\n"
+
+	options := GaiaOptions{
+		Columns: map[string]string{"gaia_catalogue_id": "id", "name": "name", "ra": "ra_icrs", "dec": "de_icrs"},
+		Galaxy:  "ugc_number2",
+	}
+	result, err := ImportGaia(context.Background(), db, galaxy.NewSQLStore(db), strings.NewReader(csv), options)
+	if err != nil || result.Imported != 1 {
+		t.Fatalf(`ImportGaia should import 1 star, is %+v, %v`, result, err)
+	}
+
+	var dec float64
+	err = db.QueryRow("SELECT " + db.Dialect.QuoteIdentifier("dec") + " FROM stars WHERE name = 'Star X'").Scan(&dec)
+	if err != nil || dec != 41.27 {
+		t.Fatalf(`Star X should have dec 41.27, is %v, %v`, dec, err)
+	}
+}
+
+// TestImportGaiaFrame imports Galactic positions, which are converted to ICRS, and rejects
+// a row with only a longitude
+func TestImportGaiaFrame(t *testing.T) {
+	db := database.InitDB()
+
+	csv := "source_id,l,b\n" +
+		"3001,121.1743,-21.5733\n" +
+		"3002,121.1743,\n"
+
+	var rejects bytes.Buffer
+	options := GaiaOptions{
+		Columns: map[string]string{"ra": "l", "dec": "b"},
+		Galaxy:  "ugc_number2",
+		Frame:   coords.Galactic,
+		Rejects: &rejects,
+	}
+	result, err := ImportGaia(context.Background(), db, galaxy.NewSQLStore(db), strings.NewReader(csv), options)
+	if err != nil || result.Imported != 1 || !strings.Contains(rejects.String(), "a galactic position needs both ra and dec") {
+		t.Fatalf(`ImportGaia should import 1 star and reject 1, is %+v, %v, %s`, result, err, rejects.String())
+	}
+
+	var ra, dec float64
+	err = db.QueryRow("SELECT ra, "+db.Dialect.QuoteIdentifier("dec")+" FROM stars WHERE gaia_catalogue_id = '3001'").Scan(&ra, &dec)
+	if err != nil || math.Abs(ra-10.6847) > 1e-3 || math.Abs(dec-41.2688) > 1e-3 {
+		t.Fatalf(`Star 3001 should be at M31's ICRS position, is %v, %v, %v`, ra, dec, err)
+	}
+}
+
+// TestImportGaiaMissingColumns checks that files without the needed columns are refused
+func TestImportGaiaMissingColumns(t *testing.T) {
+	db := database.InitDB()
+	store := galaxy.NewSQLStore(db)
+
+	tests := []struct {
+		csv     string
+		options GaiaOptions
+		want    string
+	}{
+		{"ra,dec,ugc_number\n", GaiaOptions{}, "no source_id column"},
+		{"source_id,ra,dec\n", GaiaOptions{}, "no ugc_number column"},
+		{"source_id,ugc_number\n", GaiaOptions{Columns: map[string]string{"ra": "ra_icrs"}}, "ra_icrs, mapped to ra"},
+		{"source_id,ugc_number\n", GaiaOptions{Columns: map[string]string{"colour": "bp_rp"}}, "unknown stars column colour"},
+	}
+
+	for _, test := range tests {
+		_, err := ImportGaia(context.Background(), db, store, strings.NewReader(test.csv), test.options)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Fatalf(`ImportGaia should fail with %s, is %v`, test.want, err)
+		}
+	}
+}
+
+// TestImportGaiaVOTable imports a VOTable, as the Gaia archive returns query results
+func TestImportGaiaVOTable(t *testing.T) {
+	db := database.InitDB()
+
+	document := `<?xml version="1.0" encoding="UTF-8"?>
+<VOTABLE version="1.4" xmlns="http://www.ivoa.net/xml/VOTable/v1.3"><RESOURCE><TABLE>
+<FIELD name="source_id" datatype="long"/>
+<FIELD name="designation" datatype="char" arraysize="*"/>
+<FIELD name="ra" datatype="double" unit="deg"/>
+<FIELD name="parallax" datatype="double" unit="mas"/>
+<DATA><TABLEDATA>
+<TR><TD>5001</TD><TD>Gaia DR3 5001</TD><TD>10.68</TD><TD/></TR>
+<TR><TD>5002</TD><TD>Gaia DR3 5002</TD><TD>-3</TD><TD>0.5</TD></TR>
+</TABLEDATA></DATA></TABLE></RESOURCE></VOTABLE>`
+
+	options := GaiaOptions{Format: "votable", Galaxy: "ugc_number2"}
+	result, err := ImportGaia(context.Background(), db, galaxy.NewSQLStore(db), strings.NewReader(document), options)
+	if want := (GaiaResult{Rows: 2, Imported: 1, Rejected: 1}); result != want || err != nil {
+		t.Fatalf(`ImportGaia should return %+v, is %+v, %v`, want, result, err)
+	}
+
+	var parallax *float64
+	err = db.QueryRow("SELECT parallax FROM stars WHERE name = 'Gaia DR3 5001'").Scan(&parallax)
+	if err != nil || parallax != nil {
+		t.Fatalf(`Gaia DR3 5001 should have no parallax, is %v, %v`, parallax, err)
+	}
+}
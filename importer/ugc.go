@@ -0,0 +1,514 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"star-catalog/astro"
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+	"star-catalog/galaxy"
+	"star-catalog/votable"
+)
+
+// DefaultUGCColumns maps each galaxies table column to the HEASARC UGC table field it is read
+// from. Only ugc_number has to be in the file.
+var DefaultUGCColumns = map[string]string{
+	"ugc_number":            "name",
+	"name":                  "alt_name",
+	"ra":                    "ra",
+	"dec":                   "dec",
+	"morphological_type":    "morph_type",
+	"major_diameter":        "major_diam",
+	"minor_diameter":        "minor_diam",
+	"position_angle":        "pos_angle",
+	"blue_magnitude":        "bmag",
+	"heliocentric_velocity": "velocity",
+	"redshift":              "redshift",
+	"distance":              "distance",
+}
+
+// UGCOptions control how ImportUGC reads a file. The zero value reads HEASARC's
+// pipe-separated ASCII output, using the field names in its header line.
+type UGCOptions struct {
+	// Format is "", the default, for text, or "votable" for a VOTable, which is read with
+	// package votable. A VOTable with a ugc_number field, such as one written by the export
+	// command, has fields named by the galaxies columns, and others have HEASARC's.
+	Format string
+	// Columns overrides DefaultUGCColumns for the galaxies columns it names
+	Columns map[string]string
+	// Fixed gives the bytes each galaxies column is read from, like "1-5", numbered from 1
+	// as in a catalogue's ReadMe. If it is set, the file is read as fixed-width text with
+	// no header, and Columns is ignored. It is ignored for VOTables.
+	Fixed map[string]string
+	// Frame is the frame of the positions in the ra and dec columns, which are then its
+	// longitude and latitude in degrees. They are converted to ICRS, which is the default.
+	Frame coords.Frame
+}
+
+// UGCResult counts the galaxies ImportUGC added, changed, and found already up to date.
+type UGCResult struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+}
+
+// A ugcRow is one galaxy read from the file, and the galaxies columns the file gave for it
+type ugcRow struct {
+	galaxy  galaxy.Galaxy
+	columns []string
+}
+
+// A byteRange is a fixed-width field, as 0-based start and end offsets into a line
+type byteRange struct {
+	start int
+	end   int
+}
+
+// ImportUGC reads UGC catalogue rows from reader and upserts them into the galaxies table,
+// keyed on ugc_number. Only the columns in the file are written, so values loaded from
+// elsewhere are kept; a blank field sets its column to NULL. Redshift and distance are
+// derived from the heliocentric velocity, unless the file has them, as in SeedFixtures.
+// UGC numbers are written as "UGC <n>", whether the file has "12158", "UGC12158" or
+// "UGC 12158". The whole file is imported in one transaction, and the first bad row
+// stops the import with nothing changed.
+func ImportUGC(ctx context.Context, db *database.DB, reader io.Reader, options UGCOptions) (UGCResult, error) {
+	var result UGCResult
+
+	rows, err := readUGC(reader, options)
+	if err != nil {
+		return result, fmt.Errorf("ImportUGC: %w", err)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("ImportUGC: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, row := range rows {
+		if err := upsertGalaxy(ctx, db, tx, row, &result); err != nil {
+			return UGCResult{}, fmt.Errorf("ImportUGC %s: %w", row.galaxy.UgcNumber, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return UGCResult{}, fmt.Errorf("ImportUGC: %w", err)
+	}
+
+	return result, nil
+}
+
+// Insert the galaxy in row, or update the existing galaxy with its ugc_number if any of the
+// row's columns differ, counting which it was in result
+func upsertGalaxy(ctx context.Context, db *database.DB, tx *sql.Tx, row ugcRow, result *UGCResult) error {
+	values := columnValues(row.galaxy)
+
+	var existing galaxy.Galaxy
+	query := db.Rebind("SELECT " + db.ColumnList(galaxy.Galaxy{}) + " FROM galaxies WHERE ugc_number = ?")
+	err := database.ScanStruct(tx.QueryRowContext(ctx, query, row.galaxy.UgcNumber), &existing)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		columns := row.columns
+		// name can't be NULL, so galaxies without one are named by their UGC number
+		if row.galaxy.Name == "" {
+			columns = append(columns, "name")
+			values["name"] = row.galaxy.UgcNumber
+		}
+
+		args := make([]any, len(columns))
+		for i, column := range columns {
+			args[i] = values[column]
+		}
+		query := "INSERT INTO galaxies (" + db.QuoteList(columns) + ") VALUES (" + database.Placeholders(len(columns)) + ")"
+		if _, err := tx.ExecContext(ctx, db.Rebind(query), args...); err != nil {
+			return err
+		}
+		result.Inserted++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	existing_values := columnValues(existing)
+
+	var set []string
+	var args []any
+	for _, column := range row.columns {
+		if column == "ugc_number" || sameValue(values[column], existing_values[column]) {
+			continue
+		}
+		set = append(set, db.Dialect.QuoteIdentifier(column)+" = ?")
+		args = append(args, values[column])
+	}
+
+	if len(set) == 0 {
+		result.Unchanged++
+		return nil
+	}
+
+	query = "UPDATE galaxies SET " + strings.Join(set, ", ") + " WHERE id = ?"
+	if _, err := tx.ExecContext(ctx, db.Rebind(query), append(args, existing.Id)...); err != nil {
+		return err
+	}
+	result.Updated++
+	return nil
+}
+
+// Return the values of a Galaxy's fields by column name
+func columnValues(g galaxy.Galaxy) map[string]any {
+	columns := database.Columns(g)
+	values := map[string]any{}
+	for i, value := range database.FieldValues(g) {
+		values[columns[i]] = value
+	}
+	return values
+}
+
+// Report whether two field values of a Galaxy are equal, comparing what pointer fields point to
+func sameValue(a any, b any) bool {
+	value_a, value_b := reflect.ValueOf(a), reflect.ValueOf(b)
+	if value_a.Kind() == reflect.Pointer {
+		if value_a.IsNil() || value_b.IsNil() {
+			return value_a.IsNil() == value_b.IsNil()
+		}
+		value_a, value_b = value_a.Elem(), value_b.Elem()
+	}
+	return value_a.Interface() == value_b.Interface()
+}
+
+// Read every row of the file, so that it can be checked before the database is touched.
+// The UGC has under 13000 galaxies, so it fits in memory easily.
+func readUGC(reader io.Reader, options UGCOptions) ([]ugcRow, error) {
+	switch options.Format {
+	case "":
+	case "votable":
+		return readUGCVOTable(reader, options)
+	default:
+		return nil, fmt.Errorf("unknown format %q", options.Format)
+	}
+
+	var split func(line string) (map[string]string, error)
+	var err error
+
+	scanner := bufio.NewScanner(reader)
+	line_number := 0
+
+	if len(options.Fixed) > 0 {
+		split, err = fixedWidthSplitter(options.Fixed)
+	} else {
+		// The header is the first line of pipe-separated output
+		for scanner.Scan() {
+			line_number++
+			if strings.TrimSpace(scanner.Text()) != "" {
+				split, err = pipeSplitter(scanner.Text(), options.Columns)
+				break
+			}
+		}
+		if split == nil && err == nil {
+			err = errors.New("the file has no header line")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []ugcRow
+	for scanner.Scan() {
+		line_number++
+		line := scanner.Text()
+		// Skip blank lines, and the dashed lines some output puts under the header
+		if strings.Trim(line, " |-+") == "" {
+			continue
+		}
+
+		fields, err := split(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line_number, err)
+		}
+		row, err := parseUGCRow(fields, options.Frame)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line_number, err)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+// Return a function that splits a pipe-separated line into fields by galaxies column, using
+// the field names in header and the column mapping
+func pipeSplitter(header string, columns map[string]string) (func(string) (map[string]string, error), error) {
+	if !strings.HasPrefix(strings.TrimSpace(header), "|") {
+		return nil, errors.New("the header should be pipe-separated field names, or give fixed-width columns")
+	}
+
+	var names []string
+	for _, name := range strings.Split(header, "|") {
+		names = append(names, strings.TrimSpace(name))
+	}
+	mapped, err := mapUGCFields(names, columns, DefaultUGCColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(line string) (map[string]string, error) {
+		values := strings.Split(line, "|")
+		fields := map[string]string{}
+		for column, i := range mapped {
+			if i >= len(values) {
+				return nil, fmt.Errorf("no %s field", column)
+			}
+			fields[column] = strings.TrimSpace(values[i])
+		}
+		return fields, nil
+	}, nil
+}
+
+// Map each galaxies column to the position of its field in names, the field names of a
+// header, using defaults and the overrides in columns
+func mapUGCFields(names []string, columns map[string]string, defaults map[string]string) (map[string]int, error) {
+	position := map[string]int{}
+	for i, name := range names {
+		position[name] = i
+	}
+
+	for column := range columns {
+		if _, ok := DefaultUGCColumns[column]; !ok {
+			return nil, fmt.Errorf("unknown galaxies column %s", column)
+		}
+	}
+
+	mapped := map[string]int{}
+	for column, field := range defaults {
+		override, explicit := columns[column]
+		if explicit {
+			field = override
+		}
+
+		i, found := position[field]
+		switch {
+		case found:
+			mapped[column] = i
+		case explicit:
+			return nil, fmt.Errorf("field %s, mapped to %s, is not in the header", field, column)
+		case column == "ugc_number":
+			return nil, fmt.Errorf("the header has no %s field for the UGC number", field)
+		}
+	}
+	return mapped, nil
+}
+
+// Read every row of a VOTable. If it has a ugc_number field, its fields are named by the
+// galaxies columns, and otherwise by HEASARC's field names, as in DefaultUGCColumns.
+func readUGCVOTable(reader io.Reader, options UGCOptions) ([]ugcRow, error) {
+	votable_reader, err := votable.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	records := &votableRecords{reader: votable_reader}
+	header, err := records.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	defaults := DefaultUGCColumns
+	if slices.Contains(header, "ugc_number") {
+		defaults = map[string]string{}
+		for column := range DefaultUGCColumns {
+			defaults[column] = column
+		}
+	}
+	mapped, err := mapUGCFields(header, options.Columns, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []ugcRow
+	for row_number := 1; ; row_number++ {
+		record, err := records.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row_number, err)
+		}
+
+		fields := map[string]string{}
+		for column, i := range mapped {
+			fields[column] = strings.TrimSpace(record[i])
+		}
+		row, err := parseUGCRow(fields, options.Frame)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row_number, err)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// Return a function that splits a fixed-width line into fields by galaxies column. Each
+// column has a byte range like "1-5", or a single byte like "6".
+func fixedWidthSplitter(fixed map[string]string) (func(string) (map[string]string, error), error) {
+	ranges := map[string]byteRange{}
+	for column, text := range fixed {
+		if _, ok := DefaultUGCColumns[column]; !ok {
+			return nil, fmt.Errorf("unknown galaxies column %s", column)
+		}
+
+		start_text, end_text, found := strings.Cut(text, "-")
+		if !found {
+			end_text = start_text
+		}
+		start, start_err := strconv.Atoi(strings.TrimSpace(start_text))
+		end, end_err := strconv.Atoi(strings.TrimSpace(end_text))
+		if start_err != nil || end_err != nil || start < 1 || end < start {
+			return nil, fmt.Errorf("%s bytes should be like 1-5, are %q", column, text)
+		}
+		ranges[column] = byteRange{start: start - 1, end: end}
+	}
+	if _, ok := ranges["ugc_number"]; !ok {
+		return nil, errors.New("fixed-width columns should include ugc_number")
+	}
+
+	return func(line string) (map[string]string, error) {
+		fields := map[string]string{}
+		for column, bytes := range ranges {
+			// Trailing blank fields are often trimmed from the end of the line
+			start, end := min(bytes.start, len(line)), min(bytes.end, len(line))
+			fields[column] = strings.TrimSpace(line[start:end])
+		}
+		return fields, nil
+	}, nil
+}
+
+// Parse the fields of a row, by galaxies column, into a Galaxy. Blank fields are left nil,
+// and redshift and distance are derived from the velocity if the file doesn't have them.
+// A position in another frame is converted to ICRS.
+func parseUGCRow(fields map[string]string, frame coords.Frame) (ugcRow, error) {
+	var row ugcRow
+
+	ugc_number := normalizeUGCNumber(fields["ugc_number"])
+	if ugc_number == "" {
+		return row, errors.New("no UGC number")
+	}
+	row.galaxy.UgcNumber = ugc_number
+	row.columns = append(row.columns, "ugc_number")
+
+	if name := fields["name"]; name != "" {
+		row.galaxy.Name = name
+		row.columns = append(row.columns, "name")
+	}
+
+	if _, ok := fields["morphological_type"]; ok {
+		row.columns = append(row.columns, "morphological_type")
+		if morphological_type := fields["morphological_type"]; morphological_type != "" {
+			row.galaxy.MorphologicalType = &morphological_type
+		}
+	}
+
+	float_fields := map[string]**float64{
+		"ra":                    &row.galaxy.Ra,
+		"dec":                   &row.galaxy.Dec,
+		"major_diameter":        &row.galaxy.MajorDiameter,
+		"minor_diameter":        &row.galaxy.MinorDiameter,
+		"position_angle":        &row.galaxy.PositionAngle,
+		"blue_magnitude":        &row.galaxy.BlueMagnitude,
+		"heliocentric_velocity": &row.galaxy.HeliocentricVelocity,
+		"redshift":              &row.galaxy.Redshift,
+		"distance":              &row.galaxy.Distance,
+	}
+	// In a fixed order, so that rows list their columns the same way every time
+	for _, column := range database.Columns(galaxy.Galaxy{}) {
+		field, ok := float_fields[column]
+		text, found := fields[column]
+		if !ok || !found {
+			continue
+		}
+		row.columns = append(row.columns, column)
+		if text == "" {
+			continue
+		}
+
+		value, err := parseUGCValue(column, text, frame)
+		if err != nil {
+			return row, err
+		}
+		*field = &value
+	}
+
+	if frame != "" && frame != coords.ICRS && (row.galaxy.Ra != nil || row.galaxy.Dec != nil) {
+		if row.galaxy.Ra == nil || row.galaxy.Dec == nil {
+			return row, fmt.Errorf("a %s position needs both ra and dec", frame)
+		}
+		ra, dec := coords.ToICRS(frame, *row.galaxy.Ra, *row.galaxy.Dec)
+		row.galaxy.Ra, row.galaxy.Dec = &ra, &dec
+	}
+
+	if velocity := row.galaxy.HeliocentricVelocity; velocity != nil {
+		if row.galaxy.Redshift == nil {
+			redshift := astro.Redshift(*velocity)
+			row.galaxy.Redshift = &redshift
+			if !slices.Contains(row.columns, "redshift") {
+				row.columns = append(row.columns, "redshift")
+			}
+		}
+		if distance, ok := astro.HubbleDistance(*velocity); ok && row.galaxy.Distance == nil {
+			row.galaxy.Distance = &distance
+			if !slices.Contains(row.columns, "distance") {
+				row.columns = append(row.columns, "distance")
+			}
+		}
+	}
+
+	return row, nil
+}
+
+// Parse a number. ra and dec can also be sexagesimal, as HEASARC writes them:
+// hours, minutes and seconds of RA, and degrees, minutes and seconds of dec. In frames other
+// than ICRS, sexagesimal longitudes are in degrees.
+func parseUGCValue(column string, text string, frame coords.Frame) (float64, error) {
+	var value float64
+	var err error
+
+	switch {
+	case column == "ra" && (frame == "" || frame == coords.ICRS):
+		value, err = coords.ParseRa(text)
+	case column == "ra" || column == "dec":
+		value, err = coords.ParseAngle(text)
+	default:
+		value, err = strconv.ParseFloat(text, 64)
+	}
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("%s %q is not a number", column, text)
+	}
+
+	if bounds, ok := valueRanges[column]; ok && (value < bounds[0] || value > bounds[1]) {
+		return 0, fmt.Errorf("%s %v is outside %v to %v", column, value, bounds[0], bounds[1])
+	}
+	return value, nil
+}
+
+// Write a UGC number as "UGC <n>", without leading zeros. Anything that isn't a UGC number
+// is left as it is.
+func normalizeUGCNumber(text string) string {
+	text = strings.TrimSpace(text)
+	number := strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(text), "UGC"))
+
+	// Keep any suffix, such as the A of UGC 5340A
+	digits := strings.TrimRight(number, "ABCDEFGHIJKLMNOPQRSTUVWXYZ")
+	n, err := strconv.Atoi(digits)
+	if err != nil || n <= 0 {
+		return text
+	}
+	return "UGC " + strconv.Itoa(n) + number[len(digits):]
+}
@@ -0,0 +1,187 @@
+// Tests for ImportUGC
+package importer
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"star-catalog/astro/coords"
+	"star-catalog/database"
+	"star-catalog/galaxy"
+	"star-catalog/votable"
+)
+
+// ugcFile is HEASARC-style pipe-separated output with two galaxies
+const ugcFile = `|name      |alt_name |ra          |dec        |morph_type|major_diam|pos_angle|velocity|
+|----------|---------|------------|-----------|----------|----------|---------|--------|
+|UGC 12158 |NGC 7479 |23 04 56.6  |+12 19 22  |SBbc      |4.1       |25       |2381    |
+|00001     |         |0.771       |21.961     |          |          |         |        |
+`
+
+// TestImportUGC imports the same file twice, then a changed copy, and checks what was
+// inserted, updated and left unchanged
+func TestImportUGC(t *testing.T) {
+	db := database.InitDB()
+	ctx := context.Background()
+
+	result, err := ImportUGC(ctx, db, strings.NewReader(ugcFile), UGCOptions{})
+	if want := (UGCResult{Inserted: 2}); result != want || err != nil {
+		t.Fatalf(`ImportUGC should return %+v, is %+v, %v`, want, result, err)
+	}
+
+	result, err = ImportUGC(ctx, db, strings.NewReader(ugcFile), UGCOptions{})
+	if want := (UGCResult{Unchanged: 2}); result != want || err != nil {
+		t.Fatalf(`ImportUGC again should return %+v, is %+v, %v`, want, result, err)
+	}
+
+	changed := strings.Replace(ugcFile, "SBbc", "SB(s)bc", 1)
+	result, err = ImportUGC(ctx, db, strings.NewReader(changed), UGCOptions{})
+	if want := (UGCResult{Updated: 1, Unchanged: 1}); result != want || err != nil {
+		t.Fatalf(`ImportUGC with a change should return %+v, is %+v, %v`, want, result, err)
+	}
+
+	store := galaxy.NewSQLStore(db)
+	ngc7479, err := store.FindGalaxy(ctx, "UGC 12158")
+	if err != nil {
+		t.Fatalf(`FindGalaxy %v`, err)
+	}
+	if ngc7479.Name != "NGC 7479" || *ngc7479.MorphologicalType != "SB(s)bc" || math.Abs(*ngc7479.Ra-346.2358) > 0.0001 || math.Abs(*ngc7479.Dec-12.3228) > 0.0001 {
+		t.Fatalf(`NGC 7479 should be SB(s)bc at 346.2358 12.3228, is %+v`, ngc7479)
+	}
+	if math.Abs(*ngc7479.Distance-34.01) > 0.01 || math.Abs(*ngc7479.Redshift-0.00794) > 0.00001 {
+		t.Fatalf(`NGC 7479 should have a derived distance of 34.01 Mpc and redshift 0.00794, is %v, %v`, *ngc7479.Distance, *ngc7479.Redshift)
+	}
+
+	ugc1, err := store.FindGalaxy(ctx, "UGC 1")
+	if err != nil || ugc1.Name != "UGC 1" || ugc1.MorphologicalType != nil || ugc1.Redshift != nil {
+		t.Fatalf(`UGC 1 should be named by its number, with no type or redshift, is %+v, %v`, ugc1, err)
+	}
+}
+
+// TestImportUGCFixedWidth imports fixed-width text, updating an existing galaxy
+func TestImportUGCFixedWidth(t *testing.T) {
+	db := database.InitDB()
+
+	file := "ugc_number2 SA(s)b   4.36\n" +
+		"UGC00454    SA(s)b   4.36\n"
+	options := UGCOptions{Fixed: map[string]string{"ugc_number": "1-12", "morphological_type": "13-19", "blue_magnitude": "22-25"}}
+
+	result, err := ImportUGC(context.Background(), db, strings.NewReader(file), options)
+	if want := (UGCResult{Inserted: 1, Unchanged: 1}); result != want || err != nil {
+		t.Fatalf(`ImportUGC should return %+v, is %+v, %v`, want, result, err)
+	}
+
+	var blue_magnitude float64
+	err = db.QueryRow("SELECT blue_magnitude FROM galaxies WHERE ugc_number = 'UGC 454'").Scan(&blue_magnitude)
+	if err != nil || blue_magnitude != 4.36 {
+		t.Fatalf(`UGC 454 should have a blue magnitude of 4.36, is %v, %v`, blue_magnitude, err)
+	}
+}
+
+// TestImportUGCBadRow checks that a bad row stops the import with nothing changed
+func TestImportUGCBadRow(t *testing.T) {
+	db := database.InitDB()
+
+	bad := ugcFile + "|UGC 2     |         |0.771       |95         |          |          |         |        |\n"
+	_, err := ImportUGC(context.Background(), db, strings.NewReader(bad), UGCOptions{})
+	if err == nil || !strings.Contains(err.Error(), "line 5: dec 95 is outside -90 to 90") {
+		t.Fatalf(`ImportUGC should fail on line 5, is %v`, err)
+	}
+
+	var got int
+	err = db.QueryRow("SELECT COUNT(*) FROM galaxies").Scan(&got)
+	if got != 2 || err != nil {
+		t.Fatalf(`Galaxy rows should be %d, is %d, %v`, 2, got, err)
+	}
+}
+
+// TestImportUGCFrame imports galactic positions, which should be stored as ICRS, and checks
+// that a row with only one coordinate fails
+func TestImportUGCFrame(t *testing.T) {
+	db := database.InitDB()
+	ctx := context.Background()
+
+	file := "|name |ra     |dec  |\n" +
+		"|2    |121.17 |21.57|\n"
+	result, err := ImportUGC(ctx, db, strings.NewReader(file), UGCOptions{Frame: coords.Galactic})
+	if want := (UGCResult{Inserted: 1}); result != want || err != nil {
+		t.Fatalf(`ImportUGC should return %+v, is %+v, %v`, want, result, err)
+	}
+
+	ugc2, err := galaxy.NewSQLStore(db).FindGalaxy(ctx, "UGC 2")
+	ra, dec := coords.ToICRS(coords.Galactic, 121.17, 21.57)
+	if err != nil || math.Abs(*ugc2.Ra-ra) > 1e-9 || math.Abs(*ugc2.Dec-dec) > 1e-9 {
+		t.Fatalf(`UGC 2 should be at %v %v, is %+v, %v`, ra, dec, ugc2, err)
+	}
+
+	half := "|name |ra     |dec  |\n" +
+		"|3    |121.17 |     |\n"
+	_, err = ImportUGC(ctx, db, strings.NewReader(half), UGCOptions{Frame: coords.Galactic})
+	if err == nil || !strings.Contains(err.Error(), "needs both ra and dec") {
+		t.Fatalf(`ImportUGC should fail without a dec, is %v`, err)
+	}
+}
+
+// TestImportUGCVOTable imports galaxies from a VOTable written by votable.Writer, with the
+// galaxies columns, and from one with HEASARC's field names
+func TestImportUGCVOTable(t *testing.T) {
+	db := database.InitDB()
+	ctx := context.Background()
+
+	fields, err := votable.FieldsOf(galaxy.Galaxy{})
+	if err != nil {
+		t.Fatalf(`FieldsOf %v`, err)
+	}
+	var buffer bytes.Buffer
+	writer, err := votable.NewWriter(&buffer, "galaxies", fields, votable.Binary2)
+	if err != nil {
+		t.Fatalf(`NewWriter %v`, err)
+	}
+	ra, dec, velocity := 346.2358, 12.3228, 2381.0
+	writer.WriteStruct(galaxy.Galaxy{UgcNumber: "UGC 12158", Name: "NGC 7479", Ra: &ra, Dec: &dec, HeliocentricVelocity: &velocity})
+	if err := writer.Close(); err != nil {
+		t.Fatalf(`Close %v`, err)
+	}
+
+	result, err := ImportUGC(ctx, db, &buffer, UGCOptions{Format: "votable"})
+	if want := (UGCResult{Inserted: 1}); result != want || err != nil {
+		t.Fatalf(`ImportUGC should return %+v, is %+v, %v`, want, result, err)
+	}
+	store := galaxy.NewSQLStore(db)
+	ngc7479, err := store.FindGalaxy(ctx, "UGC 12158")
+	if err != nil || ngc7479.Name != "NGC 7479" || *ngc7479.Ra != ra || ngc7479.Redshift == nil {
+		t.Fatalf(`NGC 7479 should be at ra 346.2358 with a derived redshift, is %+v, %v`, ngc7479, err)
+	}
+
+	heasarc := `<VOTABLE><RESOURCE><TABLE>
+<FIELD name="name" datatype="char" arraysize="*"/><FIELD name="alt_name" datatype="char" arraysize="*"/><FIELD name="ra" datatype="double"/>
+<DATA><TABLEDATA><TR><TD>UGC 12158</TD><TD>NGC 7479</TD><TD>346.2358</TD></TR><TR><TD>00001</TD><TD/><TD>0.771</TD></TR></TABLEDATA></DATA>
+</TABLE></RESOURCE></VOTABLE>`
+	result, err = ImportUGC(ctx, db, strings.NewReader(heasarc), UGCOptions{Format: "votable"})
+	if want := (UGCResult{Inserted: 1, Unchanged: 1}); result != want || err != nil {
+		t.Fatalf(`ImportUGC with HEASARC's fields should return %+v, is %+v, %v`, want, result, err)
+	}
+	if ugc1, err := store.FindGalaxy(ctx, "UGC 1"); err != nil || *ugc1.Ra != 0.771 {
+		t.Fatalf(`UGC 1 should be at ra 0.771, is %+v, %v`, ugc1, err)
+	}
+}
+
+// TestNormalizeUGCNumber checks the forms UGC numbers are written in
+func TestNormalizeUGCNumber(t *testing.T) {
+	tests := map[string]string{
+		"12158":      "UGC 12158",
+		"UGC12158":   "UGC 12158",
+		" UGC 00454": "UGC 454",
+		"ugc 5340a":  "UGC 5340A",
+		"Milky Way":  "Milky Way",
+	}
+
+	for text, want := range tests {
+		if got := normalizeUGCNumber(text); got != want {
+			t.Fatalf(`normalizeUGCNumber(%q) should be %q, is %q`, text, want, got)
+		}
+	}
+}
@@ -1,110 +1,348 @@
 // Star-catalog processes all the stars associated with existing galaxies.
 // Each galaxy is processed in a separate goroutine.
-// Output goes to star-catalog.log
+// Output goes to star-catalog.log, and a report of each galaxy's stars to
+// star-catalog-report.md.
+// The run can be stopped with Ctrl-C or SIGTERM.
+// The migrate command manages the database schema, the seed command loads fixture data,
+// the import command loads external catalogues, the export command writes
+// the catalog to CSV, NDJSON, Parquet or FITS files, the cone command finds the stars
+// near a position, the healpix command indexes the stars' positions for it, and the
+// crossmatch command links the sources of another catalogue to their nearest stars.
 // See README.md for more details.
 package main
 
 import (
-	"database/sql"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"star-catalog/database"
 	galaxypkg "star-catalog/galaxy"
 	starpkg "star-catalog/star"
+	"star-catalog/stats"
 
+	"github.com/spf13/viper"
 	"golang.org/x/sync/errgroup"
 )
 
+// defaultConcurrency is the number of galaxies processed at once when pipeline.concurrency
+// isn't set in config.yml. Each galaxy being processed holds a database connection open.
+const defaultConcurrency = 10
+
+// defaultReportPath is the file the pipeline writes its catalog report to when stats.report
+// isn't set in config.yml
+const defaultReportPath = "star-catalog-report.md"
+
+// usage is shown when the command line isn't understood
+const usage = `usage: star-catalog [command]
+
+Commands:
+  run               process the stars of every galaxy (the default)
+  migrate up        apply all pending schema migrations
+  migrate down      revert the most recently applied schema migration
+  migrate status    list the schema migrations and whether they have been applied
+  seed [-clear] <file>...
+                    add the galaxies and stars in YAML, JSON or CSV fixture files,
+                    after removing all existing data if -clear is given
+  import gaia [-galaxy ugc_number] [-column star_column=csv_column]... [-batch n] [-rejects file]
+              [-frame icrs|galactic|ecliptic] <file>
+                    add the stars in a Gaia archive CSV or VOTable file, which may be gzipped
+  import ugc [-column galaxies_column=field]... [-fixed galaxies_column=start-end]...
+             [-frame icrs|galactic|ecliptic] <file>
+                    add or update the galaxies in a UGC catalogue file, in HEASARC's
+                    pipe-separated ASCII, fixed-width text or a VOTable
+  export [-table galaxies|stars|joined] [-columns c1,c2...] [-galaxy ugc_number]
+         [-format csv|ndjson|parquet|votable|fits] [-compress gzip|zstd] [-epoch epoch] <file>
+                    write the galaxies, the stars, or the stars with their galaxy,
+                    all of them or one galaxy's, to a file, or to standard output
+                    if the file is -. FITS files have GALAXIES and STARS tables
+  cone [-frame icrs|galactic|ecliptic] [-epoch epoch] <lon> <lat> <radius>
+                    list the stars within radius degrees of a position, in degrees or
+                    sexagesimal, nearest first, as CSV
+  healpix           give every star the HEALPix pixel of its position, which cone searches
+                    use, at the order healpix.order in config.yml
+  crossmatch [-tolerance arcsec] [-id column] [-ra column] [-dec column]
+             [-frame icrs|galactic|ecliptic] <file>
+                    match each source in a CSV or VOTable file to the nearest star within
+                    the tolerance, 1 arcsecond by default, and list the matches as CSV
+
+Epochs are Julian years like J2000 or dates like 2024-03-01. Stars are stored at
+Gaia's epoch, J2016.0, and -epoch moves them by their proper motions.`
+
 func main() {
 	initLogger()
 
-	// Database handle is passed to methods rather than making it global
-	db := database.InitDB()
-	Pipeline(db)
+	// Cancel the context on Ctrl-C or SIGTERM so the pipeline can shut down cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := runCommand(ctx, os.Args[1:]); err != nil {
+		log.Printf("main %v\n", err)
+		fmt.Fprintln(os.Stderr, err)
+		stop()
+		os.Exit(1)
+	}
+}
+
+// runCommand runs the command named by args[0], or the pipeline if there are no args.
+// Commands other than run report their results on standard output.
+func runCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return runPipeline(ctx)
+	}
+
+	switch args[0] {
+	case "run":
+		return runPipeline(ctx)
+	case "migrate":
+		return runMigrate(ctx, args[1:], os.Stdout)
+	case "seed":
+		return runSeed(ctx, args[1:], os.Stdout)
+	case "import":
+		return runImport(ctx, args[1:], os.Stdout)
+	case "export":
+		return runExport(ctx, args[1:], os.Stdout)
+	case "cone":
+		return runCone(ctx, args[1:], os.Stdout)
+	case "healpix":
+		return runHealpix(ctx, args[1:], os.Stdout)
+	case "crossmatch":
+		return runCrossmatch(ctx, args[1:], os.Stdout)
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", args[0], usage)
+}
+
+// runPipeline connects to the database and runs the Pipeline over it
+func runPipeline(ctx context.Context) error {
+	// Database handle is passed to methods rather than making it global.
+	// The data is left as it is; use the seed command to load fixtures.
+	db := database.ConnectDB()
+	defer db.Close()
+
+	// The config file has been read by ConnectDB
+	concurrency := viper.GetInt("pipeline.concurrency")
+
+	// Check the report's format before the run, rather than failing once the work is done
+	report_path := defaultReportPath
+	if viper.IsSet("stats.report") {
+		report_path = viper.GetString("stats.report")
+	}
+	var report_format string
+	if report_path != "" {
+		var err error
+		if report_format, err = stats.ReportFormat(report_path); err != nil {
+			return fmt.Errorf("runPipeline: %v", err)
+		}
+	}
+
+	galaxies := galaxypkg.NewSQLStore(db)
+	stars := starpkg.NewSQLStore(db)
+
+	// Further processors can be chained here with starpkg.ChainProcessors
+	collector := stats.NewCollector()
+	processor := starpkg.ChainProcessors(starpkg.StarProcessorFunc(ProcessStar), collector)
+	var writer *starpkg.DerivedWriter
+	if viper.GetBool("derived.save") {
+		writer = stars.NewDerivedWriter()
+		processor = starpkg.ChainProcessors(processor, starpkg.DeriveProcessor(parallaxOptions(), writer.Write))
+	}
+	err := Pipeline(ctx, galaxies, stars, processor, concurrency)
+
+	// Save the values of the stars that were processed, even if the pipeline was stopped
+	if writer != nil {
+		if flush_err := writer.Flush(context.WithoutCancel(ctx)); flush_err != nil {
+			log.Printf("runPipeline %v\n", flush_err)
+			if err == nil {
+				err = flush_err
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Stats are only saved for complete runs, so they always cover every star
+	return saveStats(ctx, db, galaxies, collector, report_path, report_format)
+}
+
+// saveStats saves the collector's stats to the galaxy_stats table, and writes the report to
+// path in format. runPipeline takes the path from config.yml's stats.report,
+// star-catalog-report.md by default, and the format from its extension. An empty path writes
+// no report.
+func saveStats(ctx context.Context, db *database.DB, galaxies galaxypkg.GalaxyStore, collector *stats.Collector, path string, format string) error {
+	galaxy_stats, err := collector.Stats(ctx, galaxies)
+	if err != nil {
+		return fmt.Errorf("saveStats: %v", err)
+	}
+	if err := stats.Save(ctx, db, galaxy_stats); err != nil {
+		return fmt.Errorf("saveStats: %v", err)
+	}
+
+	if path == "" {
+		return nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("saveStats: %v", err)
+	}
+	defer file.Close()
+
+	if err := stats.NewReport(galaxy_stats, time.Now()).Write(file, format); err != nil {
+		return fmt.Errorf("saveStats: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("saveStats: %v", err)
+	}
+	log.Printf("Catalog report written to %v\n", path)
+	return nil
+}
+
+// parallaxOptions returns the ParallaxOptions set in config.yml as derived.min_parallax_snr,
+// which defaults to starpkg.DefaultMinParallaxSNR, and derived.parallax_zero_point
+func parallaxOptions() starpkg.ParallaxOptions {
+	options := starpkg.ParallaxOptions{
+		ZeroPoint: viper.GetFloat64("derived.parallax_zero_point"),
+		MinSNR:    starpkg.DefaultMinParallaxSNR,
+	}
+	if viper.IsSet("derived.min_parallax_snr") {
+		options.MinSNR = viper.GetFloat64("derived.min_parallax_snr")
+	}
+	return options
 }
 
-func Pipeline(db *sql.DB) {
+// Pipeline reads all the galaxies from galaxies and processes each one in a separate
+// goroutine, calling processor for each of its stars from stars. At most concurrency
+// galaxies are in progress at once. If concurrency is 0 or less, defaultConcurrency is used.
+// Errors are logged, and the first one is returned. If ctx is cancelled, Pipeline stops
+// early and returns an error wrapping ctx.Err().
+func Pipeline(ctx context.Context, galaxies galaxypkg.GalaxyStore, stars starpkg.StarStore, processor starpkg.StarProcessor, concurrency int) error {
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	log.Printf("Pipeline starting with concurrency limit %d\n", concurrency)
+
+	// Cancelling pipeline_ctx stops the galaxy producer if processing ends early
+	pipeline_ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	galaxy_channel := make(chan galaxypkg.Galaxy)
 	error_channel := make(chan error, 1)
-	var err error
 
 	// Fill the sending channel in a separate goroutine to avoid blocking
-	go galaxypkg.GalaxyChannel(db, galaxy_channel, error_channel)
-
-	err = processAllGalaxies(db, galaxy_channel)
+	go galaxypkg.GalaxyChannel(pipeline_ctx, galaxies, galaxy_channel, error_channel)
 
+	err := processAllGalaxies(pipeline_ctx, stars, galaxy_channel, processor, concurrency)
 	if err != nil {
 		log.Printf(`Pipeline %v\n`, err)
 	}
 
-	// Check for errors on the error_channel
-	for err = range error_channel {
-		log.Printf(`Pipeline %v\n`, err)
+	// Stop the producer if processing ended early. error_channel is closed once it has returned.
+	cancel()
+	for producer_err := range error_channel {
+		// Errors caused by our own cancellation aren't worth reporting
+		if errors.Is(producer_err, context.Canceled) {
+			continue
+		}
+		log.Printf(`Pipeline %v\n`, producer_err)
+		if err == nil {
+			err = producer_err
+		}
 	}
+
+	if ctx.Err() != nil {
+		return fmt.Errorf("Pipeline cancelled: %w", ctx.Err())
+	}
+
+	return err
 }
 
-func processAllGalaxies(db *sql.DB, galaxy_channel chan galaxypkg.Galaxy) error {
-	// Use an errgroup to wait for all the goroutines to be done and collect any errors
+func processAllGalaxies(ctx context.Context, stars starpkg.StarStore, galaxy_channel chan galaxypkg.Galaxy, processor starpkg.StarProcessor, concurrency int) error {
+	// Use an errgroup to wait for all the goroutines to be done and collect any errors.
+	// The group context is cancelled when the first goroutine fails.
 	// https://bostonc.dev/blog/go-errgroup
-	g := new(errgroup.Group)
+	g, group_ctx := errgroup.WithContext(ctx)
+
+	// g.Go blocks once concurrency goroutines are running, so galaxies are only read
+	// from galaxy_channel as fast as they can be processed
+	g.SetLimit(concurrency)
 
-	for galaxy := range galaxy_channel {
-		g.Go(func() error {
-			return ProcessGalaxy(db, galaxy)
-		})
+loop:
+	for {
+		select {
+		case galaxy, ok := <-galaxy_channel:
+			if !ok {
+				break loop
+			}
+			g.Go(func() error {
+				return ProcessGalaxy(group_ctx, stars, galaxy, processor)
+			})
+		case <-group_ctx.Done():
+			break loop
+		}
 	}
 
 	err := g.Wait()
 	return err
 }
 
-// ProcessGalaxy takes a database connection and Galaxy, finds the associated stars,
-// and calls ProcessStar on each one.
+// ProcessGalaxy takes a context, a StarStore and Galaxy, finds the associated stars,
+// and calls processor on each one. It stops at the first error from processor.
 // GalaxyStarChannel is called as a goroutine so that the channel can be processed as
-// items are added to it.
-func ProcessGalaxy(db *sql.DB, galaxy galaxypkg.Galaxy) error {
+// items are added to it. Query and scan errors from GalaxyStarChannel are returned once
+// star_channel has been drained, and the number of stars processed before any error is logged.
+func ProcessGalaxy(ctx context.Context, stars starpkg.StarStore, galaxy galaxypkg.Galaxy, processor starpkg.StarProcessor) error {
 	log.Printf("Processing %s galaxy\n", galaxy.UgcNumber)
+
 	var num_stars int
+	// Identify the galaxy that has been processed, since log output can be interleaved.
+	// This is logged on failure too, to show how far the galaxy got.
+	defer func() {
+		log.Printf("%d stars processed for galaxy %s\n", num_stars, galaxy.Name)
+	}()
+
+	// Cancelling stops GalaxyStarChannel if we return before reading all the stars
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	star_channel := make(chan starpkg.Star)
-	error_channel := make(chan error)
+	// Buffered so that the producer can always deliver its result and exit,
+	// even if we've already returned
+	error_channel := make(chan error, 1)
 
 	go func() {
-		if err := starpkg.GalaxyStarChannel(db, galaxy, star_channel); err != nil {
-			error_channel <- err
-		}
+		error_channel <- starpkg.GalaxyStarChannel(ctx, stars, galaxy, star_channel)
 	}()
 
-	var err error
-	var ok bool
-	// Check error_channel for errors
-	select {
-	case err, ok = <-error_channel:
-		if ok {
-			log.Printf(`ProcessGalaxy %v\n`, err)
-			// Identify the galaxy that has been processed, since log output can be interleaved.
-			// Not sure we're supposed to log 0 stars processed in case of error?
-			log.Printf("%d stars processed for galaxy %s\n", num_stars, galaxy.Name)
+	for star := range star_channel {
+		if err := processor.Process(ctx, galaxy, star); err != nil {
+			err = fmt.Errorf("ProcessGalaxy %s: %w", galaxy.UgcNumber, err)
+			log.Printf("%v\n", err)
 			return err
 		}
-	default:
-		// process stars
-		for star := range star_channel {
-			num_stars++
-			// When ProcessStar does real work, would need to add more error handling here
-			ProcessStar(galaxy, star)
-		}
+		num_stars++
 	}
 
-	// Identify the galaxy that has been processed, since log output can be interleaved.
-	log.Printf("%d stars processed for galaxy %s\n", num_stars, galaxy.Name)
+	// GalaxyStarChannel closes star_channel just before returning, so its result is on the way
+	if err := <-error_channel; err != nil {
+		err = fmt.Errorf("ProcessGalaxy %s: %w", galaxy.UgcNumber, err)
+		log.Printf("%v\n", err)
+		return err
+	}
 
 	return nil
 }
 
-// Process a star, given a Galaxy and a Star.
-func ProcessStar(galaxy galaxypkg.Galaxy, star starpkg.Star) {
+// Process a star, given a Galaxy and a Star, by logging it.
+// This is the default StarProcessor used by main.
+func ProcessStar(ctx context.Context, galaxy galaxypkg.Galaxy, star starpkg.Star) error {
 	log.Printf("Star: %s, Galaxy: %s\n", star.Name, galaxy.Name)
+	return nil
 }
 
 // Initialize the logger to go to star-catalog.log and log timestamp
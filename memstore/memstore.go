@@ -0,0 +1,177 @@
+// Package memstore implements an in-memory Store that satisfies galaxy.GalaxyStore,
+// star.StarStore and star.ConeSearcher. It is intended for tests, and can simulate store
+// failures so that error handling can be tested without a database.
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"star-catalog/galaxy"
+	"star-catalog/star"
+)
+
+// Store keeps galaxies and stars in memory, in the order they were added.
+// Setting GalaxyErr or StarErr makes reads fail, after GalaxyErrAfter galaxies or
+// StarErrAfter stars have been delivered. 0 simulates a failed query, and more than 0
+// simulates a failure part way through reading the rows.
+type Store struct {
+	GalaxyErr      error
+	GalaxyErrAfter int
+	StarErr        error
+	StarErrAfter   int
+
+	mu       sync.Mutex
+	galaxies []galaxy.Galaxy
+	stars    []star.Star
+}
+
+// New returns an empty Store.
+func New() *Store {
+	return &Store{}
+}
+
+// NewTestStore returns a Store holding two galaxies for tests: the Milky Way, with the Sun and
+// Alpha Centauri, and Andromeda at ra 10.6847 and dec 41.2690, with Star3, which has an ra
+// but no dec.
+func NewTestStore() *Store {
+	store := New()
+	ra, dec := 10.6847, 41.2690
+	galaxy_id1 := store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number1", Name: "Milky Way"})
+	galaxy_id2 := store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number2", Name: "Andromeda", Ra: &ra, Dec: &dec})
+	store.AddStar(star.Star{GalaxyId: galaxy_id1, Name: "Sun", GaiaCatalogueId: "gaia_catalogue_id1"})
+	store.AddStar(star.Star{GalaxyId: galaxy_id1, Name: "Alpha Centauri", GaiaCatalogueId: "gaia_catalogue_id2"})
+	store.AddStar(star.Star{GalaxyId: galaxy_id2, Name: "Star3", GaiaCatalogueId: "gaia_catalogue_id3", Ra: &ra})
+	return store
+}
+
+// AddGalaxy adds a copy of the given Galaxy and returns the id given to it.
+// Unlike the database, it doesn't derive Redshift or Distance.
+func (store *Store) AddGalaxy(g galaxy.Galaxy) int64 {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	g.Id = int64(len(store.galaxies) + 1)
+	store.galaxies = append(store.galaxies, g)
+	return g.Id
+}
+
+// AddStar adds a copy of the given Star, which should have its GalaxyId set, and returns
+// the id given to it.
+func (store *Store) AddStar(s star.Star) int64 {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	s.Id = int64(len(store.stars) + 1)
+	store.stars = append(store.stars, s)
+	return s.Id
+}
+
+// EachGalaxy calls fn for each galaxy, failing with GalaxyErr if it is set.
+func (store *Store) EachGalaxy(ctx context.Context, fn func(galaxy.Galaxy) error) error {
+	// Copy so that fn can run without holding the lock
+	store.mu.Lock()
+	galaxies := append([]galaxy.Galaxy(nil), store.galaxies...)
+	store.mu.Unlock()
+
+	for i, galaxy := range galaxies {
+		if store.GalaxyErr != nil && i == store.GalaxyErrAfter {
+			return store.GalaxyErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(galaxy); err != nil {
+			return err
+		}
+	}
+
+	if store.GalaxyErr != nil && len(galaxies) <= store.GalaxyErrAfter {
+		return store.GalaxyErr
+	}
+
+	return nil
+}
+
+// FindGalaxy returns the galaxy with the given ugc_number. It fails with GalaxyErr if it
+// is set, and with the same error as the SQL store if there is no such galaxy.
+func (store *Store) FindGalaxy(ctx context.Context, ugc_number string) (galaxy.Galaxy, error) {
+	if store.GalaxyErr != nil {
+		return galaxy.Galaxy{}, fmt.Errorf("FindGalaxy: %w", store.GalaxyErr)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, galaxy := range store.galaxies {
+		if galaxy.UgcNumber == ugc_number {
+			return galaxy, nil
+		}
+	}
+
+	return galaxy.Galaxy{}, fmt.Errorf("FindGalaxy %w", sql.ErrNoRows)
+}
+
+// EachGalaxyStar calls fn for each star belonging to the given galaxy, failing with
+// StarErr if it is set.
+func (store *Store) EachGalaxyStar(ctx context.Context, galaxy galaxy.Galaxy, fn func(star.Star) error) error {
+	store.mu.Lock()
+	var stars []star.Star
+	for _, star := range store.stars {
+		if star.GalaxyId == galaxy.Id {
+			stars = append(stars, star)
+		}
+	}
+	store.mu.Unlock()
+
+	for i, star := range stars {
+		if store.StarErr != nil && i == store.StarErrAfter {
+			return store.StarErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(star); err != nil {
+			return err
+		}
+	}
+
+	if store.StarErr != nil && len(stars) <= store.StarErrAfter {
+		return store.StarErr
+	}
+
+	return nil
+}
+
+// EachStarInBox calls fn for each star with a position inside box, failing with StarErr
+// if it is set, like EachGalaxyStar.
+func (store *Store) EachStarInBox(ctx context.Context, box star.Box, fn func(star.Star) error) error {
+	store.mu.Lock()
+	var stars []star.Star
+	for _, star := range store.stars {
+		if star.Ra != nil && star.Dec != nil && box.Contains(*star.Ra, *star.Dec) {
+			stars = append(stars, star)
+		}
+	}
+	store.mu.Unlock()
+
+	for i, star := range stars {
+		if store.StarErr != nil && i == store.StarErrAfter {
+			return store.StarErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(star); err != nil {
+			return err
+		}
+	}
+
+	if store.StarErr != nil && len(stars) <= store.StarErrAfter {
+		return store.StarErr
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// Tests for the in-memory Store
+package memstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"star-catalog/galaxy"
+	"star-catalog/star"
+)
+
+// TestEachGalaxy adds galaxies and checks that EachGalaxy returns them in order
+func TestEachGalaxy(t *testing.T) {
+	store := New()
+	store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number1", Name: "Milky Way"})
+	store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number2", Name: "Andromeda"})
+
+	want := []galaxy.Galaxy{
+		{Name: "Milky Way", UgcNumber: "ugc_number1"},
+		{Name: "Andromeda", UgcNumber: "ugc_number2"},
+	}
+
+	var got []galaxy.Galaxy
+	err := store.EachGalaxy(context.Background(), func(g galaxy.Galaxy) error {
+		got = append(got, g)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf(`EachGalaxy %v`, err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf(`EachGalaxy should return %d galaxies, is %d`, len(want), len(got))
+	}
+	for i := range want {
+		if !galaxy.ValidateGalaxy(got[i], want[i]) {
+			t.Fatalf(`Galaxy should be %+v, is %+v`, want[i], got[i])
+		}
+	}
+}
+
+// TestFindGalaxyMissing checks that FindGalaxy fails the same way as the SQL store
+func TestFindGalaxyMissing(t *testing.T) {
+	store := New()
+
+	want := "FindGalaxy sql: no rows in result set"
+
+	_, err := store.FindGalaxy(context.Background(), "not_an_ugc_number")
+
+	if err == nil || err.Error() != want {
+		t.Fatalf("FindGalaxy expected error %v, got %v\n", want, err)
+	}
+}
+
+// TestFindGalaxyErr checks that FindGalaxy wraps GalaxyErr, so callers can tell it apart
+func TestFindGalaxyErr(t *testing.T) {
+	store := New()
+	store.GalaxyErr = errors.New("injected")
+
+	_, err := store.FindGalaxy(context.Background(), "ugc_number1")
+
+	if !errors.Is(err, store.GalaxyErr) || err.Error() != "FindGalaxy: injected" {
+		t.Fatalf(`FindGalaxy should wrap GalaxyErr, is %v`, err)
+	}
+}
+
+// TestEachGalaxyStar adds stars to two galaxies and checks that only the stars of the
+// requested galaxy are returned
+func TestEachGalaxyStar(t *testing.T) {
+	store := New()
+	galaxy_id1 := store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number1", Name: "Milky Way"})
+	galaxy_id2 := store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number2", Name: "Andromeda"})
+	store.AddStar(star.Star{GalaxyId: galaxy_id1, Name: "Sun", GaiaCatalogueId: "gaia_catalogue_id1"})
+	store.AddStar(star.Star{GalaxyId: galaxy_id2, Name: "Star3", GaiaCatalogueId: "gaia_catalogue_id3"})
+
+	want := star.Star{GalaxyId: galaxy_id2, Name: "Star3", GaiaCatalogueId: "gaia_catalogue_id3"}
+
+	var got []star.Star
+	err := store.EachGalaxyStar(context.Background(), galaxy.Galaxy{Id: galaxy_id2}, func(s star.Star) error {
+		got = append(got, s)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf(`EachGalaxyStar %v`, err)
+	}
+	if len(got) != 1 || !star.ValidateStar(got[0], want) {
+		t.Fatalf(`EachGalaxyStar should return %+v, is %+v`, want, got)
+	}
+}
+
+// TestEachGalaxyStarErrAfter checks that StarErr is returned after StarErrAfter stars
+func TestEachGalaxyStarErrAfter(t *testing.T) {
+	store := New()
+	galaxy_id := store.AddGalaxy(galaxy.Galaxy{UgcNumber: "ugc_number1", Name: "Milky Way"})
+	store.AddStar(star.Star{GalaxyId: galaxy_id, Name: "Sun", GaiaCatalogueId: "gaia_catalogue_id1"})
+	store.AddStar(star.Star{GalaxyId: galaxy_id, Name: "Alpha Centauri", GaiaCatalogueId: "gaia_catalogue_id2"})
+	store.StarErr = errors.New("scan failed")
+	store.StarErrAfter = 1
+
+	count := 0
+	err := store.EachGalaxyStar(context.Background(), galaxy.Galaxy{Id: galaxy_id}, func(s star.Star) error {
+		count++
+		return nil
+	})
+
+	if !errors.Is(err, store.StarErr) {
+		t.Fatalf(`EachGalaxyStar should return %v, is %v`, store.StarErr, err)
+	}
+	if count != 1 {
+		t.Fatalf(`EachGalaxyStar should deliver 1 star before failing, delivered %d`, count)
+	}
+}
+
+// TestConeSearch checks that a cone search across RA 0 finds the stars with positions in it
+func TestConeSearch(t *testing.T) {
+	store := New()
+	ra1, ra2, ra3, dec := 359.9, 0.2, 10.0, 0.0
+	store.AddStar(star.Star{Name: "west", Ra: &ra1, Dec: &dec})
+	store.AddStar(star.Star{Name: "east", Ra: &ra2, Dec: &dec})
+	store.AddStar(star.Star{Name: "far", Ra: &ra3, Dec: &dec})
+	store.AddStar(star.Star{Name: "no position"})
+
+	results, err := star.ConeSearch(context.Background(), store, 0, 0, 0.5)
+	if err != nil {
+		t.Fatalf(`ConeSearch %v`, err)
+	}
+	if len(results) != 2 || results[0].Name != "west" || results[1].Name != "east" {
+		t.Fatalf(`ConeSearch should find west and east, is %+v`, results)
+	}
+}
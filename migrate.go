@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"star-catalog/database"
+)
+
+// runMigrate runs migrate up, down or status against the database in config.yml,
+// writing what it did to out.
+func runMigrate(ctx context.Context, args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("migrate needs one of up, down or status\n%s", usage)
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx, db)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "Schema is up to date")
+		}
+		return err
+
+	case "down":
+		reverted, ok, err := database.MigrateDown(ctx, db)
+		if ok {
+			fmt.Fprintf(out, "Reverted %04d_%s\n", reverted.Version, reverted.Name)
+		} else if err == nil {
+			fmt.Fprintln(out, "No migrations to revert")
+		}
+		return err
+
+	case "status":
+		statuses, err := database.MigrateStatus(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(writer, "%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+		return writer.Flush()
+	}
+
+	return fmt.Errorf("unknown migrate command %q\n%s", args[0], usage)
+}
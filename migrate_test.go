@@ -0,0 +1,51 @@
+// Tests for the migrate command and runCommand
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"star-catalog/database"
+)
+
+// TestMigrateStatus runs migrate up and then migrate status, and checks that
+// every migration is listed as applied
+func TestMigrateStatus(t *testing.T) {
+	var out bytes.Buffer
+	ctx := context.Background()
+
+	if err := runMigrate(ctx, []string{"up"}, &out); err != nil {
+		t.Fatalf(`migrate up %v`, err)
+	}
+
+	out.Reset()
+	if err := runMigrate(ctx, []string{"status"}, &out); err != nil {
+		t.Fatalf(`migrate status %v`, err)
+	}
+
+	migrations, err := database.Migrations(database.SQLite)
+	if err != nil {
+		t.Fatalf(`Migrations %v`, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(migrations) {
+		t.Fatalf(`migrate status should list %d migrations, is %q`, len(migrations), out.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "applied") {
+			t.Fatalf(`Migration should be applied, is %s`, line)
+		}
+	}
+}
+
+// TestRunCommandUnknown checks that an unknown command is reported along with the usage
+func TestRunCommandUnknown(t *testing.T) {
+	err := runCommand(context.Background(), []string{"explode"})
+
+	if err == nil || !strings.Contains(err.Error(), `unknown command "explode"`) || !strings.Contains(err.Error(), "usage:") {
+		t.Fatalf(`runCommand should report the unknown command and usage, is %v`, err)
+	}
+}
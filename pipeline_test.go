@@ -3,15 +3,22 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"star-catalog/database"
 	"star-catalog/galaxy"
 	galaxypkg "star-catalog/galaxy"
+	"star-catalog/memstore"
 	starpkg "star-catalog/star"
+	"star-catalog/stats"
 	"strings"
 	"testing"
 
@@ -19,6 +26,7 @@ import (
 	// galaxypkg "galaxy"
 	// starpkg "star"
 
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -30,6 +38,7 @@ func TestPipelineOutput(t *testing.T) {
 
 	// Log output is listed in order and then sorted because messages can arrive interleaved
 	want := []string{
+		"Pipeline starting with concurrency limit 2",
 		"Processing ugc_number1 galaxy",
 		"Star: Sun, Galaxy: Milky Way",
 		"Star: Alpha Centauri, Galaxy: Milky Way",
@@ -45,10 +54,10 @@ func TestPipelineOutput(t *testing.T) {
 	var got []string
 
 	db := database.InitDB()
-	go Pipeline(db)
+	go Pipeline(context.Background(), galaxypkg.NewSQLStore(db), starpkg.NewSQLStore(db), starpkg.StarProcessorFunc(ProcessStar), 2)
 
 	// Log lines can be interleaved. Collect the lines, and sort to compare with expected array.
-	for i := 0; i < 9; i++ {
+	for i := 0; i < 10; i++ {
 		scanner.Scan()         // blocks until a new line is written to the pipe
 		line := scanner.Text() // the last line written to the scanner
 		got = append(got, line)
@@ -56,7 +65,7 @@ func TestPipelineOutput(t *testing.T) {
 
 	sort.Strings(got)
 
-	for i := 0; i < 9; i++ {
+	for i := 0; i < 10; i++ {
 		if !strings.Contains(got[i], want[i]) {
 			t.Fatalf(`Pipeline log should match %s, is %s`, want[i], got)
 		}
@@ -76,12 +85,12 @@ func TestProcessGalaxyOutput(t *testing.T) {
 
 	db := database.InitDB()
 
-	mbox, err := galaxy.FindGalaxy(db, "ugc_number1")
+	mbox, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number1")
 	if err != nil {
 		t.Fatalf(`ProcessGalaxy %v\n`, err)
 	}
 
-	err = ProcessGalaxy(db, mbox)
+	err = ProcessGalaxy(context.Background(), starpkg.NewSQLStore(db), mbox, starpkg.StarProcessorFunc(ProcessStar))
 
 	if err != nil {
 		t.Fatalf(`ProcessGalaxy %v\n`, err)
@@ -98,6 +107,280 @@ func TestProcessGalaxyOutput(t *testing.T) {
 	}
 }
 
+// TestProcessGalaxyQueryError calls ProcessGalaxy with a database connection that has been
+// closed, so the stars query fails. The error must be returned rather than missed, and
+// 0 stars reported as processed.
+func TestProcessGalaxyQueryError(t *testing.T) {
+	scanner, reader, writer := mockLogger(t) // turn this off when debugging or developing as you will miss output!
+	defer resetLogger(reader, writer)
+
+	db := database.InitDB()
+
+	mbox, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number1")
+	if err != nil {
+		t.Fatalf(`ProcessGalaxy %v\n`, err)
+	}
+
+	db.Close()
+
+	err = ProcessGalaxy(context.Background(), starpkg.NewSQLStore(db), mbox, starpkg.StarProcessorFunc(ProcessStar))
+
+	if err == nil || !strings.Contains(err.Error(), "database is closed") {
+		t.Fatalf(`ProcessGalaxy should return the query error, is %v`, err)
+	}
+
+	want := []string{
+		"Processing ugc_number1 galaxy",
+		"ProcessGalaxy ugc_number1: sql: database is closed",
+		"0 stars processed for galaxy Milky Way",
+	}
+
+	for i := 0; i < 3; i++ {
+		scanner.Scan()
+		got := scanner.Text()
+
+		if !strings.Contains(got, want[i]) {
+			t.Fatalf(`ProcessGalaxy log should match %s, is %s`, want[i], got)
+		}
+	}
+}
+
+// TestProcessGalaxyPartialCount calls ProcessGalaxy with a processor that fails on the second
+// star, and checks that the one star processed before the failure is reported
+func TestProcessGalaxyPartialCount(t *testing.T) {
+	scanner, reader, writer := mockLogger(t) // turn this off when debugging or developing as you will miss output!
+	defer resetLogger(reader, writer)
+
+	db := database.InitDB()
+
+	mbox, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number1")
+	if err != nil {
+		t.Fatalf(`ProcessGalaxy %v\n`, err)
+	}
+
+	calls := 0
+	processor := starpkg.StarProcessorFunc(func(ctx context.Context, galaxy galaxypkg.Galaxy, star starpkg.Star) error {
+		calls++
+		if calls == 2 {
+			return errors.New("star rejected")
+		}
+		return nil
+	})
+
+	err = ProcessGalaxy(context.Background(), starpkg.NewSQLStore(db), mbox, processor)
+
+	if err == nil || !strings.Contains(err.Error(), "star rejected") {
+		t.Fatalf(`ProcessGalaxy should return the processor error, is %v`, err)
+	}
+
+	want := []string{
+		"Processing ugc_number1 galaxy",
+		"ProcessGalaxy ugc_number1: star rejected",
+		"1 stars processed for galaxy Milky Way",
+	}
+
+	for i := 0; i < 3; i++ {
+		scanner.Scan()
+		got := scanner.Text()
+
+		if !strings.Contains(got, want[i]) {
+			t.Fatalf(`ProcessGalaxy log should match %s, is %s`, want[i], got)
+		}
+	}
+}
+
+// TestPipelineGalaxyQueryError calls Pipeline with a store whose galaxy query fails, and
+// checks that the error is returned
+func TestPipelineGalaxyQueryError(t *testing.T) {
+	store := memstore.New()
+	store.AddGalaxy(galaxypkg.Galaxy{UgcNumber: "ugc_number1", Name: "Milky Way"})
+	store.GalaxyErr = errors.New("galaxies query failed")
+
+	err := Pipeline(context.Background(), store, store, starpkg.StarProcessorFunc(ProcessStar), 0)
+
+	if !errors.Is(err, store.GalaxyErr) {
+		t.Fatalf(`Pipeline should return %v, is %v`, store.GalaxyErr, err)
+	}
+}
+
+// TestProcessGalaxyScanError calls ProcessGalaxy with a store that fails after reading one
+// star, and checks that the error is returned and the one star is reported as processed
+func TestProcessGalaxyScanError(t *testing.T) {
+	scanner, reader, writer := mockLogger(t) // turn this off when debugging or developing as you will miss output!
+	defer resetLogger(reader, writer)
+
+	store := memstore.New()
+	galaxy_id := store.AddGalaxy(galaxypkg.Galaxy{UgcNumber: "ugc_number1", Name: "Milky Way"})
+	store.AddStar(starpkg.Star{GalaxyId: galaxy_id, Name: "Sun", GaiaCatalogueId: "gaia_catalogue_id1"})
+	store.AddStar(starpkg.Star{GalaxyId: galaxy_id, Name: "Alpha Centauri", GaiaCatalogueId: "gaia_catalogue_id2"})
+	store.StarErr = errors.New("scan failed")
+	store.StarErrAfter = 1
+
+	mbox, err := store.FindGalaxy(context.Background(), "ugc_number1")
+	if err != nil {
+		t.Fatalf(`ProcessGalaxy %v\n`, err)
+	}
+
+	err = ProcessGalaxy(context.Background(), store, mbox, starpkg.StarProcessorFunc(ProcessStar))
+
+	if !errors.Is(err, store.StarErr) {
+		t.Fatalf(`ProcessGalaxy should return %v, is %v`, store.StarErr, err)
+	}
+
+	want := []string{
+		"Processing ugc_number1 galaxy",
+		"Star: Sun, Galaxy: Milky Way",
+		"ProcessGalaxy ugc_number1: scan failed",
+		"1 stars processed for galaxy Milky Way",
+	}
+
+	for i := 0; i < 4; i++ {
+		scanner.Scan()
+		got := scanner.Text()
+
+		if !strings.Contains(got, want[i]) {
+			t.Fatalf(`ProcessGalaxy log should match %s, is %s`, want[i], got)
+		}
+	}
+}
+
+// TestPipelineCancelled calls Pipeline with a cancelled context and checks that it
+// returns a cancellation error rather than processing the galaxies
+func TestPipelineCancelled(t *testing.T) {
+	db := database.InitDB()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := Pipeline(ctx, galaxypkg.NewSQLStore(db), starpkg.NewSQLStore(db), starpkg.StarProcessorFunc(ProcessStar), 0)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf(`Pipeline should return context.Canceled, is %v`, err)
+	}
+}
+
+// TestPipelineProcessorError calls Pipeline with a processor that fails and checks that
+// the processor's error is returned
+func TestPipelineProcessorError(t *testing.T) {
+	db := database.InitDB()
+
+	want := errors.New("star rejected")
+	processor := starpkg.StarProcessorFunc(func(ctx context.Context, galaxy galaxypkg.Galaxy, star starpkg.Star) error {
+		return want
+	})
+
+	err := Pipeline(context.Background(), galaxypkg.NewSQLStore(db), starpkg.NewSQLStore(db), processor, 0)
+
+	if !errors.Is(err, want) {
+		t.Fatalf(`Pipeline should return %v, is %v`, want, err)
+	}
+}
+
+// TestPipelineConcurrencyLimit calls Pipeline with a concurrency limit of 1 and checks that
+// each galaxy is finished before the next one starts
+func TestPipelineConcurrencyLimit(t *testing.T) {
+	scanner, reader, writer := mockLogger(t) // turn this off when debugging or developing as you will miss output!
+	defer resetLogger(reader, writer)
+
+	db := database.InitDB()
+	go Pipeline(context.Background(), galaxypkg.NewSQLStore(db), starpkg.NewSQLStore(db), starpkg.StarProcessorFunc(ProcessStar), 1)
+
+	scanner.Scan()
+	if got := scanner.Text(); !strings.Contains(got, "Pipeline starting with concurrency limit 1") {
+		t.Fatalf(`Pipeline should log its concurrency limit, is %s`, got)
+	}
+
+	// With a limit of 1, a galaxy's lines are never interleaved with another galaxy's
+	in_progress := false
+	for i := 0; i < 9; i++ {
+		scanner.Scan()
+		got := scanner.Text()
+
+		switch {
+		case strings.Contains(got, "Processing"):
+			if in_progress {
+				t.Fatalf(`Galaxy started before the previous one finished: %s`, got)
+			}
+			in_progress = true
+		case strings.Contains(got, "stars processed"):
+			in_progress = false
+		}
+	}
+}
+
+// TestRunPipelineDerived runs the pipeline with derived.save set, and checks that every
+// star's derived values are saved, with distances for Alpha Centauri and for Star3, whose
+// parallax passes the low derived.min_parallax_snr, but not for Star4's negative parallax
+func TestRunPipelineDerived(t *testing.T) {
+	db := database.InitDB()
+
+	viper.Set("derived.save", true)
+	viper.Set("derived.min_parallax_snr", 0.001)
+	viper.Set("stats.report", "")
+	defer viper.Set("derived.save", nil)
+	defer viper.Set("derived.min_parallax_snr", nil)
+	defer viper.Set("stats.report", nil)
+
+	if err := runPipeline(context.Background()); err != nil {
+		t.Fatalf(`runPipeline %v`, err)
+	}
+
+	var rows, distances int
+	err := db.QueryRow("SELECT COUNT(*), COUNT(distance) FROM star_derived").Scan(&rows, &distances)
+	if err != nil || rows != 5 || distances != 2 {
+		t.Fatalf(`star_derived should have 5 rows, 2 with distances, has %d and %d, %v`, rows, distances, err)
+	}
+}
+
+// TestRunPipelineStats runs the pipeline and checks that each galaxy's stats are saved and
+// written to a JSON report
+func TestRunPipelineStats(t *testing.T) {
+	db := database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	viper.Set("stats.report", path)
+	defer viper.Set("stats.report", nil)
+
+	if err := runPipeline(context.Background()); err != nil {
+		t.Fatalf(`runPipeline %v`, err)
+	}
+
+	var andromeda_stars int
+	var mean_parallax float64
+	err := db.QueryRow(`SELECT star_count, mean_parallax FROM galaxy_stats JOIN galaxies ON galaxies.id = galaxy_stats.galaxy_id
+		WHERE galaxies.ugc_number = 'ugc_number2'`).Scan(&andromeda_stars, &mean_parallax)
+	if err != nil || andromeda_stars != 3 || math.Abs(mean_parallax-(0.0013-0.21)/2) > 1e-9 {
+		t.Fatalf(`Andromeda's stats should have 3 stars with a mean parallax of -0.10435, have %v %v, %v`, andromeda_stars, mean_parallax, err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf(`The report should be written, %v`, err)
+	}
+	var report stats.Report
+	if err := json.Unmarshal(data, &report); err != nil || report.Galaxies != 2 || report.Stars != 5 {
+		t.Fatalf(`The report should have 2 galaxies with 5 stars, is %+v, %v`, report, err)
+	}
+}
+
+// TestRunPipelineBadReport sets a report file of an unknown format, and checks that the run
+// fails before any stats are saved
+func TestRunPipelineBadReport(t *testing.T) {
+	db := database.InitDB()
+
+	viper.Set("stats.report", filepath.Join(t.TempDir(), "report.txt"))
+	defer viper.Set("stats.report", nil)
+
+	if err := runPipeline(context.Background()); err == nil || !strings.Contains(err.Error(), "report.txt") {
+		t.Fatalf(`runPipeline should fail for a .txt report, is %v`, err)
+	}
+
+	var rows int
+	if err := db.QueryRow("SELECT COUNT(*) FROM galaxy_stats").Scan(&rows); err != nil || rows != 0 {
+		t.Fatalf(`No stats should be saved, has %d rows, %v`, rows, err)
+	}
+}
+
 // TestProcessStarOutput calls ProcessStar and checks the log output with logging redirected to a pipe
 // This confirms that the logs have the required format including time, name, and galaxy token
 func TestProcessStarOutput(t *testing.T) {
@@ -112,7 +395,7 @@ func TestProcessStarOutput(t *testing.T) {
 	mbox := galaxypkg.Galaxy{UgcNumber: "ugc_number1", Name: "Milky Way"}
 	usr := starpkg.Star{Name: "Sun", GaiaCatalogueId: "gaia_catalogue_id1"}
 
-	ProcessStar(mbox, usr)
+	ProcessStar(context.Background(), mbox, usr)
 
 	scanner.Scan()        // blocks until a new line is written to the pipe
 	got := scanner.Text() // the last line written to the scanner
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"star-catalog/database"
+)
+
+// runSeed loads the fixture files named in args into the database in config.yml,
+// writing what it did to out. Existing data is only removed if -clear is given. Nothing is
+// changed unless every file is loaded.
+func runSeed(ctx context.Context, args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	flags.SetOutput(out)
+	clear_db := flags.Bool("clear", false, "remove all galaxies and stars before seeding")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("seed needs at least one fixture file\n%s", usage)
+	}
+
+	// Read every file before touching the database, so a bad file doesn't leave it half seeded
+	var all_fixtures []database.Fixtures
+	for _, path := range flags.Args() {
+		fixtures, err := database.LoadFixtures(path)
+		if err != nil {
+			return err
+		}
+		all_fixtures = append(all_fixtures, fixtures)
+	}
+
+	db := database.ConnectDB()
+	defer db.Close()
+
+	// Clear and seed in one transaction, so a database error doesn't leave it half seeded
+	// either, and report what was done once it is committed
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("seed: %v", err)
+	}
+	defer tx.Rollback()
+
+	var report strings.Builder
+	if *clear_db {
+		if err := database.ClearDBTx(ctx, tx); err != nil {
+			return err
+		}
+		fmt.Fprintln(&report, "Removed all galaxies and stars")
+	}
+
+	for i, fixtures := range all_fixtures {
+		num_galaxies, num_stars, err := database.SeedFixturesTx(ctx, db, tx, fixtures)
+		if err != nil {
+			return fmt.Errorf("%s: %w", flags.Arg(i), err)
+		}
+		fmt.Fprintf(&report, "Added %d galaxies and %d stars from %s\n", num_galaxies, num_stars, flags.Arg(i))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("seed: %v", err)
+	}
+	_, err = io.WriteString(out, report.String())
+	return err
+}
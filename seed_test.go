@@ -0,0 +1,104 @@
+// Tests for the seed command
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"star-catalog/database"
+
+	"github.com/spf13/viper"
+)
+
+// TestSeedClear seeds the database from a CSV file with -clear, and checks that only
+// the fixture data is left
+func TestSeedClear(t *testing.T) {
+	db := database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "fixtures.csv")
+	csv := "ugc_number,galaxy_name,star_name,gaia_catalogue_id\n" +
+		"UGC 12158,NGC 7479,Star A,gaia_a\n" +
+		"UGC 12158,NGC 7479,Star B,gaia_b\n"
+	if err := os.WriteFile(path, []byte(csv), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runSeed(context.Background(), []string{"-clear", path}, &out); err != nil {
+		t.Fatalf(`seed %v`, err)
+	}
+
+	if want := "Added 1 galaxies and 2 stars from " + path; !strings.Contains(out.String(), want) {
+		t.Fatalf(`seed output should contain %s, is %s`, want, out.String())
+	}
+
+	var got int
+	err := db.QueryRow("SELECT COUNT(*) FROM stars").Scan(&got)
+	if got != 2 || err != nil {
+		t.Fatalf(`Star rows should be %d, is %d, %v`, 2, got, err)
+	}
+}
+
+// TestSeedKeepsData seeds the database without -clear and checks that the existing
+// data is kept
+func TestSeedKeepsData(t *testing.T) {
+	db := database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	json := `{"galaxies": [{"ugc_number": "ugc_number1", "name": "Milky Way", "stars": [{"name": "Vega", "gaia_catalogue_id": "gaia_vega"}]}]}`
+	if err := os.WriteFile(path, []byte(json), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runSeed(context.Background(), []string{path}, &out); err != nil {
+		t.Fatalf(`seed %v`, err)
+	}
+
+	// The Milky Way already exists, so only the star is added
+	if want := "Added 0 galaxies and 1 stars"; !strings.Contains(out.String(), want) {
+		t.Fatalf(`seed output should contain %s, is %s`, want, out.String())
+	}
+
+	var got int
+	err := db.QueryRow("SELECT COUNT(*) FROM stars").Scan(&got)
+	if got != 6 || err != nil {
+		t.Fatalf(`Star rows should be %d, is %d, %v`, 6, got, err)
+	}
+}
+
+// TestSeedAtomic seeds with -clear from a file whose second star can't be added, and checks
+// that the database is left as it was
+func TestSeedAtomic(t *testing.T) {
+	db := database.InitDB()
+
+	path := filepath.Join(t.TempDir(), "fixtures.csv")
+	csv := "ugc_number,galaxy_name,star_name,gaia_catalogue_id,ra,dec\n" +
+		"UGC 12158,NGC 7479,Star A,gaia_a,,\n" +
+		"UGC 12158,NGC 7479,Star B,gaia_b,346.24,12.32\n"
+	if err := os.WriteFile(path, []byte(csv), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stars with a position can't be given a HEALPix pixel at this order
+	viper.Set("healpix.order", 30)
+	defer viper.Set("healpix.order", nil)
+
+	var out bytes.Buffer
+	if err := runSeed(context.Background(), []string{"-clear", path}, &out); err == nil {
+		t.Fatalf(`seed should fail`)
+	}
+	if out.Len() != 0 {
+		t.Fatalf(`seed shouldn't report anything done, is %s`, out.String())
+	}
+
+	var galaxies, stars int
+	err := db.QueryRow("SELECT (SELECT COUNT(*) FROM galaxies), (SELECT COUNT(*) FROM stars)").Scan(&galaxies, &stars)
+	if galaxies != 2 || stars != 5 || err != nil {
+		t.Fatalf(`The fixtures' 2 galaxies and 5 stars should be left, are %d and %d, %v`, galaxies, stars, err)
+	}
+}
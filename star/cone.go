@@ -0,0 +1,183 @@
+package star
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"star-catalog/astro"
+	"star-catalog/database"
+	"star-catalog/healpix"
+)
+
+// A Box is a range of declination and right ascension, in degrees, that a cone search
+// fetches from a store before checking each star's exact distance.
+// MinRa is greater than MaxRa when the box wraps around RA 0, so that it holds RAs from MinRa
+// up to 360 and from 0 up to MaxRa.
+type Box struct {
+	MinRa, MaxRa   float64
+	MinDec, MaxDec float64
+}
+
+// A ConeSearcher is a store that can find the stars inside a Box.
+// SQLStore uses the stars_dec_ra or stars_healpix index, and package memstore checks every star.
+type ConeSearcher interface {
+	// EachStarInBox calls fn for every star with an ra and dec inside box, stopping at the
+	// first error from fn or the store.
+	EachStarInBox(ctx context.Context, box Box, fn func(Star) error) error
+}
+
+// A ConeResult is a star found by ConeSearch, with its distance from the centre in degrees.
+type ConeResult struct {
+	Star
+	Distance float64
+}
+
+// ConeSearch returns the stars within radius degrees of ra and dec, which are in degrees too,
+// nearest first. Stars without a position are never found.
+// It fetches the stars in the cone's bounding box from store, and then keeps those whose
+// angular distance, by the haversine formula, is within radius.
+func ConeSearch(ctx context.Context, store ConeSearcher, ra float64, dec float64, radius float64) ([]ConeResult, error) {
+	if !(dec >= -90 && dec <= 90) || math.IsNaN(ra) || math.IsInf(ra, 0) {
+		return nil, fmt.Errorf("ConeSearch: %v, %v is not a position", ra, dec)
+	}
+	if !(radius >= 0) {
+		return nil, fmt.Errorf("ConeSearch: radius %v is negative", radius)
+	}
+	ra = normalizeRa(ra)
+
+	var results []ConeResult
+	err := store.EachStarInBox(ctx, BoundingBox(ra, dec, radius), func(star Star) error {
+		distance := astro.AngularDistance(ra, dec, *star.Ra, *star.Dec)
+		if distance <= radius {
+			results = append(results, ConeResult{Star: star, Distance: distance})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ConeSearch: %w", err)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+	return results, nil
+}
+
+// BoundingBox returns the smallest Box holding the cone of radius degrees around ra and dec.
+// The RA half-width is asin(sin(radius) / cos(dec)), where the cone's edge is furthest
+// from ra, which grows towards the poles; if the cone holds a pole, the box has every RA.
+// ra is taken into the range 0 up to 360 first, so that the box only wraps when the cone
+// crosses RA 0.
+func BoundingBox(ra float64, dec float64, radius float64) Box {
+	ra = normalizeRa(ra)
+	box := Box{MinDec: math.Max(dec-radius, -90), MaxDec: math.Min(dec+radius, 90), MinRa: 0, MaxRa: 360}
+
+	if box.MinDec == -90 || box.MaxDec == 90 {
+		return box
+	}
+
+	sin_width := math.Sin(radius*math.Pi/180) / math.Cos(dec*math.Pi/180)
+	if radius >= 90 || sin_width >= 1 {
+		return box
+	}
+	width := math.Asin(sin_width) * 180 / math.Pi
+
+	box.MinRa, box.MaxRa = ra-width, ra+width
+	if box.MinRa < 0 {
+		box.MinRa += 360
+	}
+	if box.MaxRa >= 360 {
+		box.MaxRa -= 360
+	}
+	return box
+}
+
+// Return ra in the range 0 up to 360
+func normalizeRa(ra float64) float64 {
+	ra = math.Mod(ra, 360)
+	if ra < 0 {
+		ra += 360
+	}
+	return ra
+}
+
+// Contains reports whether a position is inside the box.
+func (box Box) Contains(ra float64, dec float64) bool {
+	if dec < box.MinDec || dec > box.MaxDec {
+		return false
+	}
+	if box.MinRa > box.MaxRa {
+		return ra >= box.MinRa || ra <= box.MaxRa
+	}
+	return ra >= box.MinRa && ra <= box.MaxRa
+}
+
+// EachStarInBox calls fn for each row of the stars table whose ra and dec are inside box.
+// The dec and ra ranges are written so that they can use the stars_dec_ra index. If
+// store.HealpixOrder is set, the query also asks for the healpix ranges covering the box,
+// which the database can answer from the stars_healpix index instead.
+func (store *SQLStore) EachStarInBox(ctx context.Context, box Box, fn func(Star) error) error {
+	ra := store.db.Dialect.QuoteIdentifier("ra")
+	dec := store.db.Dialect.QuoteIdentifier("dec")
+
+	query := "SELECT " + store.db.ColumnList(Star{}) + " FROM stars WHERE " + dec + " BETWEEN ? AND ? AND "
+	if box.MinRa > box.MaxRa {
+		query += "(" + ra + " >= ? OR " + ra + " <= ?)"
+	} else {
+		query += ra + " BETWEEN ? AND ?"
+	}
+	args := []any{box.MinDec, box.MaxDec, box.MinRa, box.MaxRa}
+
+	if store.HealpixOrder > 0 {
+		var conditions []string
+		for _, r := range healpixRanges(box, store.HealpixOrder) {
+			conditions = append(conditions, "healpix BETWEEN ? AND ?")
+			args = append(args, r.First, r.Last)
+		}
+		// No pixels cover the box, so nor do any stars
+		if len(conditions) == 0 {
+			return nil
+		}
+		query += " AND (" + strings.Join(conditions, " OR ") + ")"
+	}
+
+	rows, err := store.db.QueryContext(ctx, store.db.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var star Star
+		if err := database.ScanStruct(rows, &star); err != nil {
+			return err
+		}
+		if err := fn(star); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Return the ranges of pixels at order covering box. They are found at a lower order, so that
+// there are only a few dozen of them, and then scaled up to order.
+func healpixRanges(box Box, order int) []healpix.Range {
+	// The box's size is its longest side, which for RA is along the dec nearest the equator
+	ra_width := box.MaxRa - box.MinRa
+	if box.MinRa > box.MaxRa {
+		ra_width += 360
+	}
+	nearest_dec := math.Max(box.MinDec, math.Min(box.MaxDec, 0))
+	size := math.Max(box.MaxDec-box.MinDec, ra_width*math.Cos(nearest_dec*math.Pi/180))
+
+	search_order := healpix.SearchOrder(size, order)
+	ranges := healpix.BoxRanges(search_order, box.MinRa, box.MaxRa, box.MinDec, box.MaxDec)
+	for i := range ranges {
+		ranges[i] = ranges[i].AtOrder(search_order, order)
+	}
+	return ranges
+}
@@ -0,0 +1,221 @@
+// Tests for ConeSearch, BoundingBox, SQLStore.EachStarInBox and healpixRanges
+package star
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"star-catalog/astro"
+	"star-catalog/database"
+	"star-catalog/galaxy"
+	"star-catalog/healpix"
+)
+
+// A coneStar is a row of the stars table with a position, for adding test stars
+type coneStar struct {
+	GalaxyId        int64   `db:"galaxy_id"`
+	Name            string  `db:"name"`
+	GaiaCatalogueId string  `db:"gaia_catalogue_id"`
+	Ra              float64 `db:"ra"`
+	Dec             float64 `db:"dec"`
+}
+
+// sliceStore is a ConeSearcher over a slice of stars
+type sliceStore []Star
+
+func (store sliceStore) EachStarInBox(ctx context.Context, box Box, fn func(Star) error) error {
+	for _, star := range store {
+		if star.Ra != nil && star.Dec != nil && box.Contains(*star.Ra, *star.Dec) {
+			if err := fn(star); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Return a star at ra, dec
+func starAt(name string, ra float64, dec float64) Star {
+	return Star{Name: name, Ra: &ra, Dec: &dec}
+}
+
+// Return the names of the stars found by a cone search
+func names(results []ConeResult) []string {
+	var names []string
+	for _, result := range results {
+		names = append(names, result.Name)
+	}
+	return names
+}
+
+// TestConeSearch checks cones across RA 0, around the poles, and with stars just inside
+// and outside the radius, and that results are nearest first
+func TestConeSearch(t *testing.T) {
+	store := sliceStore{
+		starAt("east of 0", 0.4, 10),
+		starAt("west of 0", 359.5, 10),
+		starAt("far", 180, 10),
+		starAt("pole 0", 0, 89.5),
+		starAt("pole 180", 180, 89.5),
+		starAt("south pole", 90, -89.9),
+		// At dec 60 a degree of RA is half a degree on the sky
+		starAt("inside", 101.9, 60),
+		starAt("outside", 102.1, 60),
+		{Name: "no position"},
+	}
+
+	tests := []struct {
+		ra, dec, radius float64
+		want            []string
+	}{
+		{0, 10, 1, []string{"east of 0", "west of 0"}},
+		{359.9, 10, 0.6, []string{"west of 0", "east of 0"}},
+		{-0.1, 10, 0.6, []string{"west of 0", "east of 0"}},
+		{90, 90, 1, []string{"pole 0", "pole 180"}},
+		{0, 89.5, 1.5, []string{"pole 0", "pole 180"}},
+		{270, -90, 0.2, []string{"south pole"}},
+		{100, 60, 1, []string{"inside"}},
+	}
+
+	for _, test := range tests {
+		results, err := ConeSearch(context.Background(), store, test.ra, test.dec, test.radius)
+		if err != nil {
+			t.Fatalf(`ConeSearch %v`, err)
+		}
+		got := names(results)
+		if len(got) != len(test.want) {
+			t.Fatalf(`ConeSearch %v, %v, %v should find %v, is %v`, test.ra, test.dec, test.radius, test.want, got)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Fatalf(`ConeSearch %v, %v, %v should find %v, is %v`, test.ra, test.dec, test.radius, test.want, got)
+			}
+		}
+	}
+
+	for _, bad := range [][3]float64{{0, 91, 1}, {0, 0, -1}, {math.NaN(), 0, 1}, {0, math.NaN(), 1}, {math.Inf(1), 0, 1}, {math.Inf(-1), 0, 1}} {
+		if _, err := ConeSearch(context.Background(), store, bad[0], bad[1], bad[2]); err == nil {
+			t.Fatalf(`ConeSearch %v should fail`, bad)
+		}
+	}
+}
+
+// TestBoundingBox checks that random cones lie within their boxes, by checking points on
+// each cone's edge
+func TestBoundingBox(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		ra, dec, radius := random.Float64()*360, random.Float64()*180-90, random.Float64()*10
+		box := BoundingBox(ra, dec, radius)
+
+		for bearing := 0.0; bearing < 360; bearing += 5 {
+			edge_ra, edge_dec := offset(ra, dec, radius*0.999999, bearing)
+			if !box.Contains(edge_ra, edge_dec) {
+				t.Fatalf(`BoundingBox %v, %v, %v is %+v, and should contain %v, %v`, ra, dec, radius, box, edge_ra, edge_dec)
+			}
+		}
+	}
+
+	if box, want := BoundingBox(370, 10, 1), BoundingBox(10, 10, 1); box != want || box.MinRa > box.MaxRa {
+		t.Fatalf(`BoundingBox at RA 370 should be the box at RA 10, %+v, is %+v`, want, box)
+	}
+}
+
+// TestHealpixRanges checks that the pixel ranges of random cones' boxes hold the positions
+// in the boxes, and that there are only a few dozen of them
+func TestHealpixRanges(t *testing.T) {
+	random := rand.New(rand.NewSource(3))
+
+	for i := 0; i < 200; i++ {
+		box := BoundingBox(random.Float64()*360, random.Float64()*180-90, random.Float64()*5)
+		ranges := healpixRanges(box, 12)
+		if len(ranges) == 0 || len(ranges) > 100 {
+			t.Fatalf(`healpixRanges %+v should be a few dozen ranges, is %d`, box, len(ranges))
+		}
+
+		width := box.MaxRa - box.MinRa
+		if box.MinRa > box.MaxRa {
+			width += 360
+		}
+		for j := 0; j < 100; j++ {
+			ra := math.Mod(box.MinRa+random.Float64()*width, 360)
+			dec := box.MinDec + random.Float64()*(box.MaxDec-box.MinDec)
+			pixel := healpix.Pixel(12, ra, dec)
+			found := false
+			for _, r := range ranges {
+				found = found || (pixel >= r.First && pixel <= r.Last)
+			}
+			if !found {
+				t.Fatalf(`healpixRanges %+v should hold %v, %v in pixel %d`, box, ra, dec, pixel)
+			}
+		}
+	}
+}
+
+// Return the position distance degrees from ra, dec in the direction bearing, measured
+// east of north
+func offset(ra float64, dec float64, distance float64, bearing float64) (float64, float64) {
+	to_radians := math.Pi / 180
+	dec1, d, b := dec*to_radians, distance*to_radians, bearing*to_radians
+
+	dec2 := math.Asin(math.Sin(dec1)*math.Cos(d) + math.Cos(dec1)*math.Sin(d)*math.Cos(b))
+	ra2 := ra*to_radians + math.Atan2(math.Sin(b)*math.Sin(d)*math.Cos(dec1), math.Cos(d)-math.Sin(dec1)*math.Sin(dec2))
+
+	ra2 = math.Mod(ra2/to_radians+360, 360)
+	return ra2, dec2 / to_radians
+}
+
+// TestSQLConeSearch adds stars around RA 0 to the database and checks that the SQL
+// bounding box finds the same stars as Box.Contains does in Go, with and without the
+// healpix column
+func TestSQLConeSearch(t *testing.T) {
+	db := database.InitDB()
+	ctx := context.Background()
+
+	milky_way, err := galaxy.NewSQLStore(db).FindGalaxy(ctx, "ugc_number1")
+	if err != nil {
+		t.Fatalf(`FindGalaxy %v`, err)
+	}
+
+	random := rand.New(rand.NewSource(2))
+	var rows []any
+	var stars sliceStore
+	for i := 0; i < 500; i++ {
+		ra, dec := math.Mod(random.Float64()*4-2+360, 360), random.Float64()*4-2
+		rows = append(rows, coneStar{GalaxyId: milky_way.Id, Name: "cone" + strconv.Itoa(i), GaiaCatalogueId: "cone" + strconv.Itoa(i), Ra: ra, Dec: dec})
+		stars = append(stars, starAt("cone"+strconv.Itoa(i), ra, dec))
+	}
+	if err := db.InsertRows(ctx, "stars", rows); err != nil {
+		t.Fatalf(`InsertRows %v`, err)
+	}
+
+	// The stars are searched by their healpix column too, once they have been given a pixel
+	if _, err := NewSQLStore(db).IndexHealpix(ctx, 12); err != nil {
+		t.Fatalf(`IndexHealpix %v`, err)
+	}
+	indexed := NewSQLStore(db)
+	indexed.HealpixOrder = 12
+
+	for _, store := range []*SQLStore{NewSQLStore(db), indexed} {
+		for _, cone := range [][3]float64{{0, 0, 1}, {359.5, 1, 0.75}, {1, -1, 0.5}} {
+			got, err := ConeSearch(ctx, store, cone[0], cone[1], cone[2])
+			if err != nil {
+				t.Fatalf(`ConeSearch %v`, err)
+			}
+			want, _ := ConeSearch(ctx, stars, cone[0], cone[1], cone[2])
+
+			if len(got) == 0 || len(got) != len(want) {
+				t.Fatalf(`ConeSearch %v with HEALPix order %d should find %d stars, found %d`, cone, store.HealpixOrder, len(want), len(got))
+			}
+			for i := range got {
+				if got[i].Name != want[i].Name || got[i].Distance != astro.AngularDistance(cone[0], cone[1], *got[i].Ra, *got[i].Dec) {
+					t.Fatalf(`ConeSearch %v result %d should be %s, is %+v`, cone, i, want[i].Name, got[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package star
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"star-catalog/astro"
+	"star-catalog/database"
+	galaxypkg "star-catalog/galaxy"
+)
+
+// DefaultMinParallaxSNR is the parallax over error below which the pipeline gives stars no
+// distance, when derived.min_parallax_snr isn't set in config.yml. Inverting parallaxes
+// noisier than about 1 in 5 gives badly biased distances.
+const DefaultMinParallaxSNR = 5.0
+
+// derivedBatchSize is the number of stars' derived values DerivedWriter saves in each
+// transaction
+const derivedBatchSize = 1000
+
+// ParallaxOptions say how parallaxes are turned into distances. The zero value inverts every
+// positive parallax as it is.
+type ParallaxOptions struct {
+	// ZeroPoint is the parallax zero point in milliarcseconds, which is subtracted from each
+	// parallax before it is used. Gaia DR3's is about -0.017 mas.
+	ZeroPoint float64
+	// MinSNR is the smallest parallax over parallax_error that gives a distance. If it is
+	// more than 0, stars without a parallax_error have no distance either.
+	MinSNR float64
+}
+
+// Distance returns the star's distance in parsecs from its parallax, or false if it has no
+// parallax, or one that isn't positive or is too noisy for options.
+func (star Star) Distance(options ParallaxOptions) (float64, bool) {
+	if star.Parallax == nil {
+		return 0, false
+	}
+	parallax := *star.Parallax - options.ZeroPoint
+	if options.MinSNR > 0 && (star.ParallaxError == nil || !(parallax/(*star.ParallaxError) >= options.MinSNR)) {
+		return 0, false
+	}
+	return astro.ParallaxDistance(parallax)
+}
+
+// DistanceModulus returns the star's distance modulus, m - M, or false if it has no Distance.
+func (star Star) DistanceModulus(options ParallaxOptions) (float64, bool) {
+	distance, ok := star.Distance(options)
+	if !ok {
+		return 0, false
+	}
+	return astro.DistanceModulus(distance), true
+}
+
+// AbsoluteGMag returns the star's absolute magnitude in the Gaia G band, or false if it has
+// no G magnitude or no Distance. Extinction is left out, so stars behind dust come out too
+// faint.
+func (star Star) AbsoluteGMag(options ParallaxOptions) (float64, bool) {
+	distance_modulus, ok := star.DistanceModulus(options)
+	if !ok || star.PhotGMeanMag == nil {
+		return 0, false
+	}
+	return *star.PhotGMeanMag - distance_modulus, true
+}
+
+// BpRp returns the star's Gaia BP - RP colour in magnitudes, which is bigger for redder,
+// cooler stars, or false if it doesn't have both magnitudes.
+func (star Star) BpRp() (float64, bool) {
+	if star.PhotBpMeanMag == nil || star.PhotRpMeanMag == nil {
+		return 0, false
+	}
+	return *star.PhotBpMeanMag - *star.PhotRpMeanMag, true
+}
+
+// TangentialVelocity returns the star's speed across the line of sight in km/s, from its
+// proper motion and Distance, or false if it has no proper motion or no Distance.
+func (star Star) TangentialVelocity(options ParallaxOptions) (float64, bool) {
+	distance, ok := star.Distance(options)
+	if !ok || star.Pmra == nil || star.Pmdec == nil {
+		return 0, false
+	}
+	return astro.TangentialVelocity(math.Hypot(*star.Pmra, *star.Pmdec), distance), true
+}
+
+// Derived holds the values worked out from a star's astrometry and photometry, each nil if
+// the star doesn't have what it needs. The db tags name the star_derived table's columns.
+type Derived struct {
+	StarId             int64    `db:"star_id" ucd:"meta.id"`
+	Distance           *float64 `db:"distance" ucd:"pos.distance" unit:"pc"`
+	DistanceModulus    *float64 `db:"distance_modulus" ucd:"phot.mag.distMod" unit:"mag"`
+	AbsGMag            *float64 `db:"abs_g_mag" ucd:"phys.magAbs;em.opt" unit:"mag"`
+	BpRp               *float64 `db:"bp_rp" ucd:"phot.color" unit:"mag"`
+	TangentialVelocity *float64 `db:"tangential_velocity" ucd:"phys.veloc" unit:"km/s"`
+}
+
+// Derive returns all the star's derived values.
+func (star Star) Derive(options ParallaxOptions) Derived {
+	optional := func(value float64, ok bool) *float64 {
+		if !ok {
+			return nil
+		}
+		return &value
+	}
+	return Derived{
+		StarId:             star.Id,
+		Distance:           optional(star.Distance(options)),
+		DistanceModulus:    optional(star.DistanceModulus(options)),
+		AbsGMag:            optional(star.AbsoluteGMag(options)),
+		BpRp:               optional(star.BpRp()),
+		TangentialVelocity: optional(star.TangentialVelocity(options)),
+	}
+}
+
+// DeriveProcessor returns a StarProcessor that works out each star's Derived values and
+// passes them to fn, such as a DerivedWriter's Write, which saves them.
+func DeriveProcessor(options ParallaxOptions, fn func(ctx context.Context, galaxy galaxypkg.Galaxy, derived Derived) error) StarProcessor {
+	return StarProcessorFunc(func(ctx context.Context, galaxy galaxypkg.Galaxy, star Star) error {
+		return fn(ctx, galaxy, star.Derive(options))
+	})
+}
+
+// A DerivedWriter saves stars' Derived values to the star_derived table, replacing any
+// already there, derivedBatchSize stars at a time. It is safe to use from the pipeline's
+// goroutines at once. Flush must be called after the last Write.
+type DerivedWriter struct {
+	db      *database.DB
+	mutex   sync.Mutex
+	pending []any
+}
+
+// NewDerivedWriter returns a DerivedWriter that saves to the star_derived table of the
+// store's database.
+func (store *SQLStore) NewDerivedWriter() *DerivedWriter {
+	return &DerivedWriter{db: store.db}
+}
+
+// Write adds derived to the values waiting to be saved, and saves them if there are
+// derivedBatchSize. It has the signature DeriveProcessor needs.
+func (writer *DerivedWriter) Write(ctx context.Context, galaxy galaxypkg.Galaxy, derived Derived) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	writer.pending = append(writer.pending, derived)
+	if len(writer.pending) < derivedBatchSize {
+		return nil
+	}
+	return writer.save(ctx)
+}
+
+// Flush saves the values that are still waiting.
+func (writer *DerivedWriter) Flush(ctx context.Context) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	return writer.save(ctx)
+}
+
+// Replace the pending stars' rows in one transaction. The mutex is held.
+func (writer *DerivedWriter) save(ctx context.Context) error {
+	if len(writer.pending) == 0 {
+		return nil
+	}
+
+	tx, err := writer.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("DerivedWriter: %v", err)
+	}
+	defer tx.Rollback()
+
+	ids := make([]any, len(writer.pending))
+	for i, derived := range writer.pending {
+		ids[i] = derived.(Derived).StarId
+	}
+	query := "DELETE FROM star_derived WHERE star_id IN (" + database.Placeholders(len(ids)) + ")"
+	if _, err := tx.ExecContext(ctx, writer.db.Rebind(query), ids...); err != nil {
+		return fmt.Errorf("DerivedWriter: %v", err)
+	}
+	if err := writer.db.InsertRowsTx(ctx, tx, "star_derived", writer.pending); err != nil {
+		return fmt.Errorf("DerivedWriter: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("DerivedWriter: %v", err)
+	}
+
+	writer.pending = nil
+	return nil
+}
@@ -0,0 +1,116 @@
+// Tests for the derived values of stars, DeriveProcessor and DerivedWriter
+package star
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"star-catalog/database"
+	"star-catalog/galaxy"
+)
+
+// Return a pointer to value, for optional fields
+func float(value float64) *float64 {
+	return &value
+}
+
+// TestDistance checks the parallax options: the zero point, the signal to noise limit, and
+// parallaxes that give no distance
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		parallax, parallax_error *float64
+		options                  ParallaxOptions
+		want                     float64
+		ok                       bool
+	}{
+		{float(100), nil, ParallaxOptions{}, 10, true},
+		{float(100), float(1), ParallaxOptions{MinSNR: 5}, 10, true},
+		{float(0.98), float(0.1), ParallaxOptions{ZeroPoint: -0.02}, 1000, true},
+		{float(0.5), float(0.2), ParallaxOptions{MinSNR: 5}, 0, false},
+		{float(100), nil, ParallaxOptions{MinSNR: 5}, 0, false},
+		{float(-0.3), float(0.2), ParallaxOptions{}, 0, false},
+		{float(0), nil, ParallaxOptions{}, 0, false},
+		{nil, nil, ParallaxOptions{}, 0, false},
+	}
+
+	for _, test := range tests {
+		star := Star{Parallax: test.parallax, ParallaxError: test.parallax_error}
+		got, ok := star.Distance(test.options)
+		if ok != test.ok || math.Abs(got-test.want) > 1e-9 {
+			t.Fatalf(`Distance with %+v should be %v, %v, is %v, %v`, test.options, test.want, test.ok, got, ok)
+		}
+	}
+}
+
+// TestDerive checks the values derived for a star at 100 pc, and for one without a
+// parallax or photometry
+func TestDerive(t *testing.T) {
+	star := Star{
+		Id:            7,
+		Parallax:      float(10),
+		ParallaxError: float(0.1),
+		Pmra:          float(30),
+		Pmdec:         float(-40),
+		PhotGMeanMag:  float(12),
+		PhotBpMeanMag: float(12.4),
+		PhotRpMeanMag: float(11.5),
+	}
+
+	derived := star.Derive(ParallaxOptions{MinSNR: DefaultMinParallaxSNR})
+	// 50 mas/yr at 100 pc is 5 au a year
+	want := []float64{100, 5, 7, 0.9, 5 * 4.740470446}
+	got := []*float64{derived.Distance, derived.DistanceModulus, derived.AbsGMag, derived.BpRp, derived.TangentialVelocity}
+	for i := range want {
+		if got[i] == nil || math.Abs(*got[i]-want[i]) > 1e-9 {
+			t.Fatalf(`Derived value %d should be %v, is %v`, i, want[i], got[i])
+		}
+	}
+	if derived.StarId != 7 {
+		t.Fatalf(`Derived values should be for star 7, are for %d`, derived.StarId)
+	}
+
+	empty := Star{Id: 8, PhotGMeanMag: float(12)}.Derive(ParallaxOptions{})
+	if empty.Distance != nil || empty.DistanceModulus != nil || empty.AbsGMag != nil || empty.BpRp != nil || empty.TangentialVelocity != nil {
+		t.Fatalf(`A star without a parallax or colour should have no derived values, has %+v`, empty)
+	}
+}
+
+// TestDerivedWriter saves the derived values of Andromeda's stars through DeriveProcessor,
+// twice, and checks that the rows are replaced rather than added again
+func TestDerivedWriter(t *testing.T) {
+	db := database.InitDB()
+	store := NewSQLStore(db)
+
+	andromeda, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number2")
+	if err != nil {
+		t.Fatalf(`FindGalaxy %v`, err)
+	}
+
+	for _, options := range []ParallaxOptions{{MinSNR: 5}, {}} {
+		writer := store.NewDerivedWriter()
+		processor := DeriveProcessor(options, writer.Write)
+		err := store.EachGalaxyStar(context.Background(), andromeda, func(star Star) error {
+			return processor.Process(context.Background(), andromeda, star)
+		})
+		if err != nil {
+			t.Fatalf(`DeriveProcessor %v`, err)
+		}
+		if err := writer.Flush(context.Background()); err != nil {
+			t.Fatalf(`Flush %v`, err)
+		}
+	}
+
+	var rows int
+	var distance, bp_rp float64
+	err = db.QueryRow("SELECT COUNT(*) FROM star_derived").Scan(&rows)
+	if err != nil || rows != 3 {
+		t.Fatalf(`star_derived should have 3 rows, has %d, %v`, rows, err)
+	}
+	// Star3's parallax of 0.0013 mas only gives a distance without the signal to noise limit
+	query := "SELECT distance, bp_rp FROM star_derived JOIN stars ON stars.id = star_derived.star_id WHERE stars.name = 'Star3'"
+	err = db.QueryRow(query).Scan(&distance, &bp_rp)
+	if err != nil || math.Abs(distance-1000/0.0013) > 1e-6 || math.Abs(bp_rp-1.1) > 1e-9 {
+		t.Fatalf(`Star3 should be 769231 pc away with BP-RP 1.1, is %v, %v, %v`, distance, bp_rp, err)
+	}
+}
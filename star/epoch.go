@@ -0,0 +1,99 @@
+package star
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"star-catalog/astro"
+	galaxypkg "star-catalog/galaxy"
+)
+
+// AtEpoch returns a copy of the star with its astrometry moved from astro.GaiaEpoch, the
+// epoch of the stored positions, to epoch, a Julian year, by astro.Propagate. The proper
+// motion moves the position, and a positive parallax and a radial velocity, if the star has
+// them, account for it moving towards or away from us, which also changes its parallax,
+// proper motion and radial velocity. Fields that are nil stay nil, and a star without a
+// position or a proper motion, or at astro.GaiaEpoch, is returned unchanged.
+func (star Star) AtEpoch(epoch float64) Star {
+	if epoch == astro.GaiaEpoch || star.Ra == nil || star.Dec == nil || (star.Pmra == nil && star.Pmdec == nil) {
+		return star
+	}
+
+	value := func(field *float64) float64 {
+		if field == nil {
+			return 0
+		}
+		return *field
+	}
+	moved := astro.Propagate(astro.Astrometry{
+		Ra:             *star.Ra,
+		Dec:            *star.Dec,
+		Parallax:       value(star.Parallax),
+		Pmra:           value(star.Pmra),
+		Pmdec:          value(star.Pmdec),
+		RadialVelocity: value(star.RadialVelocity),
+	}, epoch-astro.GaiaEpoch)
+
+	// New pointers, so the original star isn't changed
+	set := func(field **float64, value float64) {
+		if *field != nil {
+			*field = &value
+		}
+	}
+	set(&star.Ra, moved.Ra)
+	set(&star.Dec, moved.Dec)
+	set(&star.Parallax, moved.Parallax)
+	set(&star.Pmra, moved.Pmra)
+	set(&star.Pmdec, moved.Pmdec)
+	set(&star.RadialVelocity, moved.RadialVelocity)
+	return star
+}
+
+// ConeSearchAt is ConeSearch for positions at epoch, a Julian year. It searches the stored
+// positions with a radius widened by the furthest a star could have moved, astro.MaxProperMotion,
+// moves the stars found to epoch with AtEpoch, and keeps those within radius.
+// The results have the moved stars, and their distances at epoch.
+func ConeSearchAt(ctx context.Context, store ConeSearcher, ra float64, dec float64, radius float64, epoch float64) ([]ConeResult, error) {
+	if math.IsNaN(epoch) {
+		return nil, fmt.Errorf("ConeSearchAt: epoch %v is not a year", epoch)
+	}
+	margin := math.Abs(epoch-astro.GaiaEpoch) * astro.MaxProperMotion / 3600 / 1000
+
+	found, err := ConeSearch(ctx, store, ra, dec, radius+margin)
+	if err != nil {
+		return nil, fmt.Errorf("ConeSearchAt: %w", err)
+	}
+
+	// ConeSearch has checked the position
+	ra = normalizeRa(ra)
+	var results []ConeResult
+	for _, result := range found {
+		moved := result.Star.AtEpoch(epoch)
+		distance := astro.AngularDistance(ra, dec, *moved.Ra, *moved.Dec)
+		if distance <= radius {
+			results = append(results, ConeResult{Star: moved, Distance: distance})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Distance < results[j].Distance
+	})
+	return results, nil
+}
+
+// EpochStore is a StarStore whose stars are moved to Epoch, a Julian year, with AtEpoch, for
+// exporting or processing positions at another date.
+type EpochStore struct {
+	StarStore
+	Epoch float64
+}
+
+// EachGalaxyStar calls fn for each of the galaxy's stars in the underlying store, moved to
+// store.Epoch.
+func (store EpochStore) EachGalaxyStar(ctx context.Context, galaxy galaxypkg.Galaxy, fn func(Star) error) error {
+	return store.StarStore.EachGalaxyStar(ctx, galaxy, func(star Star) error {
+		return fn(star.AtEpoch(store.Epoch))
+	})
+}
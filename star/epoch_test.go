@@ -0,0 +1,105 @@
+// Tests for Star.AtEpoch, ConeSearchAt and EpochStore
+package star
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"star-catalog/galaxy"
+)
+
+// EachGalaxyStar makes sliceStore a StarStore too
+func (store sliceStore) EachGalaxyStar(ctx context.Context, galaxy galaxy.Galaxy, fn func(Star) error) error {
+	for _, star := range store {
+		if star.GalaxyId == galaxy.Id {
+			if err := fn(star); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Return Barnard's star as Gaia DR3 has it, with no parallax error
+func barnardsStar() Star {
+	star := starAt("Barnard's star", 269.44850252543836, 4.739420051112412)
+	parallax, pmra, pmdec, radial_velocity := 546.975939730948, -801.551, 10362.394, -110.353
+	star.Parallax, star.Pmra, star.Pmdec, star.RadialVelocity = &parallax, &pmra, &pmdec, &radial_velocity
+	star.GalaxyId = 1
+	return star
+}
+
+// TestAtEpoch moves Barnard's star back to J2000, about 166 arcseconds south, and checks
+// that the original star is unchanged, and that stars without a proper motion don't move
+func TestAtEpoch(t *testing.T) {
+	star := barnardsStar()
+	moved := star.AtEpoch(2000)
+
+	if south := (*star.Dec - *moved.Dec) * 3600; math.Abs(south-165.6) > 0.1 {
+		t.Fatalf(`Barnard's star should be 165.6" further south at J2000, is %v"`, south)
+	}
+	if *moved.Parallax >= *star.Parallax || *moved.Pmdec >= *star.Pmdec || *moved.RadialVelocity == *star.RadialVelocity {
+		t.Fatalf(`Barnard's star's parallax, proper motion and radial velocity should change, are %v %v %v`, *moved.Parallax, *moved.Pmdec, *moved.RadialVelocity)
+	}
+	if *star.Dec != 4.739420051112412 || *star.Parallax != 546.975939730948 {
+		t.Fatalf(`AtEpoch should not change the original star, is %v %v`, *star.Dec, *star.Parallax)
+	}
+	if moved.ParallaxError != nil || moved.PhotGMeanMag != nil {
+		t.Fatalf(`AtEpoch should leave nil fields nil`)
+	}
+
+	if same := star.AtEpoch(2016); *same.Ra != *star.Ra || *same.Dec != *star.Dec {
+		t.Fatalf(`At J2016 Barnard's star should be where Gaia saw it, is %v %v`, *same.Ra, *same.Dec)
+	}
+
+	still := starAt("still", 10, 20)
+	if moved := still.AtEpoch(1900); moved.Ra != still.Ra || moved.Dec != still.Dec {
+		t.Fatalf(`A star without a proper motion should not move, is %v %v`, *moved.Ra, *moved.Dec)
+	}
+	if moved := (Star{Name: "Sun"}).AtEpoch(2000); moved.Ra != nil {
+		t.Fatalf(`A star without a position should have none at another epoch`)
+	}
+}
+
+// TestConeSearchAt finds Barnard's star at its J2000 position and not its J2016 one, and
+// a star without a proper motion at both
+func TestConeSearchAt(t *testing.T) {
+	barnard := barnardsStar()
+	j2000 := barnard.AtEpoch(2000)
+	store := sliceStore{barnard, starAt("still", *j2000.Ra, *j2000.Dec+0.5/3600)}
+
+	arcsecond := 1.0 / 3600
+	results, err := ConeSearchAt(context.Background(), store, *j2000.Ra, *j2000.Dec, arcsecond, 2000)
+	if err != nil || len(results) != 2 || results[0].Name != "Barnard's star" || results[0].Distance > 1e-9 || *results[0].Dec != *j2000.Dec {
+		t.Fatalf(`ConeSearchAt J2000 should find Barnard's star where it was, then the still star, is %+v, %v`, results, err)
+	}
+
+	results, err = ConeSearchAt(context.Background(), store, *barnard.Ra, *barnard.Dec, arcsecond, 2000)
+	if err != nil || len(results) != 0 {
+		t.Fatalf(`ConeSearchAt J2000 should not find Barnard's star at its J2016 position, is %v, %v`, names(results), err)
+	}
+	results, err = ConeSearchAt(context.Background(), store, *barnard.Ra, *barnard.Dec, arcsecond, 2016)
+	if err != nil || len(results) != 1 {
+		t.Fatalf(`ConeSearchAt J2016 should find Barnard's star at its Gaia position, is %v, %v`, names(results), err)
+	}
+
+	if _, err := ConeSearchAt(context.Background(), store, 10, 20, 1, math.NaN()); err == nil {
+		t.Fatalf(`ConeSearchAt should fail without an epoch`)
+	}
+}
+
+// TestEpochStore checks that EpochStore moves a galaxy's stars
+func TestEpochStore(t *testing.T) {
+	store := EpochStore{StarStore: sliceStore{barnardsStar()}, Epoch: 2000}
+
+	var stars []Star
+	err := store.EachGalaxyStar(context.Background(), galaxy.Galaxy{Id: 1}, func(star Star) error {
+		stars = append(stars, star)
+		return nil
+	})
+	want := barnardsStar().AtEpoch(2000)
+	if err != nil || len(stars) != 1 || *stars[0].Ra != *want.Ra || *stars[0].Dec != *want.Dec {
+		t.Fatalf(`EpochStore should return Barnard's star at J2000, is %v, %v`, stars, err)
+	}
+}
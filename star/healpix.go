@@ -0,0 +1,141 @@
+package star
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"star-catalog/healpix"
+)
+
+// indexBatchSize is the number of stars IndexHealpix updates in each transaction
+const indexBatchSize = 1000
+
+// IndexHealpix sets the healpix column of every star to the NESTED pixel at order holding its
+// ra and dec, or to NULL if it has no position, and returns the number of stars with a pixel.
+// Stars are read and updated indexBatchSize at a time, in id order, so any number of stars
+// can be indexed in bounded memory. It is needed after the stars table gets its healpix
+// column, and after the order changes.
+func (store *SQLStore) IndexHealpix(ctx context.Context, order int) (int64, error) {
+	if err := healpix.CheckOrder(order); err != nil {
+		return 0, fmt.Errorf("IndexHealpix: %v", err)
+	}
+
+	query := store.db.Rebind("SELECT id, " + store.db.QuoteList([]string{"ra", "dec"}) +
+		" FROM stars WHERE id > ? ORDER BY id LIMIT " + fmt.Sprint(indexBatchSize))
+
+	var indexed int64
+	var last_id int64
+	for {
+		batch, err := store.healpixBatch(ctx, query, order, last_id)
+		if err != nil {
+			return indexed, fmt.Errorf("IndexHealpix: %v", err)
+		}
+		if len(batch) == 0 {
+			return indexed, nil
+		}
+
+		if err := store.updateHealpix(ctx, batch); err != nil {
+			return indexed, fmt.Errorf("IndexHealpix: %v", err)
+		}
+		for _, star := range batch {
+			if star.pixel != nil {
+				indexed++
+			}
+		}
+		last_id = batch[len(batch)-1].id
+	}
+}
+
+// UseHealpix sets store.HealpixOrder to order, so that searches use the healpix column, and
+// returns true, if the column has been indexed at that order. Otherwise it leaves
+// HealpixOrder 0, so that searches only use ra and dec and still find every star, and returns
+// false. That is the case after migrating a table of stars, which gives them no pixel, and
+// after the order changes, until IndexHealpix has been run. The order is checked with the
+// first star that has a pixel, as IndexHealpix gives them all the same order.
+func (store *SQLStore) UseHealpix(ctx context.Context, order int) (bool, error) {
+	store.HealpixOrder = 0
+
+	ra_column := store.db.Dialect.QuoteIdentifier("ra")
+	dec_column := store.db.Dialect.QuoteIdentifier("dec")
+	positioned := ra_column + " IS NOT NULL AND " + dec_column + " IS NOT NULL"
+	var missing int
+	err := store.db.QueryRowContext(ctx, "SELECT 1 FROM stars WHERE healpix IS NULL AND "+positioned+" LIMIT 1").Scan(&missing)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("UseHealpix: %v", err)
+	}
+
+	var ra, dec float64
+	var pixel int64
+	query := "SELECT " + ra_column + ", " + dec_column + ", healpix FROM stars WHERE healpix IS NOT NULL AND " + positioned + " ORDER BY id LIMIT 1"
+	err = store.db.QueryRowContext(ctx, query).Scan(&ra, &dec, &pixel)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("UseHealpix: %v", err)
+	}
+	if err == nil && healpix.Pixel(order, ra, dec) != pixel {
+		return false, nil
+	}
+
+	store.HealpixOrder = order
+	return true, nil
+}
+
+// A starPixel is the pixel of the star with the given id, or nil if it has no position
+type starPixel struct {
+	id    int64
+	pixel *int64
+}
+
+// Read the batch of stars after last_id, working out their pixels
+func (store *SQLStore) healpixBatch(ctx context.Context, query string, order int, last_id int64) ([]starPixel, error) {
+	rows, err := store.db.QueryContext(ctx, query, last_id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var batch []starPixel
+	for rows.Next() {
+		var id int64
+		var ra, dec *float64
+		if err := rows.Scan(&id, &ra, &dec); err != nil {
+			return nil, err
+		}
+
+		star := starPixel{id: id}
+		if ra != nil && dec != nil {
+			pixel := healpix.Pixel(order, *ra, *dec)
+			star.pixel = &pixel
+		}
+		batch = append(batch, star)
+	}
+
+	return batch, rows.Err()
+}
+
+// Set the pixels of a batch of stars in one transaction
+func (store *SQLStore) updateHealpix(ctx context.Context, batch []starPixel) error {
+	tx, err := store.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.PrepareContext(ctx, store.db.Rebind("UPDATE stars SET healpix = ? WHERE id = ?"))
+	if err != nil {
+		return err
+	}
+	defer statement.Close()
+
+	for _, star := range batch {
+		if _, err := statement.ExecContext(ctx, star.pixel, star.id); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,86 @@
+// Tests for SQLStore.IndexHealpix and SQLStore.UseHealpix
+package star
+
+import (
+	"context"
+	"testing"
+
+	"star-catalog/database"
+	"star-catalog/healpix"
+)
+
+// TestIndexHealpix clears the fixture stars' pixels, indexes them again at another order,
+// and checks the pixels of stars with and without a position
+func TestIndexHealpix(t *testing.T) {
+	db := database.InitDB()
+	ctx := context.Background()
+
+	if _, err := db.Exec("UPDATE stars SET healpix = NULL"); err != nil {
+		t.Fatalf(`Clearing healpix %v`, err)
+	}
+
+	indexed, err := NewSQLStore(db).IndexHealpix(ctx, 8)
+	if err != nil || indexed != 4 {
+		t.Fatalf(`IndexHealpix should index the 4 stars with a position, is %d, %v`, indexed, err)
+	}
+
+	var pixel *int64
+	err = db.QueryRow("SELECT healpix FROM stars WHERE name = 'Star4'").Scan(&pixel)
+	if want := healpix.Pixel(8, 10.7420, 41.3120); err != nil || pixel == nil || *pixel != want {
+		t.Fatalf(`Star4 should be in pixel %d, is %v, %v`, want, pixel, err)
+	}
+	err = db.QueryRow("SELECT healpix FROM stars WHERE name = 'Sun'").Scan(&pixel)
+	if err != nil || pixel != nil {
+		t.Fatalf(`The Sun has no position and should have no pixel, is %v, %v`, pixel, err)
+	}
+
+	if _, err := NewSQLStore(db).IndexHealpix(ctx, -1); err == nil {
+		t.Fatalf(`IndexHealpix should refuse order -1`)
+	}
+}
+
+// TestUseHealpix checks that the healpix column is only used when every star with a
+// position has a pixel at the order, and that cone searches find Star3 either way
+func TestUseHealpix(t *testing.T) {
+	db := database.InitDB()
+	ctx := context.Background()
+	store := NewSQLStore(db)
+	order, err := database.HealpixOrder()
+	if err != nil {
+		t.Fatalf(`HealpixOrder %v`, err)
+	}
+
+	find := func() {
+		results, err := ConeSearch(ctx, store, 10.6847, 41.269, 0.001)
+		if err != nil || len(results) != 1 || results[0].Name != "Star3" {
+			t.Fatalf(`ConeSearch with HealpixOrder %d should find Star3, is %v, %v`, store.HealpixOrder, names(results), err)
+		}
+	}
+
+	if ok, err := store.UseHealpix(ctx, order); !ok || err != nil || store.HealpixOrder != order {
+		t.Fatalf(`The seeded stars should be indexed at order %d, is %v %d, %v`, order, ok, store.HealpixOrder, err)
+	}
+	find()
+
+	// As after the migration that adds the column
+	if _, err := db.Exec("UPDATE stars SET healpix = NULL WHERE name = 'Star3'"); err != nil {
+		t.Fatalf(`Clearing healpix %v`, err)
+	}
+	if ok, err := store.UseHealpix(ctx, order); ok || err != nil || store.HealpixOrder != 0 {
+		t.Fatalf(`A star without a pixel should stop the column being used, is %v %d, %v`, ok, store.HealpixOrder, err)
+	}
+	find()
+
+	// As after the order changes
+	if _, err := store.IndexHealpix(ctx, 8); err != nil {
+		t.Fatalf(`IndexHealpix %v`, err)
+	}
+	if ok, err := store.UseHealpix(ctx, order); ok || err != nil || store.HealpixOrder != 0 {
+		t.Fatalf(`Pixels at order 8 should stop the column being used at order %d, is %v %d, %v`, order, ok, store.HealpixOrder, err)
+	}
+	find()
+	if ok, err := store.UseHealpix(ctx, 8); !ok || err != nil || store.HealpixOrder != 8 {
+		t.Fatalf(`Pixels at order 8 should be used at order 8, is %v %d, %v`, ok, store.HealpixOrder, err)
+	}
+	find()
+}
@@ -0,0 +1,38 @@
+package star
+
+import (
+	"context"
+
+	galaxypkg "star-catalog/galaxy"
+)
+
+// A StarProcessor does the work for each star found by the pipeline.
+// An error stops processing of the star's galaxy and is passed back to the pipeline.
+type StarProcessor interface {
+	Process(ctx context.Context, galaxy galaxypkg.Galaxy, star Star) error
+}
+
+// StarProcessorFunc allows an ordinary function to be used as a StarProcessor.
+type StarProcessorFunc func(ctx context.Context, galaxy galaxypkg.Galaxy, star Star) error
+
+// Process calls f(ctx, galaxy, star).
+func (f StarProcessorFunc) Process(ctx context.Context, galaxy galaxypkg.Galaxy, star Star) error {
+	return f(ctx, galaxy, star)
+}
+
+// ChainProcessors returns a StarProcessor that calls each of processors in turn for every
+// star, for example to log, validate and then export it.
+// It stops at the first error, so later processors only see stars that earlier ones accepted.
+// Each processor gets its own copy of the star, so changes aren't passed along the chain. To
+// enrich stars, work out the new values in a processor and hand them to whatever uses them,
+// as DeriveProcessor passes Derived values to a DerivedWriter.
+func ChainProcessors(processors ...StarProcessor) StarProcessor {
+	return StarProcessorFunc(func(ctx context.Context, galaxy galaxypkg.Galaxy, star Star) error {
+		for _, processor := range processors {
+			if err := processor.Process(ctx, galaxy, star); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+// Tests for ChainProcessors
+package star
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"star-catalog/galaxy"
+)
+
+// TestChainProcessors calls a chain of processors and checks that they are called in order
+func TestChainProcessors(t *testing.T) {
+	var got []string
+
+	record := func(name string) StarProcessor {
+		return StarProcessorFunc(func(ctx context.Context, galaxy galaxy.Galaxy, star Star) error {
+			got = append(got, name+" "+star.Name)
+			return nil
+		})
+	}
+
+	chain := ChainProcessors(record("first"), record("second"))
+
+	err := chain.Process(context.Background(), galaxy.Galaxy{Name: "Milky Way"}, Star{Name: "Sun"})
+	if err != nil {
+		t.Fatalf(`ChainProcessors %v`, err)
+	}
+
+	want := []string{"first Sun", "second Sun"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf(`Processors should be called as %v, were %v`, want, got)
+	}
+}
+
+// TestChainProcessorsError checks that a chain stops at the first processor that
+// returns an error, and returns that error
+func TestChainProcessorsError(t *testing.T) {
+	want := errors.New("invalid star")
+	called := false
+
+	failing := StarProcessorFunc(func(ctx context.Context, galaxy galaxy.Galaxy, star Star) error {
+		return want
+	})
+	after := StarProcessorFunc(func(ctx context.Context, galaxy galaxy.Galaxy, star Star) error {
+		called = true
+		return nil
+	})
+
+	err := ChainProcessors(failing, after).Process(context.Background(), galaxy.Galaxy{}, Star{})
+
+	if !errors.Is(err, want) {
+		t.Fatalf(`ChainProcessors should return %v, is %v`, want, err)
+	}
+	if called {
+		t.Fatalf(`Processors after a failure should not be called`)
+	}
+}
@@ -1,49 +1,128 @@
-// Package star implements the Star struct and function GalaxyStarChannel.
+// Package star implements the Star struct, the StarStore interface and its SQL
+// implementation SQLStore, and the function GalaxyStarChannel. It also provides the
+// StarProcessor interface for the work done on each star.
 // ValidateStar is availble to use in tests.
 // Stars are saved to the stars table.
 package star
 
 import (
-	"database/sql"
+	"context"
+	"star-catalog/astro/coords"
+	"star-catalog/database"
 	galaxypkg "star-catalog/galaxy"
 	"time"
 )
 
-// A Star has an GalaxyId (foreign key to galaxies table), Name, and GaiaCatalogueId
+// A Star has an GalaxyId (foreign key to galaxies table), Name, and GaiaCatalogueId,
+// and Gaia-style astrometry and photometry. The astrometry fields are nil where the value
+// is unknown, since Gaia has gaps and not every star comes from Gaia.
+// The db tags name the stars table column for each field. The ucd and unit tags describe
+// the field for other astronomy tools, as IVOA UCDs and VOUnits; package votable uses them.
 type Star struct {
-	Id              int64
-	GalaxyId        int64
-	Name            string
-	GaiaCatalogueId string
-	CreatedAt       time.Time
+	Id              int64     `db:"id" ucd:"meta.id"`
+	GalaxyId        int64     `db:"galaxy_id" ucd:"meta.id.parent"`
+	Name            string    `db:"name" ucd:"meta.id;meta.main"`
+	GaiaCatalogueId string    `db:"gaia_catalogue_id" ucd:"meta.id.cross"`
+	CreatedAt       time.Time `db:"created_at" ucd:"time.creation"`
+
+	Ra             *float64 `db:"ra" ucd:"pos.eq.ra;meta.main" unit:"deg"`                      // right ascension, degrees (ICRS)
+	Dec            *float64 `db:"dec" ucd:"pos.eq.dec;meta.main" unit:"deg"`                    // declination, degrees (ICRS)
+	Parallax       *float64 `db:"parallax" ucd:"pos.parallax.trig" unit:"mas"`                  // milliarcseconds
+	ParallaxError  *float64 `db:"parallax_error" ucd:"stat.error;pos.parallax.trig" unit:"mas"` // milliarcseconds
+	Pmra           *float64 `db:"pmra" ucd:"pos.pm;pos.eq.ra" unit:"mas/yr"`                    // proper motion in RA * cos(dec), milliarcseconds/year
+	Pmdec          *float64 `db:"pmdec" ucd:"pos.pm;pos.eq.dec" unit:"mas/yr"`                  // proper motion in dec, milliarcseconds/year
+	RadialVelocity *float64 `db:"radial_velocity" ucd:"spect.dopplerVeloc.opt" unit:"km/s"`     // km/s
+	PhotGMeanMag   *float64 `db:"phot_g_mean_mag" ucd:"phot.mag;em.opt" unit:"mag"`             // Gaia G band mean magnitude
+	PhotBpMeanMag  *float64 `db:"phot_bp_mean_mag" ucd:"phot.mag;em.opt.B" unit:"mag"`          // Gaia BP band mean magnitude
+	PhotRpMeanMag  *float64 `db:"phot_rp_mean_mag" ucd:"phot.mag;em.opt.R" unit:"mag"`          // Gaia RP band mean magnitude
 }
 
-// GalaxyStarChannel takes a db connection and a Galaxy, and fills a channel of Star structs
-// for the given Galaxy.Id from database table stars
-func GalaxyStarChannel(db *sql.DB, galaxy galaxypkg.Galaxy, star_channel chan Star) error {
-	// Make sure the channels are closed when the method returns
-	defer close(star_channel)
+// Position returns the star's position in frame, as a longitude and latitude in degrees,
+// or false if it has no position.
+func (star Star) Position(frame coords.Frame) (float64, float64, bool) {
+	if star.Ra == nil || star.Dec == nil {
+		return 0, 0, false
+	}
+	lon, lat := coords.FromICRS(frame, *star.Ra, *star.Dec)
+	return lon, lat, true
+}
+
+// Galactic returns the star's Galactic longitude and latitude, l and b, in degrees, or false
+// if it has no position.
+func (star Star) Galactic() (float64, float64, bool) {
+	return star.Position(coords.Galactic)
+}
 
-	rows, err := db.Query("SELECT * FROM stars WHERE galaxy_id = ?", galaxy.Id)
+// Ecliptic returns the star's ecliptic longitude and latitude in degrees, or false if it
+// has no position.
+func (star Star) Ecliptic() (float64, float64, bool) {
+	return star.Position(coords.Ecliptic)
+}
+
+// A StarStore reads stars from wherever they are kept.
+// SQLStore reads them from the database, and package memstore keeps them in memory for tests.
+type StarStore interface {
+	// EachGalaxyStar calls fn for every star belonging to galaxy, stopping at the first
+	// error from fn or the store.
+	EachGalaxyStar(ctx context.Context, galaxy galaxypkg.Galaxy, fn func(Star) error) error
+}
+
+// SQLStore is a StarStore backed by the stars table
+type SQLStore struct {
+	db *database.DB
+
+	// HealpixOrder is the HEALPix order of the stars table's healpix column. If it is more
+	// than 0, EachStarInBox looks up the pixels covering the box in the column's index too,
+	// which keeps searches fast on big tables. Leave it 0 if some stars have no pixel yet, or
+	// have one at another order; UseHealpix sets it only if they don't.
+	HealpixOrder int
+}
+
+// NewSQLStore returns a StarStore that reads from the stars table using db.
+func NewSQLStore(db *database.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// EachGalaxyStar calls fn for each row of the stars table with the given Galaxy.Id.
+func (store *SQLStore) EachGalaxyStar(ctx context.Context, galaxy galaxypkg.Galaxy, fn func(Star) error) error {
+	rows, err := store.db.QueryContext(ctx, store.db.Rebind("SELECT "+store.db.ColumnList(Star{})+" FROM stars WHERE galaxy_id = ?"), galaxy.Id)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
-	// Loop through rows, using Scan to assign column data to struct fields.
+	// Loop through rows, using ScanStruct to assign column data to struct fields.
 	for rows.Next() {
 		var star Star
-		if err := rows.Scan(&star.Id, &star.GalaxyId, &star.Name, &star.GaiaCatalogueId, &star.CreatedAt); err != nil {
+		if err := database.ScanStruct(rows, &star); err != nil {
+			return err
+		}
+		if err := fn(star); err != nil {
 			return err
 		}
-		star_channel <- star
 	}
 
-	if err := rows.Err(); err != nil {
-		return err
-	}
+	return rows.Err()
+}
+
+// GalaxyStarChannel takes a context, a StarStore and a Galaxy, and fills a channel of
+// Star structs for the given Galaxy from the store.
+// star_channel is always closed before GalaxyStarChannel returns, so callers running it in a
+// goroutine should range over star_channel and then collect the returned error, which
+// reports any query or scan failure. If ctx is cancelled, it stops sending and returns ctx.Err().
+func GalaxyStarChannel(ctx context.Context, store StarStore, galaxy galaxypkg.Galaxy, star_channel chan Star) error {
+	// Make sure the channels are closed when the method returns
+	defer close(star_channel)
 
-	return nil
+	return store.EachGalaxyStar(ctx, galaxy, func(star Star) error {
+		// Don't block forever if the consumer has gone away
+		select {
+		case star_channel <- star:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
 }
 
 // ValidateStar reports whether the two Stars have the same galaxy_id, ame, and email_address.
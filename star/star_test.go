@@ -1,10 +1,14 @@
-// Tests for GalaxyStarChannel
+// Tests for GalaxyStarChannel and SQLStore
 package star
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"testing"
 
+	"star-catalog/astro/coords"
 	"star-catalog/database"
 	"star-catalog/galaxy"
 )
@@ -15,7 +19,7 @@ func TestGalaxyStarChannel(t *testing.T) {
 	db := database.InitDB()
 	star_channel := make(chan Star)
 
-	galaxy1, err := galaxy.FindGalaxy(db, "ugc_number1")
+	galaxy1, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number1")
 	if err != nil {
 		t.Fatalf("GalaxyStarChannel: %v", err)
 	}
@@ -29,7 +33,7 @@ func TestGalaxyStarChannel(t *testing.T) {
 	error_channel := make(chan error)
 
 	go func() {
-		if err := GalaxyStarChannel(db, galaxy1, star_channel); err != nil {
+		if err := GalaxyStarChannel(context.Background(), NewSQLStore(db), galaxy1, star_channel); err != nil {
 			error_channel <- err
 		}
 	}()
@@ -58,7 +62,7 @@ func TestGalaxyStarChannelEmpty(t *testing.T) {
 
 	galaxy := galaxy.Galaxy{Id: 1, UgcNumber: "ugc_number1"}
 	star_channel := make(chan Star)
-	err := GalaxyStarChannel(db, galaxy, star_channel)
+	err := GalaxyStarChannel(context.Background(), NewSQLStore(db), galaxy, star_channel)
 
 	var want Star // null Star
 
@@ -73,3 +77,78 @@ func TestGalaxyStarChannelEmpty(t *testing.T) {
 		}
 	}
 }
+
+// TestGalaxyStarChannelCancelled calls star.GalaxyStarChannel with a cancelled context and
+// checks that it returns the cancellation error without blocking on star_channel
+func TestGalaxyStarChannelCancelled(t *testing.T) {
+	db := database.InitDB()
+	star_channel := make(chan Star)
+
+	galaxy1, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number1")
+	if err != nil {
+		t.Fatalf("GalaxyStarChannel: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing is read from star_channel, so this must return rather than block
+	err = GalaxyStarChannel(ctx, NewSQLStore(db), galaxy1, star_channel)
+
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf(`GalaxyStarChannel should return context.Canceled, is %v`, err)
+	}
+}
+
+// TestGalaxyStarChannelAstrometry checks that astrometry is read for the stars that have it,
+// and left nil for the stars that don't
+func TestGalaxyStarChannelAstrometry(t *testing.T) {
+	db := database.InitDB()
+	star_channel := make(chan Star)
+
+	galaxy1, err := galaxy.NewSQLStore(db).FindGalaxy(context.Background(), "ugc_number1")
+	if err != nil {
+		t.Fatalf("GalaxyStarChannel: %v", err)
+	}
+
+	go GalaxyStarChannel(context.Background(), NewSQLStore(db), galaxy1, star_channel)
+
+	stars := map[string]Star{}
+	for star := range star_channel {
+		stars[star.Name] = star
+	}
+
+	if sun := stars["Sun"]; sun.Ra != nil || sun.Parallax != nil || sun.PhotGMeanMag != nil {
+		t.Fatalf(`The Sun should have no astrometry, is %+v`, sun)
+	}
+
+	alpha := stars["Alpha Centauri"]
+	if alpha.Parallax == nil || *alpha.Parallax != 750.81 || alpha.Dec == nil || *alpha.Dec != -60.83562 {
+		t.Fatalf(`Alpha Centauri should have parallax 750.81 and dec -60.83562, is %+v`, alpha)
+	}
+	if alpha.PhotGMeanMag != nil {
+		t.Fatalf(`Alpha Centauri should have no G magnitude, is %v`, *alpha.PhotGMeanMag)
+	}
+}
+
+// TestStarPosition checks Alpha Centauri's Galactic position against SIMBAD, its ecliptic
+// latitude, and that a star without a position has none
+func TestStarPosition(t *testing.T) {
+	ra, dec := 219.90085, -60.83562
+	alpha := Star{Name: "Alpha Centauri", Ra: &ra, Dec: &dec}
+
+	l, b, ok := alpha.Galactic()
+	if !ok || math.Abs(l-315.73) > 0.01 || math.Abs(b+0.68) > 0.01 {
+		t.Fatalf(`Alpha Centauri should be at l 315.73, b -0.68, is %v, %v`, l, b)
+	}
+	if lon, lat, ok := alpha.Ecliptic(); !ok || math.Abs(lon-239.5) > 0.1 || math.Abs(lat+42.6) > 0.1 {
+		t.Fatalf(`Alpha Centauri should be at ecliptic 239.5, -42.6, is %v, %v`, lon, lat)
+	}
+	if lon, lat, ok := alpha.Position(coords.ICRS); !ok || lon != ra || lat != dec {
+		t.Fatalf(`Alpha Centauri's ICRS position should be its ra and dec, is %v, %v`, lon, lat)
+	}
+
+	if _, _, ok := (Star{Name: "Sun"}).Galactic(); ok {
+		t.Fatalf(`The Sun has no position, so should have no Galactic position`)
+	}
+}
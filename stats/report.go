@@ -0,0 +1,219 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"star-catalog/database"
+	starpkg "star-catalog/star"
+)
+
+// The formats a Report can be written in
+const (
+	Markdown = "markdown"
+	HTML     = "html"
+	JSON     = "json"
+)
+
+// reportFormats are the Report formats for each file extension
+var reportFormats = map[string]string{
+	".md":       Markdown,
+	".markdown": Markdown,
+	".html":     HTML,
+	".htm":      HTML,
+	".json":     JSON,
+}
+
+// A Report is the catalog's stats after a pipeline run, with totals across its galaxies.
+type Report struct {
+	GeneratedAt time.Time `json:"generated_at"`
+	Galaxies    int       `json:"galaxies"`
+	// EmptyGalaxies is the number of galaxies that had no stars
+	EmptyGalaxies int   `json:"empty_galaxies"`
+	Stars         int64 `json:"stars"`
+	MissingFields int64 `json:"missing_fields"`
+	// Missing counts the stars without each of the stars table's optional columns, in all
+	// galaxies
+	Missing     map[string]int64 `json:"missing"`
+	GalaxyStats []GalaxyStats    `json:"galaxy_stats"`
+}
+
+// NewReport returns the Report of stats, generated at generated_at.
+func NewReport(stats []GalaxyStats, generated_at time.Time) Report {
+	report := Report{GeneratedAt: generated_at, Galaxies: len(stats), Missing: map[string]int64{}, GalaxyStats: stats}
+	for _, galaxy_stats := range stats {
+		if galaxy_stats.StarCount == 0 {
+			report.EmptyGalaxies++
+		}
+		report.Stars += galaxy_stats.StarCount
+		report.MissingFields += galaxy_stats.MissingFields
+		for column, missing := range galaxy_stats.Missing {
+			report.Missing[column] += missing
+		}
+	}
+	return report
+}
+
+// ReportFormat returns the format of a report written to path, from its extension.
+func ReportFormat(path string) (string, error) {
+	format, ok := reportFormats[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("ReportFormat: %v is not a .md, .html or .json file", path)
+	}
+	return format, nil
+}
+
+// Write writes the report to w as Markdown, HTML or JSON.
+func (report Report) Write(w io.Writer, format string) error {
+	var err error
+	switch format {
+	case Markdown:
+		err = report.writeMarkdown(w)
+	case HTML:
+		err = htmlReport.Execute(w, report)
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	default:
+		return fmt.Errorf("Write: unknown report format %v", format)
+	}
+	if err != nil {
+		return fmt.Errorf("Write: %v", err)
+	}
+	return nil
+}
+
+// A MissingColumn counts the stars without a column
+type MissingColumn struct {
+	Column string
+	Stars  int64
+}
+
+// MissingColumns returns the counts of Missing that aren't 0, in the stars table's order.
+func (report Report) MissingColumns() []MissingColumn {
+	var columns []MissingColumn
+	for _, column := range database.Columns(starpkg.Star{}) {
+		if missing := report.Missing[column]; missing > 0 {
+			columns = append(columns, MissingColumn{Column: column, Stars: missing})
+		}
+	}
+	return columns
+}
+
+// Write the report as a Markdown document with a table of the galaxies
+func (report Report) writeMarkdown(w io.Writer) error {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "# Catalog report\n\nGenerated %v.\n\n", report.GeneratedAt.Format(time.RFC3339))
+	fmt.Fprintf(&builder, "- Galaxies: %v, %v without stars\n", report.Galaxies, report.EmptyGalaxies)
+	fmt.Fprintf(&builder, "- Stars: %v\n", report.Stars)
+	fmt.Fprintf(&builder, "- Missing values: %v\n", report.MissingFields)
+	for _, missing := range report.MissingColumns() {
+		fmt.Fprintf(&builder, "  - %v: %v stars\n", missing.Column, missing.Stars)
+	}
+
+	builder.WriteString("\n## Galaxies\n\n")
+	builder.WriteString("| Galaxy | UGC | Stars | G mag | Mean G | BP-RP | Mean parallax (mas) | RA (°) | Dec (°) | Missing values | G distribution |\n")
+	builder.WriteString("|---|---|--:|---|--:|---|--:|---|---|--:|---|\n")
+	for _, stats := range report.GalaxyStats {
+		fmt.Fprintf(&builder, "| %v | %v | %v | %v | %v | %v | %v | %v | %v | %v | %v |\n",
+			markdownEscape(stats.Name), markdownEscape(stats.UgcNumber), stats.StarCount,
+			formatRange(stats.GMagMin, stats.GMagMax, 2), formatValue(stats.GMagMean, 2),
+			formatRange(stats.BpRpMin, stats.BpRpMax, 2), formatValue(stats.MeanParallax, 3),
+			formatRaRange(stats.RaMin, stats.RaMax), formatRange(stats.DecMin, stats.DecMax, 4),
+			stats.MissingFields, formatHistogram(stats.GMagHistogram))
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// Escape the characters that would break a Markdown table cell
+func markdownEscape(text string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(text)
+}
+
+// Format an optional value, or "-" if there isn't one
+func formatValue(value *float64, decimals int) string {
+	if value == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.*f", decimals, *value)
+}
+
+// Format a range of optional values
+func formatRange(min *float64, max *float64, decimals int) string {
+	if min == nil || max == nil {
+		return "-"
+	}
+	return formatValue(min, decimals) + " to " + formatValue(max, decimals)
+}
+
+// Format a range of RAs, noting when it wraps around 0
+func formatRaRange(min *float64, max *float64) string {
+	text := formatRange(min, max, 4)
+	if min != nil && max != nil && *min > *max {
+		text += " (across 0)"
+	}
+	return text
+}
+
+// Format a histogram as each magnitude and its count of stars
+func formatHistogram(histogram []Bin) string {
+	if len(histogram) == 0 {
+		return "-"
+	}
+	bins := make([]string, len(histogram))
+	for i, bin := range histogram {
+		bins[i] = fmt.Sprintf("%v: %v", bin.Mag, bin.Stars)
+	}
+	return strings.Join(bins, ", ")
+}
+
+// htmlReport writes a Report as a standalone HTML page
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{
+	"value":     formatValue,
+	"between":   formatRange,
+	"ra":        formatRaRange,
+	"histogram": formatHistogram,
+	"time":      func(t time.Time) string { return t.Format(time.RFC3339) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Catalog report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.25em 0.5em; }
+td.number { text-align: right; }
+</style>
+</head>
+<body>
+<h1>Catalog report</h1>
+<p>Generated {{time .GeneratedAt}}.</p>
+<ul>
+<li>Galaxies: {{.Galaxies}}, {{.EmptyGalaxies}} without stars</li>
+<li>Stars: {{.Stars}}</li>
+<li>Missing values: {{.MissingFields}}{{with .MissingColumns}}
+<ul>
+{{- range .}}
+<li>{{.Column}}: {{.Stars}} stars</li>
+{{- end}}
+</ul>{{end}}</li>
+</ul>
+<h2>Galaxies</h2>
+<table>
+<tr><th>Galaxy</th><th>UGC</th><th>Stars</th><th>G mag</th><th>Mean G</th><th>BP-RP</th><th>Mean parallax (mas)</th><th>RA (°)</th><th>Dec (°)</th><th>Missing values</th><th>G distribution</th></tr>
+{{- range .GalaxyStats}}
+<tr><td>{{.Name}}</td><td>{{.UgcNumber}}</td><td class="number">{{.StarCount}}</td><td>{{between .GMagMin .GMagMax 2}}</td><td class="number">{{value .GMagMean 2}}</td><td>{{between .BpRpMin .BpRpMax 2}}</td><td class="number">{{value .MeanParallax 3}}</td><td>{{ra .RaMin .RaMax}}</td><td>{{between .DecMin .DecMax 4}}</td><td class="number">{{.MissingFields}}</td><td>{{histogram .GMagHistogram}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
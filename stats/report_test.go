@@ -0,0 +1,104 @@
+// Tests for NewReport, ReportFormat and Report.Write
+package stats
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Return a report of a galaxy straddling RA 0 and a galaxy without stars
+func testReport() Report {
+	g_min, g_max, g_mean, ra_min, ra_max, dec := 12.3, 13.7, 12.96, 359.5, 0.5, 2.0
+	stats := []GalaxyStats{
+		{
+			GalaxyId: 1, UgcNumber: "1", Name: "Wrapped <b>", StarCount: 3,
+			GMagMin: &g_min, GMagMax: &g_max, GMagMean: &g_mean,
+			RaMin: &ra_min, RaMax: &ra_max, DecMin: &dec, DecMax: &dec,
+			MissingFields: 5,
+			GMagHistogram: []Bin{{Mag: 12, Stars: 2}, {Mag: 13, Stars: 1}},
+			Missing:       map[string]int64{"parallax": 2, "ra": 3},
+		},
+		{GalaxyId: 2, UgcNumber: "2", Name: "Empty", Missing: map[string]int64{}},
+	}
+	return NewReport(stats, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+}
+
+// TestNewReport adds up the galaxies' stats
+func TestNewReport(t *testing.T) {
+	report := testReport()
+	if report.Galaxies != 2 || report.EmptyGalaxies != 1 || report.Stars != 3 || report.MissingFields != 5 {
+		t.Fatalf(`The report should have 2 galaxies, 1 empty, with 3 stars missing 5 values, is %+v`, report)
+	}
+	missing := report.MissingColumns()
+	if len(missing) != 2 || missing[0] != (MissingColumn{Column: "ra", Stars: 3}) || missing[1] != (MissingColumn{Column: "parallax", Stars: 2}) {
+		t.Fatalf(`The missing columns should be ra then parallax, in table order, are %v`, missing)
+	}
+}
+
+// TestReportFormat picks formats from file extensions
+func TestReportFormat(t *testing.T) {
+	for path, want := range map[string]string{"report.md": Markdown, "out/REPORT.HTML": HTML, "report.json": JSON} {
+		if format, err := ReportFormat(path); err != nil || format != want {
+			t.Fatalf(`ReportFormat(%q) should be %v, is %v, %v`, path, want, format, err)
+		}
+	}
+	if _, err := ReportFormat("report.txt"); err == nil {
+		t.Fatalf(`ReportFormat should fail for a .txt file`)
+	}
+}
+
+// TestWriteMarkdown checks the summary and the galaxies' rows
+func TestWriteMarkdown(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := testReport().Write(&buffer, Markdown); err != nil {
+		t.Fatalf(`Write %v`, err)
+	}
+	got := buffer.String()
+	for _, want := range []string{
+		"Generated 2024-03-01T12:00:00Z",
+		"- Stars: 3\n",
+		"  - ra: 3 stars\n",
+		"| Wrapped <b> | 1 | 3 | 12.30 to 13.70 | 12.96 | - | - | 359.5000 to 0.5000 (across 0) | 2.0000 to 2.0000 | 5 | 12: 2, 13: 1 |\n",
+		"| Empty | 2 | 0 | - | - | - | - | - | - | 0 | - |\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf(`The Markdown report should contain %q, is %v`, want, got)
+		}
+	}
+}
+
+// TestWriteHTML checks that names are escaped and values are formatted
+func TestWriteHTML(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := testReport().Write(&buffer, HTML); err != nil {
+		t.Fatalf(`Write %v`, err)
+	}
+	got := buffer.String()
+	for _, want := range []string{"<td>Wrapped &lt;b&gt;</td>", "<td>359.5000 to 0.5000 (across 0)</td>", "<li>parallax: 2 stars</li>"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf(`The HTML report should contain %q, is %v`, want, got)
+		}
+	}
+}
+
+// TestWriteJSON reads back the JSON report
+func TestWriteJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := testReport().Write(&buffer, JSON); err != nil {
+		t.Fatalf(`Write %v`, err)
+	}
+	var report Report
+	if err := json.Unmarshal(buffer.Bytes(), &report); err != nil {
+		t.Fatalf(`The JSON report should be readable, %v`, err)
+	}
+	if report.Stars != 3 || len(report.GalaxyStats) != 2 || *report.GalaxyStats[0].RaMin != 359.5 || report.GalaxyStats[1].GMagMin != nil || report.Missing["ra"] != 3 {
+		t.Fatalf(`The JSON report should match the report, is %+v`, report)
+	}
+
+	if err := testReport().Write(&buffer, "pdf"); err == nil {
+		t.Fatalf(`Write should fail for an unknown format`)
+	}
+}
@@ -0,0 +1,238 @@
+// Package stats gathers statistics about each galaxy's stars as the pipeline processes
+// them, for a view of the catalog's health after each run.
+// A Collector is a star.StarProcessor that keeps running totals per galaxy in bounded
+// memory: the number of stars, the range, mean and distribution of their G magnitudes, the
+// range of their BP-RP colours, their mean parallax, the box of sky they cover, and the
+// number of values they are missing. Save writes the results to the galaxy_stats table, and
+// Report renders them as Markdown, HTML or JSON.
+package stats
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+
+	"star-catalog/database"
+	galaxypkg "star-catalog/galaxy"
+	starpkg "star-catalog/star"
+)
+
+// GalaxyStats summarises the stars of one galaxy. The db tags name the galaxy_stats table's
+// columns, and the other fields are only in reports. Values are nil when none of the
+// galaxy's stars have them. RaMin is more than RaMax when the stars' box wraps around RA 0,
+// as for star.Box.
+type GalaxyStats struct {
+	GalaxyId      int64    `db:"galaxy_id" json:"galaxy_id"`
+	UgcNumber     string   `json:"ugc_number"`
+	Name          string   `json:"name"`
+	StarCount     int64    `db:"star_count" json:"star_count"`
+	GMagMin       *float64 `db:"g_mag_min" json:"g_mag_min"`
+	GMagMax       *float64 `db:"g_mag_max" json:"g_mag_max"`
+	GMagMean      *float64 `db:"g_mag_mean" json:"g_mag_mean"`
+	BpRpMin       *float64 `db:"bp_rp_min" json:"bp_rp_min"`
+	BpRpMax       *float64 `db:"bp_rp_max" json:"bp_rp_max"`
+	MeanParallax  *float64 `db:"mean_parallax" json:"mean_parallax"`
+	RaMin         *float64 `db:"ra_min" json:"ra_min"`
+	RaMax         *float64 `db:"ra_max" json:"ra_max"`
+	DecMin        *float64 `db:"dec_min" json:"dec_min"`
+	DecMax        *float64 `db:"dec_max" json:"dec_max"`
+	MissingFields int64    `db:"missing_fields" json:"missing_fields"`
+
+	// GMagHistogram counts the stars in each whole magnitude of G, brightest first
+	GMagHistogram []Bin `json:"g_mag_histogram"`
+	// Missing counts the stars without each of the stars table's optional columns
+	Missing map[string]int64 `json:"missing"`
+}
+
+// A Bin counts the stars with a G magnitude from Mag up to Mag + 1
+type Bin struct {
+	Mag   int   `json:"mag"`
+	Stars int64 `json:"stars"`
+}
+
+// A Collector is a StarProcessor that gathers the statistics of each galaxy's stars. It is
+// safe to use from the pipeline's goroutines at once.
+type Collector struct {
+	mutex    sync.Mutex
+	galaxies map[int64]*totals
+}
+
+// NewCollector returns an empty Collector.
+func NewCollector() *Collector {
+	return &Collector{galaxies: map[int64]*totals{}}
+}
+
+// Process adds star to the totals of galaxy.
+func (collector *Collector) Process(ctx context.Context, galaxy galaxypkg.Galaxy, star starpkg.Star) error {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	galaxy_totals, ok := collector.galaxies[galaxy.Id]
+	if !ok {
+		galaxy_totals = &totals{histogram: map[int]int64{}, missing: map[string]int64{}}
+		collector.galaxies[galaxy.Id] = galaxy_totals
+	}
+	galaxy_totals.add(star)
+	return nil
+}
+
+// Stats returns the statistics of every galaxy in store, in the store's order, including
+// galaxies that had no stars processed.
+func (collector *Collector) Stats(ctx context.Context, store galaxypkg.GalaxyStore) ([]GalaxyStats, error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	var all []GalaxyStats
+	err := store.EachGalaxy(ctx, func(galaxy galaxypkg.Galaxy) error {
+		stats := GalaxyStats{GalaxyId: galaxy.Id, UgcNumber: galaxy.UgcNumber, Name: galaxy.Name, Missing: map[string]int64{}}
+		if galaxy_totals, ok := collector.galaxies[galaxy.Id]; ok {
+			galaxy_totals.fill(&stats)
+		}
+		all = append(all, stats)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Stats: %w", err)
+	}
+	return all, nil
+}
+
+// Save replaces the rows of the galaxy_stats table with stats, in one transaction.
+func Save(ctx context.Context, db *database.DB, stats []GalaxyStats) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("Save: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM galaxy_stats"); err != nil {
+		return fmt.Errorf("Save: %v", err)
+	}
+	rows := make([]any, len(stats))
+	for i := range stats {
+		rows[i] = stats[i]
+	}
+	if err := db.InsertRowsTx(ctx, tx, "galaxy_stats", rows); err != nil {
+		return fmt.Errorf("Save: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Save: %v", err)
+	}
+	return nil
+}
+
+// totals are the running totals of one galaxy's stars
+type totals struct {
+	stars    int64
+	g_mag    span
+	bp_rp    span
+	parallax span
+	ra       span
+	// RAs from -180 up to 180, whose span is the smaller one for stars either side of RA 0
+	wrapped_ra span
+	dec        span
+	histogram  map[int]int64
+	missing    map[string]int64
+	missed     int64
+}
+
+// Add a star to the totals
+func (galaxy_totals *totals) add(star starpkg.Star) {
+	galaxy_totals.stars++
+
+	if star.PhotGMeanMag != nil {
+		galaxy_totals.g_mag.add(*star.PhotGMeanMag)
+		galaxy_totals.histogram[int(math.Floor(*star.PhotGMeanMag))]++
+	}
+	if bp_rp, ok := star.BpRp(); ok {
+		galaxy_totals.bp_rp.add(bp_rp)
+	}
+	if star.Parallax != nil {
+		galaxy_totals.parallax.add(*star.Parallax)
+	}
+	if star.Ra != nil && star.Dec != nil {
+		galaxy_totals.ra.add(*star.Ra)
+		galaxy_totals.wrapped_ra.add(math.Remainder(*star.Ra, 360))
+		galaxy_totals.dec.add(*star.Dec)
+	}
+
+	columns := database.Columns(star)
+	for i, value := range database.FieldValues(star) {
+		if reflected := reflect.ValueOf(value); reflected.Kind() == reflect.Pointer && reflected.IsNil() {
+			galaxy_totals.missing[columns[i]]++
+			galaxy_totals.missed++
+		}
+	}
+}
+
+// Fill in stats from the totals
+func (galaxy_totals *totals) fill(stats *GalaxyStats) {
+	stats.StarCount = galaxy_totals.stars
+	stats.GMagMin, stats.GMagMax, stats.GMagMean = galaxy_totals.g_mag.minimum(), galaxy_totals.g_mag.maximum(), galaxy_totals.g_mag.mean()
+	stats.BpRpMin, stats.BpRpMax = galaxy_totals.bp_rp.minimum(), galaxy_totals.bp_rp.maximum()
+	stats.MeanParallax = galaxy_totals.parallax.mean()
+	stats.DecMin, stats.DecMax = galaxy_totals.dec.minimum(), galaxy_totals.dec.maximum()
+
+	stats.RaMin, stats.RaMax = galaxy_totals.ra.minimum(), galaxy_totals.ra.maximum()
+	wrapped := galaxy_totals.wrapped_ra
+	if wrapped.count > 0 && wrapped.max-wrapped.min < galaxy_totals.ra.max-galaxy_totals.ra.min {
+		ra_min, ra_max := math.Mod(wrapped.min+360, 360), math.Mod(wrapped.max+360, 360)
+		stats.RaMin, stats.RaMax = &ra_min, &ra_max
+	}
+
+	for mag, stars := range galaxy_totals.histogram {
+		stats.GMagHistogram = append(stats.GMagHistogram, Bin{Mag: mag, Stars: stars})
+	}
+	sort.Slice(stats.GMagHistogram, func(i, j int) bool {
+		return stats.GMagHistogram[i].Mag < stats.GMagHistogram[j].Mag
+	})
+
+	for column, missing := range galaxy_totals.missing {
+		stats.Missing[column] = missing
+	}
+	stats.MissingFields = galaxy_totals.missed
+}
+
+// A span is the count, sum, minimum and maximum of some values
+type span struct {
+	count    int64
+	sum      float64
+	min, max float64
+}
+
+func (values *span) add(value float64) {
+	if values.count == 0 || value < values.min {
+		values.min = value
+	}
+	if values.count == 0 || value > values.max {
+		values.max = value
+	}
+	values.count++
+	values.sum += value
+}
+
+func (values span) minimum() *float64 {
+	if values.count == 0 {
+		return nil
+	}
+	return &values.min
+}
+
+func (values span) maximum() *float64 {
+	if values.count == 0 {
+		return nil
+	}
+	return &values.max
+}
+
+func (values span) mean() *float64 {
+	if values.count == 0 {
+		return nil
+	}
+	mean := values.sum / float64(values.count)
+	return &mean
+}
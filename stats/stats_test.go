@@ -0,0 +1,123 @@
+// Tests for Collector and Save
+package stats
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"star-catalog/database"
+	galaxypkg "star-catalog/galaxy"
+	"star-catalog/memstore"
+	starpkg "star-catalog/star"
+)
+
+// Return a star at ra, dec with a G magnitude, colour and parallax
+func starWith(name string, ra float64, dec float64, g float64, bp float64, rp float64, parallax float64) starpkg.Star {
+	return starpkg.Star{Name: name, Ra: &ra, Dec: &dec, PhotGMeanMag: &g, PhotBpMeanMag: &bp, PhotRpMeanMag: &rp, Parallax: &parallax}
+}
+
+// Process every star of store with collector
+func collect(t *testing.T, store *memstore.Store, collector *Collector) {
+	err := store.EachGalaxy(context.Background(), func(galaxy galaxypkg.Galaxy) error {
+		return store.EachGalaxyStar(context.Background(), galaxy, func(star starpkg.Star) error {
+			return collector.Process(context.Background(), galaxy, star)
+		})
+	})
+	if err != nil {
+		t.Fatalf(`collect %v`, err)
+	}
+}
+
+// TestCollector gathers the stats of a galaxy whose stars straddle RA 0, one with the stars
+// in a narrow box, and one without stars
+func TestCollector(t *testing.T) {
+	store := memstore.New()
+	wrapped := store.AddGalaxy(galaxypkg.Galaxy{UgcNumber: "1", Name: "Wrapped"})
+	narrow := store.AddGalaxy(galaxypkg.Galaxy{UgcNumber: "2", Name: "Narrow"})
+	store.AddGalaxy(galaxypkg.Galaxy{UgcNumber: "3", Name: "Empty"})
+
+	for _, star := range []starpkg.Star{
+		starWith("a", 359.5, -1, 12.3, 13, 11.5, 1),
+		starWith("b", 0.5, 2, 13.7, 14.5, 12.5, 3),
+		starWith("c", 0.25, 0, 12.9, 13.2, 12.4, 2),
+		{Name: "no data"},
+	} {
+		star.GalaxyId = wrapped
+		store.AddStar(star)
+	}
+	for _, star := range []starpkg.Star{starWith("d", 100, 10, 8.5, 9, 8, 0.5), starWith("e", 101, 11, 9.5, 10, 9, 1.5)} {
+		star.GalaxyId = narrow
+		store.AddStar(star)
+	}
+
+	collector := NewCollector()
+	collect(t, store, collector)
+	all, err := collector.Stats(context.Background(), store)
+	if err != nil || len(all) != 3 {
+		t.Fatalf(`Stats should have 3 galaxies, has %+v, %v`, all, err)
+	}
+
+	stats := all[0]
+	if stats.Name != "Wrapped" || stats.StarCount != 4 || *stats.GMagMin != 12.3 || *stats.GMagMax != 13.7 || math.Abs(*stats.GMagMean-12.9667) > 1e-4 {
+		t.Fatalf(`Wrapped should have 4 stars with G from 12.3 to 13.7, mean 12.97, is %+v`, stats)
+	}
+	if math.Abs(*stats.BpRpMin-0.8) > 1e-9 || math.Abs(*stats.BpRpMax-2) > 1e-9 || *stats.MeanParallax != 2 {
+		t.Fatalf(`Wrapped should have BP-RP from 0.8 to 2 and mean parallax 2, is %v %v %v`, *stats.BpRpMin, *stats.BpRpMax, *stats.MeanParallax)
+	}
+	if *stats.RaMin != 359.5 || *stats.RaMax != 0.5 || *stats.DecMin != -1 || *stats.DecMax != 2 {
+		t.Fatalf(`Wrapped should cover RA 359.5 across 0 to 0.5 and Dec -1 to 2, is %v %v %v %v`, *stats.RaMin, *stats.RaMax, *stats.DecMin, *stats.DecMax)
+	}
+	if len(stats.GMagHistogram) != 2 || stats.GMagHistogram[0] != (Bin{Mag: 12, Stars: 2}) || stats.GMagHistogram[1] != (Bin{Mag: 13, Stars: 1}) {
+		t.Fatalf(`Wrapped should have 2 stars of G 12 and 1 of 13, is %v`, stats.GMagHistogram)
+	}
+	if stats.Missing["ra"] != 1 || stats.Missing["phot_g_mean_mag"] != 1 || stats.Missing["parallax_error"] != 4 || stats.Missing["name"] != 0 {
+		t.Fatalf(`Wrapped should miss one position and 4 parallax errors, is %v`, stats.Missing)
+	}
+	if stats.MissingFields < 4 || stats.MissingFields <= all[1].MissingFields {
+		t.Fatalf(`Wrapped should be missing more fields than Narrow, is %v and %v`, stats.MissingFields, all[1].MissingFields)
+	}
+
+	if stats := all[1]; *stats.RaMin != 100 || *stats.RaMax != 101 || *stats.MeanParallax != 1 {
+		t.Fatalf(`Narrow should cover RA 100 to 101 with mean parallax 1, is %+v`, stats)
+	}
+
+	if stats := all[2]; stats.Name != "Empty" || stats.StarCount != 0 || stats.GMagMin != nil || stats.RaMin != nil || stats.MissingFields != 0 {
+		t.Fatalf(`Empty should have no stars and no values, is %+v`, stats)
+	}
+}
+
+// TestSave saves the stats of the fixture galaxies twice, and checks the rows are replaced
+func TestSave(t *testing.T) {
+	db := database.InitDB()
+	defer db.Close()
+
+	collector := NewCollector()
+	galaxies := galaxypkg.NewSQLStore(db)
+	stars := starpkg.NewSQLStore(db)
+	err := galaxies.EachGalaxy(context.Background(), func(galaxy galaxypkg.Galaxy) error {
+		return stars.EachGalaxyStar(context.Background(), galaxy, func(star starpkg.Star) error {
+			return collector.Process(context.Background(), galaxy, star)
+		})
+	})
+	if err != nil {
+		t.Fatalf(`Processing the fixtures %v`, err)
+	}
+
+	all, err := collector.Stats(context.Background(), galaxies)
+	if err != nil {
+		t.Fatalf(`Stats %v`, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := Save(context.Background(), db, all); err != nil {
+			t.Fatalf(`Save %v`, err)
+		}
+	}
+
+	var rows, star_count int
+	var g_mag_max float64
+	err = db.QueryRow("SELECT COUNT(*), SUM(star_count), MAX(g_mag_max) FROM galaxy_stats").Scan(&rows, &star_count, &g_mag_max)
+	if err != nil || rows != 2 || star_count != 5 || g_mag_max != 21 {
+		t.Fatalf(`galaxy_stats should have 2 galaxies with 5 stars, the faintest of G 21, has %v %v %v, %v`, rows, star_count, g_mag_max, err)
+	}
+}
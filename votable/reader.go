@@ -0,0 +1,488 @@
+package votable
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+)
+
+// A Reader reads the rows of the first table in a VOTable document.
+// Rows are read from the XML as they are needed, whether they are TABLEDATA or a BINARY2
+// stream, so tables of any size are read in constant memory.
+type Reader struct {
+	decoder *xml.Decoder
+	fields  []Field
+
+	// The decoded BINARY2 stream, or nil for TABLEDATA
+	binary *bufio.Reader
+}
+
+// NewReader reads the VOTable header from r, up to the start of the first table's data.
+// It fails if the data isn't TABLEDATA or BINARY2, or if a field is an array of anything
+// other than characters.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{decoder: xml.NewDecoder(r)}
+
+	in_table := false
+	for {
+		token, err := reader.decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("NewReader: no table data found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("NewReader: %v", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "TABLE":
+			in_table = true
+		case "FIELD":
+			if !in_table {
+				continue
+			}
+			var field Field
+			if err := reader.decoder.DecodeElement(&field, &start); err != nil {
+				return nil, fmt.Errorf("NewReader: %v", err)
+			}
+			if err := checkField(field); err != nil {
+				return nil, fmt.Errorf("NewReader: %v", err)
+			}
+			reader.fields = append(reader.fields, field)
+		case "TABLEDATA":
+			return reader, nil
+		case "BINARY2":
+			if err := reader.readStream(); err != nil {
+				return nil, fmt.Errorf("NewReader: %v", err)
+			}
+			return reader, nil
+		case "BINARY", "FITS":
+			return nil, fmt.Errorf("NewReader: %s serialization isn't supported", start.Name.Local)
+		}
+	}
+}
+
+// Fields returns the fields of the table, in column order.
+func (reader *Reader) Fields() []Field {
+	return reader.fields
+}
+
+// Next returns the values of the next row, one for each field, or io.EOF after the last row.
+// Values are int64 for integer datatypes, float64 for floating point, bool for boolean,
+// and string for characters. Nulls, and NaN floats, are nil.
+func (reader *Reader) Next() ([]any, error) {
+	if reader.binary != nil {
+		return reader.nextBinary2()
+	}
+	return reader.nextTableData()
+}
+
+// Decode reads the next row into the db tagged fields of dest, a pointer to a struct such as
+// a star.Star, matching fields to columns by name. Columns without a matching struct field,
+// and struct fields without a matching column, are skipped. Null values leave pointer
+// fields nil and other fields at their zero value. Returns io.EOF after the last row.
+func (reader *Reader) Decode(dest any) error {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("Decode: dest must be a pointer to a struct, is %T", dest)
+	}
+	value = value.Elem()
+
+	row, err := reader.Next()
+	if err != nil {
+		return err
+	}
+
+	indexes := fieldIndexes(value.Type())
+	for i, field := range reader.fields {
+		index, ok := indexes[field.Name]
+		if !ok {
+			continue
+		}
+		if err := setField(value.Field(index), row[i]); err != nil {
+			return fmt.Errorf("Decode %s: %v", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Read the next TR element
+func (reader *Reader) nextTableData() ([]any, error) {
+	var cells []string
+	in_row := false
+	var cell *strings.Builder
+
+	for {
+		token, err := reader.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "TR":
+				in_row = true
+			case "TD":
+				cell = &strings.Builder{}
+			}
+		case xml.CharData:
+			if cell != nil {
+				cell.Write(token)
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "TD":
+				cells = append(cells, cell.String())
+				cell = nil
+			case "TR":
+				return reader.parseCells(cells)
+			case "TABLEDATA":
+				if !in_row {
+					return nil, io.EOF
+				}
+			}
+		}
+	}
+}
+
+// Convert the text of each TD to a value
+func (reader *Reader) parseCells(cells []string) ([]any, error) {
+	if len(cells) != len(reader.fields) {
+		return nil, fmt.Errorf("row has %d cells for %d fields", len(cells), len(reader.fields))
+	}
+
+	row := make([]any, len(cells))
+	for i, text := range cells {
+		field := reader.fields[i]
+		// An empty cell is null, whatever its type
+		if isChar(field) {
+			if text != "" {
+				row[i] = text
+			}
+			continue
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" || (field.Values != nil && text == field.Values.Null) {
+			continue
+		}
+
+		var err error
+		switch field.Datatype {
+		case "boolean":
+			switch strings.ToLower(text) {
+			case "t", "true", "1":
+				row[i] = true
+			case "f", "false", "0":
+				row[i] = false
+			}
+		case "unsignedByte", "short", "int", "long":
+			row[i], err = strconv.ParseInt(text, 0, 64)
+		case "float", "double":
+			var f float64
+			f, err = strconv.ParseFloat(text, 64)
+			if !math.IsNaN(f) {
+				row[i] = f
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", field.Name, err)
+		}
+	}
+
+	return row, nil
+}
+
+// Find the STREAM element inside BINARY2, and decode its base64 text as it is read
+func (reader *Reader) readStream() error {
+	for {
+		token, err := reader.decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if token.Name.Local != "STREAM" {
+				continue
+			}
+			for _, attr := range token.Attr {
+				if attr.Name.Local == "href" {
+					return errors.New("STREAMs in other files aren't supported")
+				}
+			}
+			text := &streamText{decoder: reader.decoder}
+			reader.binary = bufio.NewReader(base64.NewDecoder(base64.StdEncoding, text))
+			return nil
+		case xml.EndElement:
+			if token.Name.Local == "BINARY2" {
+				return errors.New("BINARY2 has no STREAM")
+			}
+		}
+	}
+}
+
+// Read the next row from the BINARY2 stream: a bitmap of nulls, then each value
+func (reader *Reader) nextBinary2() ([]any, error) {
+	if _, err := reader.binary.Peek(1); err != nil {
+		return nil, err
+	}
+
+	nulls := make([]byte, (len(reader.fields)+7)/8)
+	if _, err := io.ReadFull(reader.binary, nulls); err != nil {
+		return nil, err
+	}
+
+	row := make([]any, len(reader.fields))
+	for i, field := range reader.fields {
+		value, err := readBinary(reader.binary, field)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %v", field.Name, err)
+		}
+		if nulls[i/8]&(0x80>>(i%8)) == 0 {
+			row[i] = value
+		}
+	}
+
+	return row, nil
+}
+
+// streamText reads the base64 text of a STREAM element from the XML a token at a time,
+// leaving out the whitespace the text is broken into lines with, which base64 doesn't
+// accept. It returns io.EOF at the end of the STREAM.
+type streamText struct {
+	decoder *xml.Decoder
+	pending []byte
+	done    bool
+}
+
+func (text *streamText) Read(p []byte) (int, error) {
+	for len(text.pending) == 0 {
+		if text.done {
+			return 0, io.EOF
+		}
+		token, err := text.decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		switch token := token.(type) {
+		case xml.CharData:
+			// bytes.Map copies the text, which is only valid until the next token is read
+			text.pending = bytes.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return -1
+				}
+				return r
+			}, token)
+		case xml.EndElement:
+			if token.Name.Local == "STREAM" {
+				text.done = true
+			}
+		}
+	}
+
+	n := copy(p, text.pending)
+	text.pending = text.pending[n:]
+	return n, nil
+}
+
+// Read one big-endian value of field's datatype
+func readBinary(r io.Reader, field Field) (any, error) {
+	if isChar(field) {
+		return readChars(r, field)
+	}
+
+	switch field.Datatype {
+	case "boolean":
+		var b byte
+		err := binary.Read(r, binary.BigEndian, &b)
+		switch b {
+		case 'T', 't', '1':
+			return true, err
+		case 'F', 'f', '0':
+			return false, err
+		}
+		return nil, err
+	case "unsignedByte":
+		var n uint8
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int64(n), err
+	case "short":
+		var n int16
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int64(n), err
+	case "int":
+		var n int32
+		err := binary.Read(r, binary.BigEndian, &n)
+		return int64(n), err
+	case "long":
+		var n int64
+		err := binary.Read(r, binary.BigEndian, &n)
+		return n, err
+	case "float":
+		var f float32
+		err := binary.Read(r, binary.BigEndian, &f)
+		return nanToNil(float64(f)), err
+	case "double":
+		var f float64
+		err := binary.Read(r, binary.BigEndian, &f)
+		return nanToNil(f), err
+	}
+
+	return nil, fmt.Errorf("reading %s isn't supported", field.Datatype)
+}
+
+// Read a char or unicodeChar value: a fixed number of characters, or a length followed by
+// that many characters. Fixed length strings are padded with NULs, which are removed.
+func readChars(r io.Reader, field Field) (any, error) {
+	length := 1
+	if field.Arraysize != "" && !strings.HasSuffix(field.Arraysize, "*") {
+		length, _ = strconv.Atoi(field.Arraysize)
+	} else if field.Arraysize != "" {
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		length = int(n)
+	}
+
+	if field.Datatype == "unicodeChar" {
+		units := make([]uint16, length)
+		if err := binary.Read(r, binary.BigEndian, units); err != nil {
+			return nil, err
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00"), nil
+	}
+
+	chars := make([]byte, length)
+	if _, err := io.ReadFull(r, chars); err != nil {
+		return nil, err
+	}
+	return strings.TrimRight(string(chars), "\x00"), nil
+}
+
+// Report whether a field holds a string
+func isChar(field Field) bool {
+	return field.Datatype == "char" || field.Datatype == "unicodeChar"
+}
+
+// Check that a field is one this package can read: a scalar, or a string of characters
+func checkField(field Field) error {
+	switch field.Datatype {
+	case "boolean", "unsignedByte", "short", "int", "long", "float", "double", "char", "unicodeChar":
+	default:
+		return fmt.Errorf("field %s: %s isn't supported", field.Name, field.Datatype)
+	}
+
+	if field.Arraysize == "" || field.Arraysize == "1" {
+		return nil
+	}
+	if !isChar(field) {
+		return fmt.Errorf("field %s: arrays of %s aren't supported", field.Name, field.Datatype)
+	}
+	if strings.Contains(field.Arraysize, "x") {
+		return fmt.Errorf("field %s: multidimensional arrays aren't supported", field.Name)
+	}
+	if !strings.HasSuffix(field.Arraysize, "*") {
+		if n, err := strconv.Atoi(field.Arraysize); err != nil || n < 0 {
+			return fmt.Errorf("field %s: bad arraysize %q", field.Name, field.Arraysize)
+		}
+	}
+	return nil
+}
+
+// NaN is how VOTable writes a null float
+func nanToNil(f float64) any {
+	if math.IsNaN(f) {
+		return nil
+	}
+	return f
+}
+
+// Set a struct field to a value read from a row, converting between numeric types and
+// parsing timestamps
+func setField(field reflect.Value, value any) error {
+	if value == nil {
+		field.SetZero()
+		return nil
+	}
+
+	if field.Kind() == reflect.Pointer {
+		target := reflect.New(field.Type().Elem())
+		if err := setField(target.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(target)
+		return nil
+	}
+
+	switch value := value.(type) {
+	case int64:
+		switch {
+		case field.CanInt():
+			field.SetInt(value)
+			return nil
+		case field.CanFloat():
+			field.SetFloat(float64(value))
+			return nil
+		case field.Kind() == reflect.String:
+			field.SetString(strconv.FormatInt(value, 10))
+			return nil
+		}
+	case float64:
+		if field.CanFloat() {
+			field.SetFloat(value)
+			return nil
+		}
+	case bool:
+		if field.Kind() == reflect.Bool {
+			field.SetBool(value)
+			return nil
+		}
+	case string:
+		if field.Kind() == reflect.String {
+			field.SetString(value)
+			return nil
+		}
+		if field.Type() == reflect.TypeOf(time.Time{}) {
+			if value == "" {
+				field.SetZero()
+				return nil
+			}
+			parsed, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				// Timestamps without a time zone, as TOPCAT writes them
+				parsed, err = time.Parse("2006-01-02T15:04:05.999999999", value)
+			}
+			if err != nil {
+				return err
+			}
+			field.Set(reflect.ValueOf(parsed))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("can't put %T in %s", value, field.Type())
+}
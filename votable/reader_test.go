@@ -0,0 +1,155 @@
+// Tests for Reader, with VOTables written the way other tools write them
+package votable
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"star-catalog/star"
+)
+
+// gaiaHeader is the start of a VOTable like a Gaia archive query result, with columns that
+// aren't in Star, a null value for an int column, and a fixed length string
+const gaiaHeader = `<?xml version="1.0" encoding="UTF-8"?>
+<VOTABLE version="1.4" xmlns="http://www.ivoa.net/xml/VOTable/v1.3">
+<RESOURCE type="results">
+<INFO name="QUERY_STATUS" value="OK"/>
+<TABLE name="result">
+<DESCRIPTION>Gaia DR3 sources</DESCRIPTION>
+<FIELD name="source_id" datatype="long" ucd="meta.id;meta.main"/>
+<FIELD name="name" datatype="char" arraysize="12"/>
+<FIELD name="ra" datatype="double" unit="deg" ucd="pos.eq.ra;meta.main"/>
+<FIELD name="parallax" datatype="float" unit="mas"/>
+<FIELD name="phot_variable_flag" datatype="boolean"/>
+<FIELD name="ruwe_flag" datatype="int"><VALUES null="-1"/></FIELD>
+<FIELD name="comment" datatype="unicodeChar" arraysize="*"/>
+<DATA>`
+
+// TestReaderTableData reads TABLEDATA rows, checking the values and nulls
+func TestReaderTableData(t *testing.T) {
+	document := gaiaHeader + `<TABLEDATA>
+<TR><TD>4295806720</TD><TD>Star A</TD><TD>10.68</TD><TD>0.25</TD><TD>T</TD><TD>-1</TD><TD>café</TD></TR>
+<TR><TD>4295806721</TD><TD/><TD> 10.70 </TD><TD>NaN</TD><TD/><TD>3</TD><TD></TD></TR>
+</TABLEDATA></DATA></TABLE></RESOURCE></VOTABLE>`
+
+	reader, err := NewReader(strings.NewReader(document))
+	if err != nil {
+		t.Fatalf(`NewReader %v`, err)
+	}
+	if len(reader.Fields()) != 7 || reader.Fields()[2].Unit != "deg" {
+		t.Fatalf(`Fields should be the 7 fields, is %+v`, reader.Fields())
+	}
+
+	want := [][]any{
+		{int64(4295806720), "Star A", 10.68, 0.25, true, nil, "café"},
+		{int64(4295806721), nil, 10.70, nil, nil, int64(3), nil},
+	}
+	for _, want_row := range want {
+		row, err := reader.Next()
+		if err != nil || !reflect.DeepEqual(row, want_row) {
+			t.Fatalf(`Next should return %v, is %v, %v`, want_row, row, err)
+		}
+	}
+	if _, err := reader.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf(`Next should return io.EOF after the last row, is %v`, err)
+	}
+}
+
+// TestReaderBinary2 reads the same kind of table as BINARY2, and decodes it into a Star
+func TestReaderBinary2(t *testing.T) {
+	var row bytes.Buffer
+	row.Write([]byte{0b00010000}) // phot_variable_flag is null
+	binary.Write(&row, binary.BigEndian, int64(4295806720))
+	row.WriteString("Star A\x00\x00\x00\x00\x00\x00")
+	binary.Write(&row, binary.BigEndian, 10.68)
+	binary.Write(&row, binary.BigEndian, float32(math.NaN()))
+	row.WriteByte('?')
+	binary.Write(&row, binary.BigEndian, int32(2))
+	binary.Write(&row, binary.BigEndian, uint32(2))
+	binary.Write(&row, binary.BigEndian, []uint16{'h', 'i'})
+
+	// Break the base64 into lines, as tools do
+	encoded := base64.StdEncoding.EncodeToString(row.Bytes())
+	document := gaiaHeader + `<BINARY2><STREAM encoding="base64">` + "\n" +
+		encoded[:20] + "\n" + encoded[20:] + "\n</STREAM></BINARY2></DATA></TABLE></RESOURCE></VOTABLE>"
+
+	reader, err := NewReader(strings.NewReader(document))
+	if err != nil {
+		t.Fatalf(`NewReader %v`, err)
+	}
+
+	var got star.Star
+	if err := reader.Decode(&got); err != nil {
+		t.Fatalf(`Decode %v`, err)
+	}
+	if got.Name != "Star A" || got.Ra == nil || *got.Ra != 10.68 || got.Parallax != nil {
+		t.Fatalf(`Decode should read Star A at ra 10.68 with no parallax, is %+v`, got)
+	}
+
+	if err := reader.Decode(&got); !errors.Is(err, io.EOF) {
+		t.Fatalf(`Decode should return io.EOF after the last row, is %v`, err)
+	}
+}
+
+// TestReaderBinary2Streams reads the first rows of a BINARY2 stream that is cut off part
+// way, which only works if rows are decoded as they are read, and checks that the cut is an
+// error and not the end of the table
+func TestReaderBinary2Streams(t *testing.T) {
+	header := `<VOTABLE><RESOURCE><TABLE><FIELD name="source_id" datatype="long"/><DATA><BINARY2><STREAM encoding="base64">`
+
+	var rows bytes.Buffer
+	for i := 0; i < 1000; i++ {
+		rows.WriteByte(0)
+		binary.Write(&rows, binary.BigEndian, int64(i))
+	}
+	encoded := base64.StdEncoding.EncodeToString(rows.Bytes())
+	var lines strings.Builder
+	for len(encoded) > 76 {
+		lines.WriteString(encoded[:76] + "\n\t")
+		encoded = encoded[76:]
+	}
+
+	reader, err := NewReader(strings.NewReader(header + "\n" + lines.String()[:lines.Len()/2]))
+	if err != nil {
+		t.Fatalf(`NewReader %v`, err)
+	}
+	for i := 0; i < 10; i++ {
+		row, err := reader.Next()
+		if err != nil || row[0] != int64(i) {
+			t.Fatalf(`Next should return row %d, is %v, %v`, i, row, err)
+		}
+	}
+	for {
+		_, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			t.Fatalf(`A stream that is cut off should not end with io.EOF`)
+		}
+		if err != nil {
+			break
+		}
+	}
+}
+
+// TestReaderUnsupported checks that tables the reader can't read are refused
+func TestReaderUnsupported(t *testing.T) {
+	tests := map[string]string{
+		"arrays of double":   `<TABLE><FIELD name="pm" datatype="double" arraysize="2"/><DATA><TABLEDATA/></DATA></TABLE>`,
+		"FITS serialization": `<TABLE><FIELD name="ra" datatype="double"/><DATA><FITS/></DATA></TABLE>`,
+		"no table data":      `<TABLE><FIELD name="ra" datatype="double"/></TABLE>`,
+		"other files":        `<TABLE><FIELD name="ra" datatype="double"/><DATA><BINARY2><STREAM href="rows.bin"/></BINARY2></DATA></TABLE>`,
+	}
+
+	for want, document := range tests {
+		_, err := NewReader(strings.NewReader("<VOTABLE><RESOURCE>" + document + "</RESOURCE></VOTABLE>"))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf(`NewReader should fail with %s, is %v`, want, err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Package votable reads and writes IVOA VOTable XML, the table format used by astronomy
+// tools such as TOPCAT, Aladin and astropy.
+// A Writer writes rows in either TABLEDATA or BINARY2 serialization, and a Reader reads
+// them back one row at a time. Rows are usually structs such as star.Star and
+// galaxy.Galaxy: columns are named by their db tags, and described by their ucd and unit
+// tags, so FieldsOf, Writer.WriteStruct and Reader.Decode work with any tagged struct.
+// Only scalar values and character strings are supported, which covers both of those.
+// See https://www.ivoa.net/documents/VOTable/ for the format.
+package votable
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// A Serialization is the way a table's rows are encoded in the DATA element.
+type Serialization string
+
+const (
+	// TableData writes each value as text in a TD element. It is readable, and streams.
+	TableData Serialization = "TABLEDATA"
+	// Binary2 writes rows as base64 encoded big-endian binary, with a bitmap of nulls.
+	// It is smaller, and keeps floating point values exactly.
+	Binary2 Serialization = "BINARY2"
+)
+
+// namespace is the XML namespace of VOTable 1.3 and 1.4
+const namespace = "http://www.ivoa.net/xml/VOTable/v1.3"
+
+// A Field describes a column of a table, as a FIELD element.
+type Field struct {
+	Name      string `xml:"name,attr"`
+	ID        string `xml:"ID,attr,omitempty"`
+	Datatype  string `xml:"datatype,attr"`
+	Arraysize string `xml:"arraysize,attr,omitempty"`
+	Unit      string `xml:"unit,attr,omitempty"`
+	UCD       string `xml:"ucd,attr,omitempty"`
+	Xtype     string `xml:"xtype,attr,omitempty"`
+	Values    *struct {
+		Null string `xml:"null,attr"`
+	} `xml:"VALUES"`
+}
+
+// FieldsOf returns a Field for each db tagged field of v, which is a struct or a pointer to
+// one, in field order. The ucd and unit tags give the Field's UCD and Unit, and the datatype
+// follows the Go type: integers are long, floats double, strings char and bools boolean.
+// time.Time is written as an ISO 8601 timestamp string.
+func FieldsOf(v any) ([]Field, error) {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("FieldsOf: %T is not a struct", v)
+	}
+
+	var fields []Field
+	for i := 0; i < t.NumField(); i++ {
+		struct_field := t.Field(i)
+		name, ok := struct_field.Tag.Lookup("db")
+		if !ok || name == "-" {
+			continue
+		}
+
+		field := Field{Name: name, UCD: struct_field.Tag.Get("ucd"), Unit: struct_field.Tag.Get("unit")}
+
+		field_type := struct_field.Type
+		if field_type.Kind() == reflect.Pointer {
+			field_type = field_type.Elem()
+		}
+		switch {
+		case field_type == reflect.TypeOf(time.Time{}):
+			field.Datatype, field.Arraysize, field.Xtype = "char", "*", "timestamp"
+		case field_type.Kind() == reflect.String:
+			field.Datatype, field.Arraysize = "char", "*"
+		case field_type.Kind() == reflect.Bool:
+			field.Datatype = "boolean"
+		case field_type.Kind() >= reflect.Int && field_type.Kind() <= reflect.Int64:
+			field.Datatype = "long"
+		case field_type.Kind() == reflect.Float32 || field_type.Kind() == reflect.Float64:
+			field.Datatype = "double"
+		default:
+			return nil, fmt.Errorf("FieldsOf: %s has unsupported type %s", name, struct_field.Type)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+// Find the db tagged fields of a struct type by column name, as indexes for Value.Field
+func fieldIndexes(t reflect.Type) map[string]int {
+	indexes := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := t.Field(i).Tag.Lookup("db"); ok && name != "-" {
+			indexes[name] = i
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,67 @@
+// Tests for FieldsOf
+package votable
+
+import (
+	"testing"
+
+	"star-catalog/galaxy"
+	"star-catalog/star"
+)
+
+// TestFieldsOfStar checks the datatypes, units and UCDs of the Star fields
+func TestFieldsOfStar(t *testing.T) {
+	fields, err := FieldsOf(star.Star{})
+	if err != nil {
+		t.Fatalf(`FieldsOf %v`, err)
+	}
+
+	by_name := map[string]Field{}
+	for _, field := range fields {
+		by_name[field.Name] = field
+	}
+
+	tests := []Field{
+		{Name: "id", Datatype: "long", UCD: "meta.id"},
+		{Name: "name", Datatype: "char", Arraysize: "*", UCD: "meta.id;meta.main"},
+		{Name: "created_at", Datatype: "char", Arraysize: "*", UCD: "time.creation", Xtype: "timestamp"},
+		{Name: "ra", Datatype: "double", Unit: "deg", UCD: "pos.eq.ra;meta.main"},
+		{Name: "pmdec", Datatype: "double", Unit: "mas/yr", UCD: "pos.pm;pos.eq.dec"},
+	}
+	for _, want := range tests {
+		if got := by_name[want.Name]; got != want {
+			t.Fatalf(`Field %s should be %+v, is %+v`, want.Name, want, got)
+		}
+	}
+
+	if len(fields) != 15 {
+		t.Fatalf(`Star should have %d fields, has %d`, 15, len(fields))
+	}
+}
+
+// TestFieldsOfGalaxy checks that every Galaxy field has a UCD
+func TestFieldsOfGalaxy(t *testing.T) {
+	fields, err := FieldsOf(&galaxy.Galaxy{})
+	if err != nil {
+		t.Fatalf(`FieldsOf %v`, err)
+	}
+
+	for _, field := range fields {
+		if field.UCD == "" {
+			t.Fatalf(`Field %s should have a UCD`, field.Name)
+		}
+	}
+}
+
+// TestFieldsOfUnsupported checks that types VOTable can't hold are refused
+func TestFieldsOfUnsupported(t *testing.T) {
+	type row struct {
+		Values []float64 `db:"values"`
+	}
+
+	if _, err := FieldsOf(row{}); err == nil {
+		t.Fatalf(`FieldsOf should refuse a slice field`)
+	}
+	if _, err := FieldsOf(42); err == nil {
+		t.Fatalf(`FieldsOf should refuse a non-struct`)
+	}
+}
@@ -0,0 +1,283 @@
+package votable
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Writer writes a VOTable with one table, a row at a time, so tables of any size can be
+// written without holding them in memory. Close must be called to finish the document.
+type Writer struct {
+	writer        *bufio.Writer
+	fields        []Field
+	serialization Serialization
+
+	// BINARY2 rows are written through base64 into the STREAM element
+	stream io.WriteCloser
+	row    []byte
+}
+
+// NewWriter starts a VOTable document on w, with a table of the given name and fields.
+func NewWriter(w io.Writer, name string, fields []Field, serialization Serialization) (*Writer, error) {
+	if serialization != TableData && serialization != Binary2 {
+		return nil, fmt.Errorf("NewWriter: unknown serialization %q", serialization)
+	}
+	// These are the datatypes FieldsOf uses
+	for _, field := range fields {
+		switch {
+		case field.Datatype != "char" && field.Datatype != "boolean" && field.Datatype != "long" && field.Datatype != "double":
+			return nil, fmt.Errorf("NewWriter: field %s: writing %s isn't supported", field.Name, field.Datatype)
+		case field.Arraysize != "" && (field.Datatype != "char" || field.Arraysize != "*"):
+			return nil, fmt.Errorf("NewWriter: field %s: only variable length char arrays are supported", field.Name)
+		}
+	}
+
+	writer := &Writer{writer: bufio.NewWriter(w), fields: fields, serialization: serialization}
+
+	writer.writer.WriteString(xml.Header)
+	writer.writer.WriteString(`<VOTABLE version="1.4" xmlns="` + namespace + `">` + "\n")
+	writer.writer.WriteString(`<RESOURCE type="results">` + "\n")
+	writer.writer.WriteString(`<TABLE name="` + escape(name) + `">` + "\n")
+	for _, field := range fields {
+		encoded, err := xml.Marshal(struct {
+			XMLName xml.Name `xml:"FIELD"`
+			Field
+		}{Field: field})
+		if err != nil {
+			return nil, fmt.Errorf("NewWriter: %v", err)
+		}
+		writer.writer.Write(encoded)
+		writer.writer.WriteString("\n")
+	}
+
+	if serialization == TableData {
+		writer.writer.WriteString("<DATA><TABLEDATA>\n")
+	} else {
+		writer.writer.WriteString("<DATA><BINARY2><STREAM encoding=\"base64\">\n")
+		writer.stream = base64.NewEncoder(base64.StdEncoding, &lineWriter{writer: writer.writer})
+	}
+
+	return writer, nil
+}
+
+// WriteStruct writes a row with the values of the db tagged fields of v, which is a struct
+// or a pointer to one, such as a star.Star. Its fields should be the ones FieldsOf returns.
+func (writer *Writer) WriteStruct(v any) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	indexes := fieldIndexes(value.Type())
+
+	values := make([]any, len(writer.fields))
+	for i, field := range writer.fields {
+		index, ok := indexes[field.Name]
+		if !ok {
+			return fmt.Errorf("WriteStruct: %T has no %s field", v, field.Name)
+		}
+		values[i] = value.Field(index).Interface()
+	}
+
+	return writer.WriteRow(values...)
+}
+
+// WriteRow writes a row with one value for each field. Values can be integers, floats,
+// strings, bools or time.Time, or pointers to them; nil and nil pointers are written as null.
+func (writer *Writer) WriteRow(values ...any) error {
+	if len(values) != len(writer.fields) {
+		return fmt.Errorf("WriteRow: %d values for %d fields", len(values), len(writer.fields))
+	}
+
+	// Take the values out of any pointers, leaving nil for null, without changing the caller's slice
+	values = slices.Clone(values)
+	for i, value := range values {
+		reflected := reflect.ValueOf(value)
+		if reflected.Kind() == reflect.Pointer {
+			values[i] = nil
+			if !reflected.IsNil() {
+				values[i] = reflected.Elem().Interface()
+			}
+		}
+	}
+
+	if writer.serialization == TableData {
+		return writer.writeTableDataRow(values)
+	}
+	return writer.writeBinary2Row(values)
+}
+
+// Close finishes the document and flushes it to the underlying writer.
+func (writer *Writer) Close() error {
+	if writer.serialization == TableData {
+		writer.writer.WriteString("</TABLEDATA></DATA>\n")
+	} else {
+		if err := writer.stream.Close(); err != nil {
+			return err
+		}
+		writer.writer.WriteString("\n</STREAM></BINARY2></DATA>\n")
+	}
+	writer.writer.WriteString("</TABLE>\n</RESOURCE>\n</VOTABLE>\n")
+
+	return writer.writer.Flush()
+}
+
+// Write a TR element, with empty TDs for nulls
+func (writer *Writer) writeTableDataRow(values []any) error {
+	writer.writer.WriteString("<TR>")
+	for i, value := range values {
+		if value == nil {
+			writer.writer.WriteString("<TD/>")
+			continue
+		}
+
+		text, err := formatValue(writer.fields[i], value)
+		if err != nil {
+			return err
+		}
+		writer.writer.WriteString("<TD>" + escape(text) + "</TD>")
+	}
+	_, err := writer.writer.WriteString("</TR>\n")
+	return err
+}
+
+// Write a row as a bitmap of nulls followed by each value, big-endian
+func (writer *Writer) writeBinary2Row(values []any) error {
+	row := writer.row[:0]
+
+	nulls := make([]byte, (len(values)+7)/8)
+	for i, value := range values {
+		if value == nil {
+			nulls[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+	row = append(row, nulls...)
+
+	for i, value := range values {
+		field := writer.fields[i]
+		var err error
+		row, err = appendBinary(row, field, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.row = row
+	_, err := writer.stream.Write(row)
+	return err
+}
+
+// Append the binary form of value to row. Nulls are written as zeros, or an empty string.
+func appendBinary(row []byte, field Field, value any) ([]byte, error) {
+	switch field.Datatype {
+	case "char":
+		text := ""
+		if value != nil {
+			var err error
+			if text, err = formatValue(field, value); err != nil {
+				return row, err
+			}
+		}
+		row = binary.BigEndian.AppendUint32(row, uint32(len(text)))
+		return append(row, text...), nil
+	case "boolean":
+		switch value {
+		case nil:
+			return append(row, '?'), nil
+		case true:
+			return append(row, 'T'), nil
+		case false:
+			return append(row, 'F'), nil
+		}
+	case "long":
+		if value == nil {
+			return binary.BigEndian.AppendUint64(row, 0), nil
+		}
+		if n, ok := toInt64(value); ok {
+			return binary.BigEndian.AppendUint64(row, uint64(n)), nil
+		}
+	case "double":
+		if value == nil {
+			return binary.BigEndian.AppendUint64(row, math.Float64bits(math.NaN())), nil
+		}
+		if f, ok := toFloat64(value); ok {
+			return binary.BigEndian.AppendUint64(row, math.Float64bits(f)), nil
+		}
+	}
+
+	return row, fmt.Errorf("field %s: can't write %T as %s", field.Name, value, field.Datatype)
+}
+
+// Format a value as the text of a TD, or a char value
+func formatValue(field Field, value any) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case time.Time:
+		return value.UTC().Format(time.RFC3339Nano), nil
+	case bool:
+		if value {
+			return "T", nil
+		}
+		return "F", nil
+	}
+
+	if n, ok := toInt64(value); ok {
+		return strconv.FormatInt(n, 10), nil
+	}
+	if f, ok := toFloat64(value); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64), nil
+	}
+
+	return "", fmt.Errorf("field %s: can't write %T", field.Name, value)
+}
+
+// Convert any Go integer to an int64
+func toInt64(value any) (int64, bool) {
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() >= reflect.Int && reflected.Kind() <= reflect.Int64 {
+		return reflected.Int(), true
+	}
+	return 0, false
+}
+
+// Convert a Go float to a float64
+func toFloat64(value any) (float64, bool) {
+	reflected := reflect.ValueOf(value)
+	if reflected.Kind() == reflect.Float32 || reflected.Kind() == reflect.Float64 {
+		return reflected.Float(), true
+	}
+	return 0, false
+}
+
+// Escape text for XML character data or attributes
+func escape(text string) string {
+	var builder strings.Builder
+	xml.EscapeText(&builder, []byte(text))
+	return builder.String()
+}
+
+// lineWriter breaks base64 text into lines of 76 characters, which is friendlier to tools
+// that read XML a line at a time
+type lineWriter struct {
+	writer *bufio.Writer
+	column int
+}
+
+func (lines *lineWriter) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if lines.column == 76 {
+			lines.writer.WriteByte('\n')
+			lines.column = 0
+		}
+		lines.writer.WriteByte(c)
+		lines.column++
+	}
+	return len(p), nil
+}
@@ -0,0 +1,112 @@
+// Tests for Writer, reading what it writes back with Reader
+package votable
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"star-catalog/galaxy"
+	"star-catalog/star"
+)
+
+// testStars has a star with every value, and one with as few as possible
+func testStars() []star.Star {
+	ra, dec, parallax, pmra := 219.90085, -60.83562, 750.81, -3679.25
+	return []star.Star{
+		{Id: 1, GalaxyId: 1, Name: "Alpha Centauri", GaiaCatalogueId: "gaia_catalogue_id2",
+			CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), Ra: &ra, Dec: &dec, Parallax: &parallax, Pmra: &pmra},
+		{Id: 2, GalaxyId: 1, Name: "Sun <&>", GaiaCatalogueId: "gaia_catalogue_id1",
+			CreatedAt: time.Date(2024, 5, 1, 12, 31, 0, 0, time.UTC)},
+	}
+}
+
+// TestWriterRoundTrip writes stars in each serialization, reads them back, and checks that
+// they are unchanged, including the nulls
+func TestWriterRoundTrip(t *testing.T) {
+	fields, err := FieldsOf(star.Star{})
+	if err != nil {
+		t.Fatalf(`FieldsOf %v`, err)
+	}
+
+	for _, serialization := range []Serialization{TableData, Binary2} {
+		var buffer bytes.Buffer
+		writer, err := NewWriter(&buffer, "stars", fields, serialization)
+		if err != nil {
+			t.Fatalf(`NewWriter %v`, err)
+		}
+		for _, s := range testStars() {
+			if err := writer.WriteStruct(s); err != nil {
+				t.Fatalf(`WriteStruct %v`, err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf(`Close %v`, err)
+		}
+
+		if !strings.Contains(buffer.String(), `<FIELD name="pmra" datatype="double" unit="mas/yr" ucd="pos.pm;pos.eq.ra"></FIELD>`) {
+			t.Fatalf(`%s output should describe pmra, is %s`, serialization, buffer.String())
+		}
+
+		reader, err := NewReader(&buffer)
+		if err != nil {
+			t.Fatalf(`NewReader %v`, err)
+		}
+		var got []star.Star
+		for {
+			var s star.Star
+			err := reader.Decode(&s)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatalf(`%s Decode %v`, serialization, err)
+			}
+			got = append(got, s)
+		}
+
+		if !reflect.DeepEqual(got, testStars()) {
+			t.Fatalf(`%s should read back %+v, is %+v`, serialization, testStars(), got)
+		}
+	}
+}
+
+// TestWriterGalaxyNulls writes a galaxy with no properties as TABLEDATA, and checks that
+// the nulls are empty cells
+func TestWriterGalaxyNulls(t *testing.T) {
+	fields, err := FieldsOf(galaxy.Galaxy{})
+	if err != nil {
+		t.Fatalf(`FieldsOf %v`, err)
+	}
+
+	var buffer bytes.Buffer
+	writer, err := NewWriter(&buffer, "galaxies", fields, TableData)
+	if err != nil {
+		t.Fatalf(`NewWriter %v`, err)
+	}
+	if err := writer.WriteStruct(galaxy.Galaxy{Id: 1, Name: "Milky Way", UgcNumber: "ugc_number1"}); err != nil {
+		t.Fatalf(`WriteStruct %v`, err)
+	}
+	writer.Close()
+
+	want := "<TR><TD>1</TD><TD>Milky Way</TD><TD>ugc_number1</TD><TD>0001-01-01T00:00:00Z</TD>" + strings.Repeat("<TD/>", 10) + "</TR>"
+	if !strings.Contains(buffer.String(), want) {
+		t.Fatalf(`Output should contain %s, is %s`, want, buffer.String())
+	}
+}
+
+// TestWriterUnsupported checks that fields the writer can't write are refused
+func TestWriterUnsupported(t *testing.T) {
+	fields := []Field{{Name: "flux", Datatype: "float", Arraysize: "3"}}
+
+	if _, err := NewWriter(io.Discard, "table", fields, TableData); err == nil {
+		t.Fatalf(`NewWriter should refuse a float array`)
+	}
+	if _, err := NewWriter(io.Discard, "table", nil, "FITS"); err == nil {
+		t.Fatalf(`NewWriter should refuse FITS serialization`)
+	}
+}